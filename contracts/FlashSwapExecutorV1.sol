@@ -20,6 +20,8 @@ struct Arb {
 	// uint112[2] sellReserve;
 	bool buyFromIsWMetis;
 	bool sellToIsWMetis;
+	// Part of the same split route as the arb before it
+	bool continuesRoute;
 }
 
 struct Vars {
@@ -33,104 +35,48 @@ contract FlashSwapExecutorV1 is Withdrawable {
 	address public immutable NATIVE_TOKEN;
 	IWETH public immutable WMETIS;
 
+	mapping(address => bool) public executors;
+
 	constructor(address owner_, address nativeToken_, IWETH wmetis_) Withdrawable(owner_) {
 		NATIVE_TOKEN = nativeToken_;
 		WMETIS = wmetis_;
+		executors[owner_] = true;
+	}
+
+	modifier onlyExecutor() {
+		require(executors[msg.sender], "Not an executor");
+		_;
+	}
+
+	// Each bot account that sends arbs has to be allowed here
+	function setExecutor(address executor, bool allowed) external onlyOwner {
+		executors[executor] = allowed;
 	}
 
 	receive() external payable {}
 
-	// By right, this should only be called by authorized addresses
-	function executeNativeArb(Arb[] calldata arbs, uint112 minProfit) external {
+	// Returns what the arbs made, so a simulated call shows the profit the chain would give us
+	function executeNativeArb(Arb[] calldata arbs, uint112 minProfit) external onlyExecutor returns (uint256 profit) {
 		bool gotOpportunity = false;
+		uint256 balanceBefore = IERC20(NATIVE_TOKEN).balanceOf(address(this));
 
-		for (uint256 i = 0; i < arbs.length; i++) {
-			Vars memory myVar = Vars(true, 0, 0, 1);
-
-			// Check presence of opportunity
-			{
-				(uint256 buyReserve0, uint256 buyReserve1, ) = IUniswapV2PairV1(arbs[i].buyFromPair).getReserves();
-				(uint256 sellReserve0, uint256 sellReserve1, ) = IUniswapV2PairV1(arbs[i].sellToPair).getReserves();
-
-				for (uint8 k = 1; k <= 2; k++) {
-					if (
-						IUniswapV2PairV1(arbs[i].buyFromPair).token0() == NATIVE_TOKEN ||
-						IUniswapV2PairV1(arbs[i].buyFromPair).token0() == address(WMETIS)
-					) {
-						myVar.amountOutInter = getAmountOut(
-							arbs[i].nativeInAmount / k,
-							buyReserve0,
-							buyReserve1,
-							arbs[i].buyFromFee
-						);
-					} else {
-						myVar.amountOutInter = getAmountOut(
-							arbs[i].nativeInAmount / k,
-							buyReserve1,
-							buyReserve0,
-							arbs[i].buyFromFee
-						);
-					}
-
-					if (
-						IUniswapV2PairV1(arbs[i].sellToPair).token0() == NATIVE_TOKEN ||
-						IUniswapV2PairV1(arbs[i].sellToPair).token0() == address(WMETIS)
-					) {
-						myVar.amountOutProfit = getAmountOut(
-							myVar.amountOutInter,
-							sellReserve1,
-							sellReserve0,
-							arbs[i].sellToFee
-						);
-					} else {
-						myVar.amountOutProfit = getAmountOut(
-							myVar.amountOutInter,
-							sellReserve0,
-							sellReserve1,
-							arbs[i].sellToFee
-						);
-					}
-
-					myVar.opportunityPresent = myVar.amountOutProfit > (arbs[i].nativeInAmount / k + minProfit);
-
-					if (myVar.opportunityPresent) {
-						myVar.denom = k;
-						break;
-					}
-				}
+		for (uint256 i = 0; i < arbs.length; ) {
+			// A split route is the arb and every leg that continues it
+			uint256 end = i + 1;
+			while (end < arbs.length && arbs[end].continuesRoute) {
+				end++;
 			}
 
-			// require(buyReserve0 == buyReserve[0], "BR0");
-			// require(buyReserve1 == buyReserve[1], "BR1");
-			// require(sellReserve0 == sellReserve[0], "SR0");
-			// require(sellReserve1 == sellReserve[1], "SR1");
-
-			if (myVar.opportunityPresent) {
-				// Pack calldata
-				bytes memory data = abi.encode(
-					arbs[i].buyFromPair,
-					arbs[i].nativeInAmount / myVar.denom,
-					myVar.amountOutInter,
-					myVar.amountOutProfit,
-					arbs[i].sellToPair,
-					arbs[i].buyFromIsWMetis,
-					arbs[i].sellToIsWMetis
-				);
-
-				// Identify the tokens
-				address token0 = IUniswapV2PairV1(arbs[i].sellToPair).token0();
-
-				// Set the amounts
-				// We only work with NATIVE_TOKEN pairs
-				uint256 amount0Out = token0 == NATIVE_TOKEN || token0 == address(WMETIS) ? myVar.amountOutProfit : 0;
-				uint256 amount1Out = token0 == NATIVE_TOKEN || token0 == address(WMETIS) ? 0 : myVar.amountOutProfit;
-
-				// Call swap with calldata
-				IUniswapV2PairV1(arbs[i].sellToPair).swap(amount0Out, amount1Out, address(this), data);
-
-				// We got opportunity!
-				gotOpportunity = gotOpportunity || true;
+			if (end - i > 1) {
+				// A route that no longer pays is skipped as a whole, the other arbs still go through
+				try this.executeRoute(arbs, i, end, minProfit) {
+					gotOpportunity = true;
+				} catch {}
+			} else if (_executeArb(arbs[i], minProfit)) {
+				gotOpportunity = true;
 			}
+
+			i = end;
 		}
 
 		// Transfer profits
@@ -140,7 +86,95 @@ contract FlashSwapExecutorV1 is Withdrawable {
 			// require(balance > 0, "NO PROFIT");
 			bool success = nativeToken.transfer(msg.sender, balance);
 			require(success, "PROFIT TRANSFER FAILED");
+
+			profit = balance - balanceBefore;
+		}
+	}
+
+	// Runs the legs of a split route at the sizes they were priced at, reverting unless together they clear minProfit
+	// Legs are sized against the reserves the previous legs leave, so they can't be halved or skipped on their own
+	function executeRoute(Arb[] calldata arbs, uint256 start, uint256 end, uint112 minProfit) external {
+		require(msg.sender == address(this), "Not self");
+
+		IERC20 nativeToken = IERC20(NATIVE_TOKEN);
+		uint256 balanceBefore = nativeToken.balanceOf(address(this));
+
+		for (uint256 i = start; i < end; i++) {
+			_flashSwap(arbs[i], arbs[i].nativeInAmount, arbs[i].tokenAmount, arbs[i].nativeOutAmount);
+		}
+
+		require(nativeToken.balanceOf(address(this)) > balanceBefore + minProfit, "ROUTE NOT PROFITABLE");
+	}
+
+	function _executeArb(Arb calldata arb, uint112 minProfit) internal returns (bool) {
+		Vars memory myVar = Vars(true, 0, 0, 1);
+
+		// Check presence of opportunity
+		{
+			(uint256 buyReserve0, uint256 buyReserve1, ) = IUniswapV2PairV1(arb.buyFromPair).getReserves();
+			(uint256 sellReserve0, uint256 sellReserve1, ) = IUniswapV2PairV1(arb.sellToPair).getReserves();
+
+			for (uint8 k = 1; k <= 2; k++) {
+				if (
+					IUniswapV2PairV1(arb.buyFromPair).token0() == NATIVE_TOKEN ||
+					IUniswapV2PairV1(arb.buyFromPair).token0() == address(WMETIS)
+				) {
+					myVar.amountOutInter = getAmountOut(arb.nativeInAmount / k, buyReserve0, buyReserve1, arb.buyFromFee);
+				} else {
+					myVar.amountOutInter = getAmountOut(arb.nativeInAmount / k, buyReserve1, buyReserve0, arb.buyFromFee);
+				}
+
+				if (
+					IUniswapV2PairV1(arb.sellToPair).token0() == NATIVE_TOKEN ||
+					IUniswapV2PairV1(arb.sellToPair).token0() == address(WMETIS)
+				) {
+					myVar.amountOutProfit = getAmountOut(myVar.amountOutInter, sellReserve1, sellReserve0, arb.sellToFee);
+				} else {
+					myVar.amountOutProfit = getAmountOut(myVar.amountOutInter, sellReserve0, sellReserve1, arb.sellToFee);
+				}
+
+				myVar.opportunityPresent = myVar.amountOutProfit > (arb.nativeInAmount / k + minProfit);
+
+				if (myVar.opportunityPresent) {
+					myVar.denom = k;
+					break;
+				}
+			}
+		}
+
+		if (!myVar.opportunityPresent) {
+			return false;
 		}
+
+		_flashSwap(arb, arb.nativeInAmount / myVar.denom, myVar.amountOutInter, myVar.amountOutProfit);
+
+		// We got opportunity!
+		return true;
+	}
+
+	// Takes the native out of sellToPair first, the hook pays buyFromPair and sends its tokens to sellToPair
+	function _flashSwap(Arb calldata arb, uint256 nativeInAmount, uint256 tokenAmount, uint256 nativeOutAmount) internal {
+		// Pack calldata
+		bytes memory data = abi.encode(
+			arb.buyFromPair,
+			nativeInAmount,
+			tokenAmount,
+			nativeOutAmount,
+			arb.sellToPair,
+			arb.buyFromIsWMetis,
+			arb.sellToIsWMetis
+		);
+
+		// Identify the tokens
+		address token0 = IUniswapV2PairV1(arb.sellToPair).token0();
+
+		// Set the amounts
+		// We only work with NATIVE_TOKEN pairs
+		uint256 amount0Out = token0 == NATIVE_TOKEN || token0 == address(WMETIS) ? nativeOutAmount : 0;
+		uint256 amount1Out = token0 == NATIVE_TOKEN || token0 == address(WMETIS) ? 0 : nativeOutAmount;
+
+		// Call swap with calldata
+		IUniswapV2PairV1(arb.sellToPair).swap(amount0Out, amount1Out, address(this), data);
 	}
 
 	function getAmountOut(
@@ -0,0 +1,47 @@
+//SPDX-License-Identifier: MIT
+pragma solidity ^0.8.0;
+
+// Bare ERC20 for the simulated chain tests, anyone can mint
+// Has no constructor state so its runtime code can be placed at a fixed address in genesis, like METIS on Metis
+contract MockERC20 {
+	uint8 public constant decimals = 18;
+
+	uint256 public totalSupply;
+	mapping(address => uint256) public balanceOf;
+	mapping(address => mapping(address => uint256)) public allowance;
+
+	event Transfer(address indexed from, address indexed to, uint256 value);
+	event Approval(address indexed owner, address indexed spender, uint256 value);
+
+	function mint(address to, uint256 amount) external {
+		totalSupply += amount;
+		balanceOf[to] += amount;
+		emit Transfer(address(0), to, amount);
+	}
+
+	function approve(address spender, uint256 amount) external returns (bool) {
+		allowance[msg.sender][spender] = amount;
+		emit Approval(msg.sender, spender, amount);
+		return true;
+	}
+
+	function transfer(address to, uint256 amount) external returns (bool) {
+		_transfer(msg.sender, to, amount);
+		return true;
+	}
+
+	function transferFrom(address from, address to, uint256 amount) external returns (bool) {
+		if (allowance[from][msg.sender] != type(uint256).max) {
+			allowance[from][msg.sender] -= amount;
+		}
+		_transfer(from, to, amount);
+		return true;
+	}
+
+	function _transfer(address from, address to, uint256 amount) internal {
+		require(balanceOf[from] >= amount, "MockERC20: INSUFFICIENT_BALANCE");
+		balanceOf[from] -= amount;
+		balanceOf[to] += amount;
+		emit Transfer(from, to, amount);
+	}
+}
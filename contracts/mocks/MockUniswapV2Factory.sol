@@ -0,0 +1,45 @@
+//SPDX-License-Identifier: MIT
+pragma solidity ^0.8.0;
+
+import "./MockUniswapV2Pair.sol";
+
+// Stands in for every factory the bot knows, placed at their addresses in genesis
+// fee and feeRate are what AgoraSwap and NetSwap expose, in fee per thousands
+// Pairs are deployed with CREATE2 like the real factories, so the bot can verify them by address
+contract MockUniswapV2Factory {
+	bytes32 public constant INIT_CODE_PAIR_HASH = keccak256(type(MockUniswapV2Pair).creationCode);
+
+	address[] public allPairs;
+	mapping(address => mapping(address => address)) public getPair;
+
+	uint256 public fee;
+
+	event PairCreated(address indexed token0, address indexed token1, address pair, uint256);
+
+	function setFee(uint256 fee_) external {
+		fee = fee_;
+	}
+
+	function feeRate() external view returns (uint256) {
+		return fee;
+	}
+
+	function allPairsLength() external view returns (uint256) {
+		return allPairs.length;
+	}
+
+	function createPair(address tokenA, address tokenB, uint256 feePerTenThousands) external returns (address pair) {
+		require(tokenA != tokenB, "MockUniswapV2Factory: IDENTICAL_ADDRESSES");
+		(address token0, address token1) = tokenA < tokenB ? (tokenA, tokenB) : (tokenB, tokenA);
+		require(getPair[token0][token1] == address(0), "MockUniswapV2Factory: PAIR_EXISTS");
+
+		bytes32 salt = keccak256(abi.encodePacked(token0, token1));
+		pair = address(new MockUniswapV2Pair{salt: salt}());
+		MockUniswapV2Pair(pair).initialize(token0, token1, feePerTenThousands);
+		getPair[token0][token1] = pair;
+		getPair[token1][token0] = pair;
+		allPairs.push(pair);
+
+		emit PairCreated(token0, token1, pair, allPairs.length);
+	}
+}
@@ -0,0 +1,90 @@
+//SPDX-License-Identifier: MIT
+pragma solidity ^0.8.0;
+
+interface IMockERC20 {
+	function balanceOf(address account) external view returns (uint256);
+
+	function transfer(address to, uint256 amount) external returns (bool);
+}
+
+interface IUniswapV2Callee {
+	function uniswapV2Call(address sender, uint256 amount0, uint256 amount1, bytes calldata data) external;
+}
+
+// The parts of a UniswapV2 pair the bot and our contracts use, with the fee set per pair
+// Liquidity is added by sending both tokens to the pair and calling sync
+contract MockUniswapV2Pair {
+	address public factory;
+	address public token0;
+	address public token1;
+	uint256 public feePerTenThousands;
+
+	uint112 private reserve0;
+	uint112 private reserve1;
+	uint32 private blockTimestampLast;
+
+	event Sync(uint112 reserve0, uint112 reserve1);
+	event Swap(
+		address indexed sender,
+		uint256 amount0In,
+		uint256 amount1In,
+		uint256 amount0Out,
+		uint256 amount1Out,
+		address indexed to
+	);
+
+	// No constructor arguments, so every pair has the same init code hash for CREATE2
+	constructor() {
+		factory = msg.sender;
+	}
+
+	function initialize(address token0_, address token1_, uint256 feePerTenThousands_) external {
+		require(msg.sender == factory, "MockUniswapV2Pair: FORBIDDEN");
+		token0 = token0_;
+		token1 = token1_;
+		feePerTenThousands = feePerTenThousands_;
+	}
+
+	function getReserves() public view returns (uint112, uint112, uint32) {
+		return (reserve0, reserve1, blockTimestampLast);
+	}
+
+	function sync() external {
+		_update(IMockERC20(token0).balanceOf(address(this)), IMockERC20(token1).balanceOf(address(this)));
+	}
+
+	function swap(uint256 amount0Out, uint256 amount1Out, address to, bytes calldata data) external {
+		require(amount0Out > 0 || amount1Out > 0, "MockUniswapV2Pair: INSUFFICIENT_OUTPUT_AMOUNT");
+		require(amount0Out < reserve0 && amount1Out < reserve1, "MockUniswapV2Pair: INSUFFICIENT_LIQUIDITY");
+
+		if (amount0Out > 0) IMockERC20(token0).transfer(to, amount0Out);
+		if (amount1Out > 0) IMockERC20(token1).transfer(to, amount1Out);
+		if (data.length > 0) IUniswapV2Callee(to).uniswapV2Call(msg.sender, amount0Out, amount1Out, data);
+
+		uint256 balance0 = IMockERC20(token0).balanceOf(address(this));
+		uint256 balance1 = IMockERC20(token1).balanceOf(address(this));
+
+		uint256 amount0In = balance0 > reserve0 - amount0Out ? balance0 - (reserve0 - amount0Out) : 0;
+		uint256 amount1In = balance1 > reserve1 - amount1Out ? balance1 - (reserve1 - amount1Out) : 0;
+		require(amount0In > 0 || amount1In > 0, "MockUniswapV2Pair: INSUFFICIENT_INPUT_AMOUNT");
+
+		// Same K check as UniswapV2, with our fee
+		uint256 balance0Adjusted = balance0 * 10000 - amount0In * feePerTenThousands;
+		uint256 balance1Adjusted = balance1 * 10000 - amount1In * feePerTenThousands;
+		require(
+			balance0Adjusted * balance1Adjusted >= uint256(reserve0) * uint256(reserve1) * 10000 ** 2,
+			"MockUniswapV2Pair: K"
+		);
+
+		_update(balance0, balance1);
+		emit Swap(msg.sender, amount0In, amount1In, amount0Out, amount1Out, to);
+	}
+
+	function _update(uint256 balance0, uint256 balance1) private {
+		require(balance0 <= type(uint112).max && balance1 <= type(uint112).max, "MockUniswapV2Pair: OVERFLOW");
+		reserve0 = uint112(balance0);
+		reserve1 = uint112(balance1);
+		blockTimestampLast = uint32(block.timestamp);
+		emit Sync(reserve0, reserve1);
+	}
+}
@@ -0,0 +1,25 @@
+//SPDX-License-Identifier: MIT
+pragma solidity ^0.8.0;
+
+import "./MockERC20.sol";
+
+// Wraps the native coin 1:1, like WMETIS
+contract MockWMETIS is MockERC20 {
+	receive() external payable {
+		deposit();
+	}
+
+	function deposit() public payable {
+		totalSupply += msg.value;
+		balanceOf[msg.sender] += msg.value;
+		emit Transfer(address(0), msg.sender, msg.value);
+	}
+
+	function withdraw(uint256 amount) external {
+		require(balanceOf[msg.sender] >= amount, "MockWMETIS: INSUFFICIENT_BALANCE");
+		balanceOf[msg.sender] -= amount;
+		totalSupply -= amount;
+		payable(msg.sender).transfer(amount);
+		emit Transfer(msg.sender, address(0), amount);
+	}
+}
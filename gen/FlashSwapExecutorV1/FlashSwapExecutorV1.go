@@ -0,0 +1,457 @@
+// Code generated - DO NOT EDIT.
+// This file is a generated binding and any manual changes will be lost.
+
+package FlashSwapExecutorV1
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+	_ = errors.New
+	_ = big.NewInt
+	_ = strings.NewReader
+	_ = ethereum.NotFound
+	_ = bind.Bind
+	_ = common.Big1
+	_ = types.BloomLookup
+	_ = event.NewSubscription
+	_ = abi.ConvertType
+)
+
+// Arb is an auto generated low-level Go binding around an user-defined struct.
+type Arb struct {
+	BuyFromPair     common.Address
+	BuyFromFee      uint8
+	NativeInAmount  *big.Int
+	TokenAmount     *big.Int
+	NativeOutAmount *big.Int
+	Profit          *big.Int
+	SellToPair      common.Address
+	SellToFee       uint8
+	BuyFromIsWMetis bool
+	SellToIsWMetis  bool
+	ContinuesRoute  bool
+}
+
+// FlashSwapExecutorV1MetaData contains all meta data concerning the FlashSwapExecutorV1 contract.
+var FlashSwapExecutorV1MetaData = &bind.MetaData{
+	ABI: "[{\"type\":\"constructor\",\"inputs\":[{\"name\":\"owner_\",\"type\":\"address\"},{\"name\":\"nativeToken_\",\"type\":\"address\"},{\"name\":\"wmetis_\",\"type\":\"address\"}],\"stateMutability\":\"nonpayable\"},{\"type\":\"function\",\"name\":\"NATIVE_TOKEN\",\"inputs\":[],\"outputs\":[{\"name\":\"\",\"type\":\"address\"}],\"stateMutability\":\"view\"},{\"type\":\"function\",\"name\":\"WMETIS\",\"inputs\":[],\"outputs\":[{\"name\":\"\",\"type\":\"address\",\"internalType\":\"contractIWETH\"}],\"stateMutability\":\"view\"},{\"type\":\"function\",\"name\":\"executeNativeArb\",\"inputs\":[{\"name\":\"arbs\",\"type\":\"tuple[]\",\"components\":[{\"name\":\"buyFromPair\",\"type\":\"address\"},{\"name\":\"buyFromFee\",\"type\":\"uint8\"},{\"name\":\"nativeInAmount\",\"type\":\"uint112\"},{\"name\":\"tokenAmount\",\"type\":\"uint112\"},{\"name\":\"nativeOutAmount\",\"type\":\"uint112\"},{\"name\":\"profit\",\"type\":\"uint112\"},{\"name\":\"sellToPair\",\"type\":\"address\"},{\"name\":\"sellToFee\",\"type\":\"uint8\"},{\"name\":\"buyFromIsWMetis\",\"type\":\"bool\"},{\"name\":\"sellToIsWMetis\",\"type\":\"bool\"},{\"name\":\"continuesRoute\",\"type\":\"bool\"}],\"internalType\":\"structArb[]\"},{\"name\":\"minProfit\",\"type\":\"uint112\"}],\"outputs\":[{\"name\":\"profit\",\"type\":\"uint256\",\"internalType\":\"uint256\"}],\"stateMutability\":\"nonpayable\"},{\"type\":\"function\",\"name\":\"executeRoute\",\"inputs\":[{\"name\":\"arbs\",\"type\":\"tuple[]\",\"components\":[{\"name\":\"buyFromPair\",\"type\":\"address\"},{\"name\":\"buyFromFee\",\"type\":\"uint8\"},{\"name\":\"nativeInAmount\",\"type\":\"uint112\"},{\"name\":\"tokenAmount\",\"type\":\"uint112\"},{\"name\":\"nativeOutAmount\",\"type\":\"uint112\"},{\"name\":\"profit\",\"type\":\"uint112\"},{\"name\":\"sellToPair\",\"type\":\"address\"},{\"name\":\"sellToFee\",\"type\":\"uint8\"},{\"name\":\"buyFromIsWMetis\",\"type\":\"bool\"},{\"name\":\"sellToIsWMetis\",\"type\":\"bool\"},{\"name\":\"continuesRoute\",\"type\":\"bool\"}],\"internalType\":\"structArb[]\"},{\"name\":\"start\",\"type\":\"uint256\"},{\"name\":\"end\",\"type\":\"uint256\"},{\"name\":\"minProfit\",\"type\":\"uint112\"}],\"outputs\":[],\"stateMutability\":\"nonpayable\"},{\"type\":\"function\",\"name\":\"executors\",\"inputs\":[{\"name\":\"\",\"type\":\"address\"}],\"outputs\":[{\"name\":\"\",\"type\":\"bool\"}],\"stateMutability\":\"view\"},{\"type\":\"function\",\"name\":\"hook\",\"inputs\":[{\"name\":\"sender\",\"type\":\"address\"},{\"name\":\"amount0\",\"type\":\"uint256\"},{\"name\":\"amount1\",\"type\":\"uint256\"},{\"name\":\"data\",\"type\":\"bytes\"}],\"outputs\":[],\"stateMutability\":\"nonpayable\"},{\"type\":\"function\",\"name\":\"miniMeCall\",\"inputs\":[{\"name\":\"sender\",\"type\":\"address\"},{\"name\":\"amount0\",\"type\":\"uint256\"},{\"name\":\"amount1\",\"type\":\"uint256\"},{\"name\":\"data\",\"type\":\"bytes\"}],\"outputs\":[],\"stateMutability\":\"nonpayable\"},{\"type\":\"function\",\"name\":\"netswapCall\",\"inputs\":[{\"name\":\"sender\",\"type\":\"address\"},{\"name\":\"amount0\",\"type\":\"uint256\"},{\"name\":\"amount1\",\"type\":\"uint256\"},{\"name\":\"data\",\"type\":\"bytes\"}],\"outputs\":[],\"stateMutability\":\"nonpayable\"},{\"type\":\"function\",\"name\":\"setExecutor\",\"inputs\":[{\"name\":\"executor\",\"type\":\"address\"},{\"name\":\"allowed\",\"type\":\"bool\"}],\"outputs\":[],\"stateMutability\":\"nonpayable\"},{\"type\":\"function\",\"name\":\"uniswapV2Call\",\"inputs\":[{\"name\":\"sender\",\"type\":\"address\"},{\"name\":\"amount0\",\"type\":\"uint256\"},{\"name\":\"amount1\",\"type\":\"uint256\"},{\"name\":\"data\",\"type\":\"bytes\"}],\"outputs\":[],\"stateMutability\":\"nonpayable\"},{\"stateMutability\":\"payable\",\"type\":\"receive\"}]",
+}
+
+// FlashSwapExecutorV1ABI is the input ABI used to generate the binding from.
+// Deprecated: Use FlashSwapExecutorV1MetaData.ABI instead.
+var FlashSwapExecutorV1ABI = FlashSwapExecutorV1MetaData.ABI
+
+// FlashSwapExecutorV1 is an auto generated Go binding around an Ethereum contract.
+type FlashSwapExecutorV1 struct {
+	FlashSwapExecutorV1Caller     // Read-only binding to the contract
+	FlashSwapExecutorV1Transactor // Write-only binding to the contract
+	FlashSwapExecutorV1Filterer   // Log filterer for contract events
+}
+
+// FlashSwapExecutorV1Caller is an auto generated read-only Go binding around an Ethereum contract.
+type FlashSwapExecutorV1Caller struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// FlashSwapExecutorV1Transactor is an auto generated write-only Go binding around an Ethereum contract.
+type FlashSwapExecutorV1Transactor struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// FlashSwapExecutorV1Filterer is an auto generated log filtering Go binding around an Ethereum contract events.
+type FlashSwapExecutorV1Filterer struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// FlashSwapExecutorV1Session is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type FlashSwapExecutorV1Session struct {
+	Contract     *FlashSwapExecutorV1 // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts        // Call options to use throughout this session
+	TransactOpts bind.TransactOpts    // Transaction auth options to use throughout this session
+}
+
+// FlashSwapExecutorV1CallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type FlashSwapExecutorV1CallerSession struct {
+	Contract *FlashSwapExecutorV1Caller // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts              // Call options to use throughout this session
+}
+
+// FlashSwapExecutorV1TransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type FlashSwapExecutorV1TransactorSession struct {
+	Contract     *FlashSwapExecutorV1Transactor // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts              // Transaction auth options to use throughout this session
+}
+
+// FlashSwapExecutorV1Raw is an auto generated low-level Go binding around an Ethereum contract.
+type FlashSwapExecutorV1Raw struct {
+	Contract *FlashSwapExecutorV1 // Generic contract binding to access the raw methods on
+}
+
+// FlashSwapExecutorV1CallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type FlashSwapExecutorV1CallerRaw struct {
+	Contract *FlashSwapExecutorV1Caller // Generic read-only contract binding to access the raw methods on
+}
+
+// FlashSwapExecutorV1TransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type FlashSwapExecutorV1TransactorRaw struct {
+	Contract *FlashSwapExecutorV1Transactor // Generic write-only contract binding to access the raw methods on
+}
+
+// NewFlashSwapExecutorV1 creates a new instance of FlashSwapExecutorV1, bound to a specific deployed contract.
+func NewFlashSwapExecutorV1(address common.Address, backend bind.ContractBackend) (*FlashSwapExecutorV1, error) {
+	contract, err := bindFlashSwapExecutorV1(address, backend, backend, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &FlashSwapExecutorV1{FlashSwapExecutorV1Caller: FlashSwapExecutorV1Caller{contract: contract}, FlashSwapExecutorV1Transactor: FlashSwapExecutorV1Transactor{contract: contract}, FlashSwapExecutorV1Filterer: FlashSwapExecutorV1Filterer{contract: contract}}, nil
+}
+
+// NewFlashSwapExecutorV1Caller creates a new read-only instance of FlashSwapExecutorV1, bound to a specific deployed contract.
+func NewFlashSwapExecutorV1Caller(address common.Address, caller bind.ContractCaller) (*FlashSwapExecutorV1Caller, error) {
+	contract, err := bindFlashSwapExecutorV1(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &FlashSwapExecutorV1Caller{contract: contract}, nil
+}
+
+// NewFlashSwapExecutorV1Transactor creates a new write-only instance of FlashSwapExecutorV1, bound to a specific deployed contract.
+func NewFlashSwapExecutorV1Transactor(address common.Address, transactor bind.ContractTransactor) (*FlashSwapExecutorV1Transactor, error) {
+	contract, err := bindFlashSwapExecutorV1(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &FlashSwapExecutorV1Transactor{contract: contract}, nil
+}
+
+// NewFlashSwapExecutorV1Filterer creates a new log filterer instance of FlashSwapExecutorV1, bound to a specific deployed contract.
+func NewFlashSwapExecutorV1Filterer(address common.Address, filterer bind.ContractFilterer) (*FlashSwapExecutorV1Filterer, error) {
+	contract, err := bindFlashSwapExecutorV1(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &FlashSwapExecutorV1Filterer{contract: contract}, nil
+}
+
+// bindFlashSwapExecutorV1 binds a generic wrapper to an already deployed contract.
+func bindFlashSwapExecutorV1(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
+	parsed, err := FlashSwapExecutorV1MetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, *parsed, caller, transactor, filterer), nil
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Raw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _FlashSwapExecutorV1.Contract.FlashSwapExecutorV1Caller.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Raw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.FlashSwapExecutorV1Transactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Raw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.FlashSwapExecutorV1Transactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1CallerRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _FlashSwapExecutorV1.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1TransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1TransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.contract.Transact(opts, method, params...)
+}
+
+// NATIVETOKEN is a free data retrieval call binding the contract method 0x31f7d964.
+//
+// Solidity: function NATIVE_TOKEN() view returns(address)
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Caller) NATIVETOKEN(opts *bind.CallOpts) (common.Address, error) {
+	var out []interface{}
+	err := _FlashSwapExecutorV1.contract.Call(opts, &out, "NATIVE_TOKEN")
+
+	if err != nil {
+		return *new(common.Address), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+
+	return out0, err
+
+}
+
+// NATIVETOKEN is a free data retrieval call binding the contract method 0x31f7d964.
+//
+// Solidity: function NATIVE_TOKEN() view returns(address)
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Session) NATIVETOKEN() (common.Address, error) {
+	return _FlashSwapExecutorV1.Contract.NATIVETOKEN(&_FlashSwapExecutorV1.CallOpts)
+}
+
+// NATIVETOKEN is a free data retrieval call binding the contract method 0x31f7d964.
+//
+// Solidity: function NATIVE_TOKEN() view returns(address)
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1CallerSession) NATIVETOKEN() (common.Address, error) {
+	return _FlashSwapExecutorV1.Contract.NATIVETOKEN(&_FlashSwapExecutorV1.CallOpts)
+}
+
+// WMETIS is a free data retrieval call binding the contract method 0xfdf2c947.
+//
+// Solidity: function WMETIS() view returns(address)
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Caller) WMETIS(opts *bind.CallOpts) (common.Address, error) {
+	var out []interface{}
+	err := _FlashSwapExecutorV1.contract.Call(opts, &out, "WMETIS")
+
+	if err != nil {
+		return *new(common.Address), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+
+	return out0, err
+
+}
+
+// WMETIS is a free data retrieval call binding the contract method 0xfdf2c947.
+//
+// Solidity: function WMETIS() view returns(address)
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Session) WMETIS() (common.Address, error) {
+	return _FlashSwapExecutorV1.Contract.WMETIS(&_FlashSwapExecutorV1.CallOpts)
+}
+
+// WMETIS is a free data retrieval call binding the contract method 0xfdf2c947.
+//
+// Solidity: function WMETIS() view returns(address)
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1CallerSession) WMETIS() (common.Address, error) {
+	return _FlashSwapExecutorV1.Contract.WMETIS(&_FlashSwapExecutorV1.CallOpts)
+}
+
+// Executors is a free data retrieval call binding the contract method 0x9ac2a011.
+//
+// Solidity: function executors(address ) view returns(bool)
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Caller) Executors(opts *bind.CallOpts, arg0 common.Address) (bool, error) {
+	var out []interface{}
+	err := _FlashSwapExecutorV1.contract.Call(opts, &out, "executors", arg0)
+
+	if err != nil {
+		return *new(bool), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(bool)).(*bool)
+
+	return out0, err
+
+}
+
+// Executors is a free data retrieval call binding the contract method 0x9ac2a011.
+//
+// Solidity: function executors(address ) view returns(bool)
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Session) Executors(arg0 common.Address) (bool, error) {
+	return _FlashSwapExecutorV1.Contract.Executors(&_FlashSwapExecutorV1.CallOpts, arg0)
+}
+
+// Executors is a free data retrieval call binding the contract method 0x9ac2a011.
+//
+// Solidity: function executors(address ) view returns(bool)
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1CallerSession) Executors(arg0 common.Address) (bool, error) {
+	return _FlashSwapExecutorV1.Contract.Executors(&_FlashSwapExecutorV1.CallOpts, arg0)
+}
+
+// ExecuteNativeArb is a paid mutator transaction binding the contract method 0x42d0567e.
+//
+// Solidity: function executeNativeArb((address,uint8,uint112,uint112,uint112,uint112,address,uint8,bool,bool,bool)[] arbs, uint112 minProfit) returns(uint256 profit)
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Transactor) ExecuteNativeArb(opts *bind.TransactOpts, arbs []Arb, minProfit *big.Int) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.contract.Transact(opts, "executeNativeArb", arbs, minProfit)
+}
+
+// ExecuteNativeArb is a paid mutator transaction binding the contract method 0x42d0567e.
+//
+// Solidity: function executeNativeArb((address,uint8,uint112,uint112,uint112,uint112,address,uint8,bool,bool,bool)[] arbs, uint112 minProfit) returns(uint256 profit)
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Session) ExecuteNativeArb(arbs []Arb, minProfit *big.Int) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.ExecuteNativeArb(&_FlashSwapExecutorV1.TransactOpts, arbs, minProfit)
+}
+
+// ExecuteNativeArb is a paid mutator transaction binding the contract method 0x42d0567e.
+//
+// Solidity: function executeNativeArb((address,uint8,uint112,uint112,uint112,uint112,address,uint8,bool,bool,bool)[] arbs, uint112 minProfit) returns(uint256 profit)
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1TransactorSession) ExecuteNativeArb(arbs []Arb, minProfit *big.Int) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.ExecuteNativeArb(&_FlashSwapExecutorV1.TransactOpts, arbs, minProfit)
+}
+
+// ExecuteRoute is a paid mutator transaction binding the contract method 0x78b9a64b.
+//
+// Solidity: function executeRoute((address,uint8,uint112,uint112,uint112,uint112,address,uint8,bool,bool,bool)[] arbs, uint256 start, uint256 end, uint112 minProfit) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Transactor) ExecuteRoute(opts *bind.TransactOpts, arbs []Arb, start *big.Int, end *big.Int, minProfit *big.Int) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.contract.Transact(opts, "executeRoute", arbs, start, end, minProfit)
+}
+
+// ExecuteRoute is a paid mutator transaction binding the contract method 0x78b9a64b.
+//
+// Solidity: function executeRoute((address,uint8,uint112,uint112,uint112,uint112,address,uint8,bool,bool,bool)[] arbs, uint256 start, uint256 end, uint112 minProfit) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Session) ExecuteRoute(arbs []Arb, start *big.Int, end *big.Int, minProfit *big.Int) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.ExecuteRoute(&_FlashSwapExecutorV1.TransactOpts, arbs, start, end, minProfit)
+}
+
+// ExecuteRoute is a paid mutator transaction binding the contract method 0x78b9a64b.
+//
+// Solidity: function executeRoute((address,uint8,uint112,uint112,uint112,uint112,address,uint8,bool,bool,bool)[] arbs, uint256 start, uint256 end, uint112 minProfit) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1TransactorSession) ExecuteRoute(arbs []Arb, start *big.Int, end *big.Int, minProfit *big.Int) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.ExecuteRoute(&_FlashSwapExecutorV1.TransactOpts, arbs, start, end, minProfit)
+}
+
+// Hook is a paid mutator transaction binding the contract method 0x9a7bff79.
+//
+// Solidity: function hook(address sender, uint256 amount0, uint256 amount1, bytes data) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Transactor) Hook(opts *bind.TransactOpts, sender common.Address, amount0 *big.Int, amount1 *big.Int, data []byte) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.contract.Transact(opts, "hook", sender, amount0, amount1, data)
+}
+
+// Hook is a paid mutator transaction binding the contract method 0x9a7bff79.
+//
+// Solidity: function hook(address sender, uint256 amount0, uint256 amount1, bytes data) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Session) Hook(sender common.Address, amount0 *big.Int, amount1 *big.Int, data []byte) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.Hook(&_FlashSwapExecutorV1.TransactOpts, sender, amount0, amount1, data)
+}
+
+// Hook is a paid mutator transaction binding the contract method 0x9a7bff79.
+//
+// Solidity: function hook(address sender, uint256 amount0, uint256 amount1, bytes data) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1TransactorSession) Hook(sender common.Address, amount0 *big.Int, amount1 *big.Int, data []byte) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.Hook(&_FlashSwapExecutorV1.TransactOpts, sender, amount0, amount1, data)
+}
+
+// MiniMeCall is a paid mutator transaction binding the contract method 0xf1ab65fc.
+//
+// Solidity: function miniMeCall(address sender, uint256 amount0, uint256 amount1, bytes data) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Transactor) MiniMeCall(opts *bind.TransactOpts, sender common.Address, amount0 *big.Int, amount1 *big.Int, data []byte) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.contract.Transact(opts, "miniMeCall", sender, amount0, amount1, data)
+}
+
+// MiniMeCall is a paid mutator transaction binding the contract method 0xf1ab65fc.
+//
+// Solidity: function miniMeCall(address sender, uint256 amount0, uint256 amount1, bytes data) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Session) MiniMeCall(sender common.Address, amount0 *big.Int, amount1 *big.Int, data []byte) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.MiniMeCall(&_FlashSwapExecutorV1.TransactOpts, sender, amount0, amount1, data)
+}
+
+// MiniMeCall is a paid mutator transaction binding the contract method 0xf1ab65fc.
+//
+// Solidity: function miniMeCall(address sender, uint256 amount0, uint256 amount1, bytes data) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1TransactorSession) MiniMeCall(sender common.Address, amount0 *big.Int, amount1 *big.Int, data []byte) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.MiniMeCall(&_FlashSwapExecutorV1.TransactOpts, sender, amount0, amount1, data)
+}
+
+// NetswapCall is a paid mutator transaction binding the contract method 0x924ba9cc.
+//
+// Solidity: function netswapCall(address sender, uint256 amount0, uint256 amount1, bytes data) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Transactor) NetswapCall(opts *bind.TransactOpts, sender common.Address, amount0 *big.Int, amount1 *big.Int, data []byte) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.contract.Transact(opts, "netswapCall", sender, amount0, amount1, data)
+}
+
+// NetswapCall is a paid mutator transaction binding the contract method 0x924ba9cc.
+//
+// Solidity: function netswapCall(address sender, uint256 amount0, uint256 amount1, bytes data) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Session) NetswapCall(sender common.Address, amount0 *big.Int, amount1 *big.Int, data []byte) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.NetswapCall(&_FlashSwapExecutorV1.TransactOpts, sender, amount0, amount1, data)
+}
+
+// NetswapCall is a paid mutator transaction binding the contract method 0x924ba9cc.
+//
+// Solidity: function netswapCall(address sender, uint256 amount0, uint256 amount1, bytes data) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1TransactorSession) NetswapCall(sender common.Address, amount0 *big.Int, amount1 *big.Int, data []byte) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.NetswapCall(&_FlashSwapExecutorV1.TransactOpts, sender, amount0, amount1, data)
+}
+
+// SetExecutor is a paid mutator transaction binding the contract method 0x1e1bff3f.
+//
+// Solidity: function setExecutor(address executor, bool allowed) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Transactor) SetExecutor(opts *bind.TransactOpts, executor common.Address, allowed bool) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.contract.Transact(opts, "setExecutor", executor, allowed)
+}
+
+// SetExecutor is a paid mutator transaction binding the contract method 0x1e1bff3f.
+//
+// Solidity: function setExecutor(address executor, bool allowed) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Session) SetExecutor(executor common.Address, allowed bool) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.SetExecutor(&_FlashSwapExecutorV1.TransactOpts, executor, allowed)
+}
+
+// SetExecutor is a paid mutator transaction binding the contract method 0x1e1bff3f.
+//
+// Solidity: function setExecutor(address executor, bool allowed) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1TransactorSession) SetExecutor(executor common.Address, allowed bool) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.SetExecutor(&_FlashSwapExecutorV1.TransactOpts, executor, allowed)
+}
+
+// UniswapV2Call is a paid mutator transaction binding the contract method 0x10d1e85c.
+//
+// Solidity: function uniswapV2Call(address sender, uint256 amount0, uint256 amount1, bytes data) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Transactor) UniswapV2Call(opts *bind.TransactOpts, sender common.Address, amount0 *big.Int, amount1 *big.Int, data []byte) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.contract.Transact(opts, "uniswapV2Call", sender, amount0, amount1, data)
+}
+
+// UniswapV2Call is a paid mutator transaction binding the contract method 0x10d1e85c.
+//
+// Solidity: function uniswapV2Call(address sender, uint256 amount0, uint256 amount1, bytes data) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Session) UniswapV2Call(sender common.Address, amount0 *big.Int, amount1 *big.Int, data []byte) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.UniswapV2Call(&_FlashSwapExecutorV1.TransactOpts, sender, amount0, amount1, data)
+}
+
+// UniswapV2Call is a paid mutator transaction binding the contract method 0x10d1e85c.
+//
+// Solidity: function uniswapV2Call(address sender, uint256 amount0, uint256 amount1, bytes data) returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1TransactorSession) UniswapV2Call(sender common.Address, amount0 *big.Int, amount1 *big.Int, data []byte) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.UniswapV2Call(&_FlashSwapExecutorV1.TransactOpts, sender, amount0, amount1, data)
+}
+
+// Receive is a paid mutator transaction binding the contract receive function.
+//
+// Solidity: receive() payable returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Transactor) Receive(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.contract.RawTransact(opts, nil) // calldata is disallowed for receive function
+}
+
+// Receive is a paid mutator transaction binding the contract receive function.
+//
+// Solidity: receive() payable returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1Session) Receive() (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.Receive(&_FlashSwapExecutorV1.TransactOpts)
+}
+
+// Receive is a paid mutator transaction binding the contract receive function.
+//
+// Solidity: receive() payable returns()
+func (_FlashSwapExecutorV1 *FlashSwapExecutorV1TransactorSession) Receive() (*types.Transaction, error) {
+	return _FlashSwapExecutorV1.Contract.Receive(&_FlashSwapExecutorV1.TransactOpts)
+}
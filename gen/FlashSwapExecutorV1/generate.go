@@ -0,0 +1,4 @@
+package FlashSwapExecutorV1
+
+// Generated from the ABI of contracts/FlashSwapExecutorV1.sol, abigen comes from the go-ethereum version in go.mod
+//go:generate go run github.com/ethereum/go-ethereum/cmd/abigen --abi ../../contracts/abi/FlashSwapExecutorV1.json --pkg FlashSwapExecutorV1 --type FlashSwapExecutorV1 --out FlashSwapExecutorV1.go
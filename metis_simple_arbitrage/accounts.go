@@ -0,0 +1,227 @@
+package metis_simple_arbitrage
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/cryptotriv/raikiri/lib/util"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"go.uber.org/zap"
+)
+
+// One of the EOAs we send arb txs from
+type executorAccount struct {
+	address    common.Address
+	privateKey *ecdsa.PrivateKey
+	nonces     nonceSource
+	auth       *bind.TransactOpts
+	balance    *big.Int
+	paused     bool
+}
+
+// Spreads arb txs over several executor accounts, so consecutive arbs don't queue behind one nonce
+type accountPool struct {
+	mu        sync.Mutex
+	accounts  []*executorAccount
+	chainId   *big.Int
+	selection string
+	next      int
+	state     *botState
+}
+
+func (s *botState) newAccountPool(privateKeyEnvs []string, chainId *big.Int, selection string) (*accountPool, error) {
+	if len(privateKeyEnvs) == 0 {
+		return nil, errors.New("no executor accounts configured")
+	}
+
+	pool := &accountPool{
+		chainId:   chainId,
+		selection: selection,
+		state:     s,
+	}
+
+	for _, privateKeyEnv := range privateKeyEnvs {
+		privateKey, err := crypto.HexToECDSA(os.Getenv(privateKeyEnv))
+		if err != nil {
+			return nil, err
+		}
+
+		address := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+		nonces, err := s.newNonceSource(address, privateKey, chainId)
+		if err != nil {
+			return nil, err
+		}
+
+		auth, err := s.newTransactOpts(privateKey, chainId)
+		if err != nil {
+			return nil, err
+		}
+
+		pool.accounts = append(pool.accounts, &executorAccount{
+			address:    address,
+			privateKey: privateKey,
+			nonces:     nonces,
+			auth:       auth,
+			balance:    big.NewInt(0),
+		})
+
+		s.logger.Info("Executor account loaded", zap.String("address", address.Hex()))
+	}
+
+	return pool, pool.refreshBalances()
+}
+
+// The first configured account, used for setup calls like health checks
+func (p *accountPool) primary() *executorAccount {
+	return p.accounts[0]
+}
+
+// Every account we may send from, the primary first
+func (p *accountPool) addresses() []common.Address {
+	addresses := make([]common.Address, len(p.accounts))
+	for i, account := range p.accounts {
+		addresses[i] = account.address
+	}
+
+	return addresses
+}
+
+// Picks the account for the next arb tx, nil if every account is paused
+func (p *accountPool) acquire() *executorAccount {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var selected *executorAccount
+
+	switch p.selection {
+	case ACCOUNT_SELECTION_LEAST_PENDING:
+		leastPending := -1
+		for _, account := range p.accounts {
+			if account.paused {
+				continue
+			}
+
+			pending := len(account.nonces.pendingTxs())
+			if leastPending == -1 || pending < leastPending {
+				selected = account
+				leastPending = pending
+			}
+		}
+	default:
+		// Round-robin
+		for i := 0; i < len(p.accounts); i++ {
+			account := p.accounts[(p.next+i)%len(p.accounts)]
+			if !account.paused {
+				selected = account
+				p.next = (p.next + i + 1) % len(p.accounts)
+				break
+			}
+		}
+	}
+
+	return selected
+}
+
+// Returns the prepared auth of an account, ready to be priced and given a nonce
+func (p *accountPool) takeAuth(account *executorAccount) *bind.TransactOpts {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return account.auth
+}
+
+// Prepares a fresh auth for the next tx of an account
+func (p *accountPool) renewAuth(account *executorAccount) error {
+	nextAuth, err := p.state.newTransactOpts(account.privateKey, p.chainId)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	account.auth = nextAuth
+	p.mu.Unlock()
+
+	return nil
+}
+
+// Updates balances and pauses accounts that are running low
+func (p *accountPool) refreshBalances() error {
+	minBalance := util.ToWei(MIN_EXECUTOR_BALANCE, 18)
+
+	for _, account := range p.accounts {
+		balance, err := p.state.readClient.BalanceAt(context.Background(), account.address, nil)
+		if err != nil {
+			return err
+		}
+
+		p.mu.Lock()
+		account.balance = balance
+
+		paused := balance.Cmp(minBalance) < 0
+		if paused != account.paused {
+			p.state.logger.Info("Executor account paused state changed",
+				zap.String("address", account.address.Hex()),
+				zap.Bool("paused", paused),
+				zap.String("balance", util.ToDecimal(balance, 18).String()),
+			)
+		}
+		account.paused = paused
+		p.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (p *accountPool) syncNonces() {
+	for _, account := range p.accounts {
+		err := account.nonces.sync()
+		if err != nil {
+			p.state.logger.Error("Error syncing nonces", zap.String("address", account.address.Hex()), zap.Error(err))
+		}
+	}
+}
+
+// Refreshes the gas prices of the prepared auths
+func (p *accountPool) applyGasPrices() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, account := range p.accounts {
+		p.state.applyGasPrices(account.auth, nil)
+	}
+}
+
+func (p *accountPool) totalBalance() *big.Int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	total := big.NewInt(0)
+	for _, account := range p.accounts {
+		total.Add(total, account.balance)
+	}
+
+	return total
+}
+
+// All pending txs across accounts
+func (p *accountPool) pendingTxs() []pendingTx {
+	var txs []pendingTx
+	for _, account := range p.accounts {
+		txs = append(txs, account.nonces.pendingTxs()...)
+	}
+	return txs
+}
+
+func (s *botState) executorAccountEnvs() []string {
+	if len(s.config.UseAccounts) > 0 {
+		return s.config.UseAccounts
+	}
+	return []string{s.privateKeyExecutor}
+}
@@ -0,0 +1,179 @@
+package metis_simple_arbitrage
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/cryptotriv/raikiri/lib/models"
+	"github.com/cryptotriv/raikiri/lib/telegram"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+)
+
+// Limits on how much a pool may change in one update before we stop trusting its token
+// Zero in the config means the default
+type anomalyThresholds struct {
+	liquidityRemovedPercent int64
+	priceJumpPercent        int64
+	nativeDropPercent       int64
+}
+
+func (s *botState) currentAnomalyThresholds() anomalyThresholds {
+	thresholds := anomalyThresholds{
+		liquidityRemovedPercent: int64(s.config.AnomalyLiquidityRemovedPercent),
+		priceJumpPercent:        int64(s.config.AnomalyPriceJumpPercent),
+		nativeDropPercent:       int64(s.config.AnomalyNativeDropPercent),
+	}
+
+	if thresholds.liquidityRemovedPercent <= 0 {
+		thresholds.liquidityRemovedPercent = ANOMALY_LIQUIDITY_REMOVED_PERCENT
+	}
+	if thresholds.priceJumpPercent <= 0 {
+		thresholds.priceJumpPercent = ANOMALY_PRICE_JUMP_PERCENT
+	}
+	if thresholds.nativeDropPercent <= 0 {
+		thresholds.nativeDropPercent = ANOMALY_NATIVE_DROP_PERCENT
+	}
+
+	return thresholds
+}
+
+// The reserves a market had before the first Sync of a block
+type reserveBaseline struct {
+	blockNumber uint64
+	reserves    [3]*big.Int
+}
+
+// What a Sync is checked against, so a drain split over several Syncs in a block is seen as a whole
+// current is what we hold for the market before applying the Sync
+func (s *botState) blockBaseline(market common.Address, blockNumber uint64, current [3]*big.Int) [3]*big.Int {
+	baseline, ok := s.blockStartReserves[market]
+	if ok && baseline.blockNumber == blockNumber {
+		return baseline.reserves
+	}
+
+	baseline = reserveBaseline{blockNumber: blockNumber}
+	for i, reserve := range current {
+		if reserve != nil {
+			baseline.reserves[i] = new(big.Int).Set(reserve)
+		}
+	}
+	s.blockStartReserves[market] = baseline
+
+	return baseline.reserves
+}
+
+// Why a reserve update looks like a rug rather than trading, empty if it looks fine
+// Swaps never shrink sqrt(k), so liquidity going away means burns or a drained pool
+func (s *botState) reserveAnomaly(pair models.UniswappyV2Pair, oldReserves [3]*big.Int, newReserve0 *big.Int, newReserve1 *big.Int) string {
+	oldNative := oldReserves[pair.NativeIndex]
+	oldToken := oldReserves[pair.TokenIndex]
+	if oldNative == nil || oldToken == nil || oldNative.Sign() == 0 || oldToken.Sign() == 0 {
+		return ""
+	}
+
+	newReserves := [2]*big.Int{newReserve0, newReserve1}
+	newNative := newReserves[pair.NativeIndex]
+	newToken := newReserves[pair.TokenIndex]
+
+	thresholds := s.currentAnomalyThresholds()
+	hundred := big.NewInt(100)
+
+	// Liquidity removed
+	oldLiquidity := new(big.Int).Sqrt(new(big.Int).Mul(oldNative, oldToken))
+	newLiquidity := new(big.Int).Sqrt(new(big.Int).Mul(newNative, newToken))
+	if oldLiquidity.Sign() > 0 && newLiquidity.Cmp(oldLiquidity) < 0 {
+		removed := new(big.Int).Sub(oldLiquidity, newLiquidity)
+		if exceedsPercent(removed, oldLiquidity, thresholds.liquidityRemovedPercent) {
+			return fmt.Sprint("liquidity removed: ", new(big.Int).Div(new(big.Int).Mul(removed, hundred), oldLiquidity), "%")
+		}
+	}
+
+	// METIS side drop
+	if newNative.Cmp(oldNative) < 0 {
+		dropped := new(big.Int).Sub(oldNative, newNative)
+		if exceedsPercent(dropped, oldNative, thresholds.nativeDropPercent) {
+			return fmt.Sprint("METIS reserve dropped: ", new(big.Int).Div(new(big.Int).Mul(dropped, hundred), oldNative), "%")
+		}
+	}
+
+	// Price jump, the price being METIS per token, compared cross-multiplied to stay in integers
+	if newToken.Sign() == 0 {
+		return "token reserve emptied"
+	}
+
+	newScaled := new(big.Int).Mul(newNative, oldToken)
+	oldScaled := new(big.Int).Mul(oldNative, newToken)
+	jump := new(big.Int).Abs(new(big.Int).Sub(newScaled, oldScaled))
+	if exceedsPercent(jump, oldScaled, thresholds.priceJumpPercent) {
+		return fmt.Sprint("price moved: ", new(big.Int).Div(new(big.Int).Mul(jump, hundred), oldScaled), "%")
+	}
+
+	return ""
+}
+
+// Whether part is more than percent of whole
+func exceedsPercent(part *big.Int, whole *big.Int, percent int64) bool {
+	return new(big.Int).Mul(part, big.NewInt(100)).Cmp(new(big.Int).Mul(whole, big.NewInt(percent))) > 0
+}
+
+// Keeps the evaluator off the token until the cooldown has passed
+// The reserves are still applied, so they are right once it comes back
+func (s *botState) quarantineToken(token common.Address, market common.Address, blockNumber uint64, reason string) {
+	until := blockNumber + ANOMALY_QUARANTINE_BLOCKS
+	alreadyQuarantined := s.isTokenQuarantined(token)
+	s.quarantinedTokens[token] = until
+
+	if alreadyQuarantined {
+		return
+	}
+
+	s.logger.Warn("Reserve anomaly - token quarantined",
+		zap.String("tokenAddress", token.Hex()),
+		zap.String("marketAddress", market.Hex()),
+		zap.Uint64("blockNumber", blockNumber),
+		zap.Uint64("untilBlock", until),
+		zap.String("reason", reason),
+	)
+
+	if s.anomalyAlerts {
+		go telegram.Notify(s.botContext, fmt.Sprint("Reserve anomaly on ", token.Hex(), " in ", market.Hex(), " (", reason, ") - token quarantined until block ", until))
+	}
+}
+
+func (s *botState) isTokenQuarantined(token common.Address) bool {
+	until, ok := s.quarantinedTokens[token]
+	if !ok {
+		return false
+	}
+
+	if s.lastReserveBlock >= until {
+		delete(s.quarantinedTokens, token)
+		s.logger.Info("Token quarantine over", zap.String("tokenAddress", token.Hex()))
+		return false
+	}
+
+	return true
+}
+
+// Checks every market of a full reserve update against the reserves we had
+// Both slices line up with allMarketAddresses
+func (s *botState) checkReserveAnomalies(oldReserves [][3]*big.Int, newReserves [][3]*big.Int, blockNumber uint64) {
+	if len(oldReserves) != len(newReserves) {
+		return
+	}
+
+	for token, pairs := range s.marketPairsByToken {
+		for _, pair := range pairs {
+			index := pair.TokenReserveIndex
+			if newReserves[index][0] == nil || newReserves[index][1] == nil {
+				continue
+			}
+
+			reason := s.reserveAnomaly(pair, oldReserves[index], newReserves[index][0], newReserves[index][1])
+			if reason != "" {
+				s.quarantineToken(token, pair.MarketAdress, blockNumber, reason)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package metis_simple_arbitrage
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/cryptotriv/raikiri/lib/models"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+)
+
+func anomalyTestReserves(native int64, token int64) [3]*big.Int {
+	return [3]*big.Int{anomalyTestUnits(native), anomalyTestUnits(token), big.NewInt(0)}
+}
+
+func anomalyTestUnits(amount int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(amount), big.NewInt(1e18))
+}
+
+// With the default thresholds: 50% liquidity removed, 80% price move, 60% METIS drop
+func TestReserveAnomaly(t *testing.T) {
+	s := newBotState(zap.NewNop())
+	pair := models.UniswappyV2Pair{NativeIndex: 0, TokenIndex: 1}
+	old := anomalyTestReserves(1000, 1000)
+
+	for _, test := range []struct {
+		name   string
+		native int64
+		token  int64
+		reason string
+	}{
+		{"normal buy", 1100, 910, ""},
+		{"normal sell", 910, 1100, ""},
+		{"small burn", 700, 700, ""},
+		{"burn", 400, 400, "liquidity removed"},
+		{"one-sided drain", 300, 1000, "METIS reserve dropped"},
+		{"price jump", 1400, 714, "price moved"},
+		{"token reserve emptied", 1000, 0, "liquidity removed"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			newReserves := anomalyTestReserves(test.native, test.token)
+			reason := s.reserveAnomaly(pair, old, newReserves[0], newReserves[1])
+
+			if test.reason == "" && reason != "" {
+				t.Fatalf("expected no anomaly, got %q", reason)
+			}
+			if !strings.HasPrefix(reason, test.reason) {
+				t.Fatalf("expected %q, got %q", test.reason, reason)
+			}
+		})
+	}
+}
+
+// A drain split over Syncs in one block is checked against the reserves from before the block
+func TestBlockBaseline(t *testing.T) {
+	s := newBotState(zap.NewNop())
+
+	pair := models.UniswappyV2Pair{NativeIndex: 0, TokenIndex: 1}
+	market := common.HexToAddress("0x00000000000000000000000000000000000000b1")
+
+	current := anomalyTestReserves(1000, 1000)
+	var reason string
+	for _, native := range []int64{750, 560, 420, 315} {
+		baseline := s.blockBaseline(market, 10, current)
+		newReserves := anomalyTestReserves(native, 1000)
+
+		// Each step alone is a 25% drop
+		if stepReason := s.reserveAnomaly(pair, current, newReserves[0], newReserves[1]); stepReason != "" {
+			t.Fatalf("a single step is an anomaly: %q", stepReason)
+		}
+
+		reason = s.reserveAnomaly(pair, baseline, newReserves[0], newReserves[1])
+		current = newReserves
+	}
+
+	if !strings.HasPrefix(reason, "METIS reserve dropped") {
+		t.Fatalf("expected the drain over the block to be caught, got %q", reason)
+	}
+
+	// The next block starts from what the last one left
+	baseline := s.blockBaseline(market, 11, current)
+	if baseline[0].Cmp(current[0]) != 0 {
+		t.Fatalf("next block baseline %s, want %s", baseline[0], current[0])
+	}
+}
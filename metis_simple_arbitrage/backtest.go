@@ -0,0 +1,337 @@
+package metis_simple_arbitrage
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
+	"github.com/cryptotriv/raikiri/lib/botconfig"
+	"github.com/cryptotriv/raikiri/lib/util"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+// What to replay and under which assumptions
+type BacktestParams struct {
+	// Directory with the market json files the bot writes on startup
+	SnapshotPath string
+	// Json array of Sync logs recorded after the snapshot was taken
+	LogsPath string
+	// Replays from a recorder journal instead, starting at the state of StartBlock
+	JournalPath string
+	StartBlock  uint64
+
+	// Same meaning as in the bot config
+	EventDelayMs            int
+	MinimumProfit           float64
+	BaseNativePricingAmount float64
+	MaxFollowUpDepth        int
+
+	// Same meaning as the constants, when FailureBufferMultiplier is set the min profit comes from the gas price like in the bot
+	FailureBufferMultiplier  int64
+	MinProfitFollowUpDivisor int64
+
+	// Assumed time between two Sync events of the same block, decides how many fall into one EventDelayMs window
+	EventSpacingUs int
+	// Blocks between finding an arb and it executing, 0 fills it against the exact state it was found on
+	LatencyBlocks uint64
+	// Gas price used for the cost of our txs, 0 leaves gas out
+	GasPriceGwei float64
+}
+
+type BacktestReport struct {
+	Blocks              int
+	Events              int
+	Evaluations         int
+	Opportunities       int
+	Fills               int
+	FailedFills         int
+	UnfilledAtEnd       int
+	TheoreticalProfit   *big.Int
+	RealizedProfit      *big.Int
+	GasCost             *big.Int
+	MostArbsInOneTx     int
+	FirstBlock          uint64
+	LastBlock           uint64
+	ReplayDuration      time.Duration
+	RealizedProfitRatio float64
+}
+
+// An arb we found that lands once the replay reaches its block
+type pendingFill struct {
+	arbs    []FlashSwapExecutorV1.Arb
+	atBlock uint64
+}
+
+// Starts from the bot config, so a backtest runs with live settings unless told otherwise
+func DefaultBacktestParams() BacktestParams {
+	allConfig, _, _ := botconfig.Get()
+
+	return BacktestParams{
+		SnapshotPath:             DATA_BASEPATH,
+		LogsPath:                 filepath.Join(DATA_BASEPATH, BACKTEST_LOGS_JSON_PATH),
+		EventDelayMs:             allConfig.MetisSimpleArbitrageBot.EventDelayMs,
+		MinimumProfit:            allConfig.MetisSimpleArbitrageBot.MinimumProfit,
+		BaseNativePricingAmount:  allConfig.MetisSimpleArbitrageBot.BaseNativePricingAmount,
+		MaxFollowUpDepth:         MAX_FOLLOW_UP_DEPTH,
+		MinProfitFollowUpDivisor: MIN_PROFIT_FOLLOWUP_DIVISOR,
+		EventSpacingUs:           BACKTEST_EVENT_SPACING_US,
+		LatencyBlocks:            1,
+	}
+}
+
+// Replays recorded Sync logs over a market snapshot through the same code the live loop runs
+// Needs no RPC, so the result only depends on the snapshot, the logs and the params
+func RunMetisSimpleArbitrageBacktest(_logger *zap.Logger, params BacktestParams) (BacktestReport, error) {
+	s := newBotState(_logger)
+
+	report := BacktestReport{
+		TheoreticalProfit: big.NewInt(0),
+		RealizedProfit:    big.NewInt(0),
+		GasCost:           big.NewInt(0),
+	}
+
+	// Same setup as the bot, with our params instead of the config
+	s.baseWei = util.ToWei(params.BaseNativePricingAmount, 18)
+	s.maxFollowUpDepth = params.MaxFollowUpDepth
+
+	gasPrice := util.ToWei(params.GasPriceGwei, 9)
+
+	// Params built by hand leave it at 0, which would divide by zero
+	if params.MinProfitFollowUpDivisor <= 0 {
+		params.MinProfitFollowUpDivisor = MIN_PROFIT_FOLLOWUP_DIVISOR
+	}
+
+	if params.FailureBufferMultiplier > 0 {
+		s.minProfitWei, s.minProfitWeiFollowUp = minProfitFor(gasPrice, params.FailureBufferMultiplier, params.MinProfitFollowUpDivisor)
+	} else {
+		s.minProfitWei = util.ToWei(params.MinimumProfit, 18)
+		s.minProfitWeiFollowUp = util.ToWei(params.MinimumProfit/float64(params.MinProfitFollowUpDivisor), 18)
+	}
+
+	var logs []types.Log
+
+	if params.JournalPath != "" {
+		err := s.restoreMarketStateAt(params.SnapshotPath, params.JournalPath, params.StartBlock)
+		if err != nil {
+			return report, err
+		}
+
+		logs, err = s.journalLogsAfter(params.JournalPath, params.StartBlock)
+		if err != nil {
+			return report, err
+		}
+	} else {
+		err := initContractABIs()
+		if err != nil {
+			return report, err
+		}
+
+		err = s.loadMarketSnapshot(params.SnapshotPath)
+		if err != nil {
+			return report, err
+		}
+
+		logs, err = readBacktestLogs(params.LogsPath)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	logs = s.filterBacktestLogs(logs)
+
+	eventDelay := time.Microsecond * time.Duration(params.EventDelayMs)
+	eventSpacing := time.Microsecond * time.Duration(params.EventSpacingUs)
+
+	s.priceMarkets()
+	s.markReservesAsStale()
+
+	start := time.Now()
+
+	var pending []pendingFill
+
+	for i := 0; i < len(logs); {
+		blockNumber := logs[i].BlockNumber
+
+		// Everything up to the previous block has happened, arbs due by now land at the top of this block
+		pending = s.fillDue(pending, blockNumber, gasPrice, &report)
+
+		end := i
+		for end < len(logs) && logs[end].BlockNumber == blockNumber {
+			end++
+		}
+
+		blockLogs := logs[i:end]
+		i = end
+
+		report.Blocks++
+		report.Events += len(blockLogs)
+		if report.FirstBlock == 0 {
+			report.FirstBlock = blockNumber
+		}
+		report.LastBlock = blockNumber
+
+		// Like the live loop: the first event opens a window, and every event arriving within it is processed with it
+		for k := 0; k < len(blockLogs); {
+			windowStart := k
+
+			var arbTxs []FlashSwapExecutorV1.Arb
+			for k < len(blockLogs) && (k == windowStart || eventSpacing*time.Duration(k-windowStart) < eventDelay) {
+				tokenAddr := s.updateReservesByEvent(blockLogs[k])
+				arbTxs = s.evaluateMarketsRecursive(false, tokenAddr, 0)
+				k++
+			}
+
+			report.Evaluations++
+
+			// Same threshold the live loop sends at
+			if len(arbTxs) > 1 {
+				report.Opportunities++
+				if len(arbTxs) > report.MostArbsInOneTx {
+					report.MostArbsInOneTx = len(arbTxs)
+				}
+
+				for _, arb := range arbTxs {
+					report.TheoreticalProfit.Add(report.TheoreticalProfit, arb.Profit)
+				}
+
+				if params.LatencyBlocks == 0 {
+					s.fillArbs(arbTxs, gasPrice, &report)
+				} else {
+					pending = append(pending, pendingFill{arbs: arbTxs, atBlock: blockNumber + params.LatencyBlocks})
+				}
+			}
+
+			s.markReservesAsStale()
+		}
+	}
+
+	// Whatever is still pending would land after our data ends
+	report.UnfilledAtEnd = len(pending)
+	report.ReplayDuration = time.Since(start)
+
+	if report.TheoreticalProfit.Sign() > 0 {
+		report.RealizedProfitRatio, _ = new(big.Float).Quo(new(big.Float).SetInt(report.RealizedProfit), new(big.Float).SetInt(report.TheoreticalProfit)).Float64()
+	}
+
+	s.logBacktestReport(params, report)
+
+	return report, nil
+}
+
+func readBacktestLogs(path string) ([]types.Log, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []types.Log
+	err = json.Unmarshal(data, &logs)
+	if err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
+
+// Keeps only the Sync logs of markets in our snapshot, ordered the way they happened
+func (s *botState) filterBacktestLogs(allLogs []types.Log) []types.Log {
+	var logs []types.Log
+	for _, vLog := range allLogs {
+		if vLog.Removed || len(vLog.Topics) == 0 {
+			continue
+		}
+		if vLog.Topics[0] != uniV2EventHash && vLog.Topics[0] != hermesEventHash {
+			continue
+		}
+		if _, ok := s.marketMapping[vLog.Address]; !ok {
+			continue
+		}
+		logs = append(logs, vLog)
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+
+	return logs
+}
+
+func (s *botState) fillDue(pending []pendingFill, blockNumber uint64, gasPrice *big.Int, report *BacktestReport) []pendingFill {
+	var stillPending []pendingFill
+	for _, fill := range pending {
+		if fill.atBlock <= blockNumber {
+			s.fillArbs(fill.arbs, gasPrice, report)
+		} else {
+			stillPending = append(stillPending, fill)
+		}
+	}
+	return stillPending
+}
+
+// Prices arbs against the replayed reserves as they are now
+// Our own fills don't move the replayed reserves, the recorded Sync events already say where they went
+func (s *botState) fillArbs(arbs []FlashSwapExecutorV1.Arb, gasPrice *big.Int, report *BacktestReport) {
+	reserves := make(map[common.Address][2]*big.Int)
+	for _, arb := range arbs {
+		for _, pairAddress := range []common.Address{arb.BuyFromPair, arb.SellToPair} {
+			if _, ok := reserves[pairAddress]; ok {
+				continue
+			}
+			pair := s.pairByMarketAddress(pairAddress)
+			reserves[pairAddress] = [2]*big.Int{
+				new(big.Int).Set(s.allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex]),
+				new(big.Int).Set(s.allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex]),
+			}
+		}
+	}
+
+	executedArbs, _, profit := s.priceArbsAgainstReserves(reserves, arbs)
+
+	var gasCost *big.Int
+	if len(executedArbs) == 0 {
+		report.FailedFills++
+		gasCost = new(big.Int).Mul(big.NewInt(ARB_FAILURE_GAS_COST), gasPrice)
+	} else {
+		report.Fills++
+		gasCost = new(big.Int).Mul(arbGasEstimate(executedArbs), gasPrice)
+	}
+
+	report.GasCost.Add(report.GasCost, gasCost)
+	report.RealizedProfit.Add(report.RealizedProfit, profit)
+	report.RealizedProfit.Sub(report.RealizedProfit, gasCost)
+}
+
+func (s *botState) logBacktestReport(params BacktestParams, report BacktestReport) {
+	s.logger.Info("Backtest done",
+		zap.Int("eventDelayMs", params.EventDelayMs),
+		zap.Float64("minimumProfit", params.MinimumProfit),
+		zap.Float64("baseNativePricingAmount", params.BaseNativePricingAmount),
+		zap.Int("maxFollowUpDepth", params.MaxFollowUpDepth),
+		zap.Int64("failureBufferMultiplier", params.FailureBufferMultiplier),
+		zap.Int64("minProfitFollowUpDivisor", params.MinProfitFollowUpDivisor),
+		zap.Uint64("latencyBlocks", params.LatencyBlocks),
+		zap.Uint64("firstBlock", report.FirstBlock),
+		zap.Uint64("lastBlock", report.LastBlock),
+		zap.Int("blocks", report.Blocks),
+		zap.Int("events", report.Events),
+		zap.Int("evaluations", report.Evaluations),
+		zap.Int("opportunities", report.Opportunities),
+		zap.Int("fills", report.Fills),
+		zap.Int("failedFills", report.FailedFills),
+		zap.Int("unfilledAtEnd", report.UnfilledAtEnd),
+		zap.String("theoreticalProfit", util.ToDecimal(report.TheoreticalProfit, 18).String()),
+		zap.String("realizedProfit", util.ToDecimal(report.RealizedProfit, 18).String()),
+		zap.String("gasCost", util.ToDecimal(report.GasCost, 18).String()),
+		zap.Float64("realizedProfitRatio", report.RealizedProfitRatio),
+		zap.String("duration", report.ReplayDuration.String()),
+	)
+}
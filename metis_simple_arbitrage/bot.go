@@ -2,34 +2,26 @@ package metis_simple_arbitrage
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
-	"github.com/cryptotriv/raikiri/gen/FlashUniswapQueryV1"
 	"github.com/cryptotriv/raikiri/gen/IAgoraSwapFactory"
-	"github.com/cryptotriv/raikiri/gen/IHermesBaseV1PairEvents"
 	"github.com/cryptotriv/raikiri/gen/INetSwapFactory"
-	"github.com/cryptotriv/raikiri/gen/IUniswapV2PairEvents"
-	"github.com/cryptotriv/raikiri/gen/TokenProvidenceV1"
 	"github.com/cryptotriv/raikiri/lib/botconfig"
 	"github.com/cryptotriv/raikiri/lib/deployments"
 	"github.com/cryptotriv/raikiri/lib/influxdb"
 	"github.com/cryptotriv/raikiri/lib/models"
 	"github.com/cryptotriv/raikiri/lib/telegram"
 	"github.com/cryptotriv/raikiri/lib/util"
-	"github.com/ethereum/go-ethereum/accounts/abi"
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/loov/hrtime"
 	"github.com/shopspring/decimal"
@@ -40,431 +32,568 @@ const (
 	MAX_DROP_THRESHOLD_ETH = 0.5
 )
 
+// Options for embedding the bot, anything left empty is set up from the config like the standalone bot does
+type BotOptions struct {
+	Logger *zap.Logger
+	// Loaded from the config file when nil
+	Config *models.AllBotsConfig
+	// Clients the host already has, used instead of dialing our own and left to the host to close
+	// The first read client is the primary one
+	ReadClients []*ethclient.Client
+	WriteClient *ethclient.Client
+
+	// Our contract addresses by name, the ones missing come from the deployments
+	Contracts map[string]common.Address
+
+	// Replace the contract-backed implementations, for other sources or for fakes
+	ReserveSource ReserveSource
+	PairLister    PairLister
+	HealthChecker HealthChecker
+	ArbSender     ArbSender
+}
+
+// One arbitrage bot, started with Start and stopped by cancelling its context or calling Stop
+// Each Bot owns its state, so several can run in one process side by side
+type Bot struct {
+	*botState
+
+	options BotOptions
+
+	cancel  context.CancelFunc
+	done    chan struct{}
+	closers []func()
+	logs    chan types.Log
+
+	reserveSource ReserveSource
+	arbSender     ArbSender
+	currBalance   *big.Int
+}
+
+func NewBot(options BotOptions) *Bot {
+	return &Bot{options: options}
+}
+
+// Sets everything up and starts the main loop in the background
+// Returns once setup is done, or with the error that stopped it
+func (b *Bot) Start(ctx context.Context) error {
+	ctx, b.cancel = context.WithCancel(ctx)
+	b.done = make(chan struct{})
+
+	err := b.setup(ctx)
+	if err != nil {
+		b.cancel()
+		b.shutdown()
+		return err
+	}
+
+	go b.run(ctx)
+
+	return nil
+}
+
+// Stops the main loop and waits for the cleanup to finish
+func (b *Bot) Stop() {
+	if b.cancel == nil {
+		return
+	}
+
+	b.cancel()
+	<-b.done
+}
+
+// Closed once the bot has stopped, whether it was told to or not
+func (b *Bot) Done() <-chan struct{} {
+	return b.done
+}
+
 func RunMetisSimpleArbitrageBot(_logger *zap.Logger, _mainWg *sync.WaitGroup, stop_ch chan bool) {
-	// Store arguments
-	logger = _logger
-	mainWg = _mainWg
+	defer _mainWg.Done()
+
+	bot := NewBot(BotOptions{Logger: _logger})
+
+	err := bot.Start(context.Background())
+	if err != nil {
+		_logger.Error("Error starting bot", zap.Error(err))
+		stop_ch <- true
+		return
+	}
+
+	select {
+	case <-stop_ch:
+		bot.Stop()
+	case <-bot.Done():
+	}
+
+	// Let main know we are done
+	stop_ch <- true
+}
+
+func (b *Bot) contractAddress(name string) (common.Address, error) {
+	if address, ok := b.options.Contracts[name]; ok {
+		return address, nil
+	}
+	return deployments.GetDeployedContract(b.readClient.current(), name)
+}
+
+// Connects, loads and filters the markets, and starts the background workers
+// Everything that needs closing is added to the closers, they run once the bot stops or if setup fails
+func (b *Bot) setup(ctx context.Context) error {
+	// Start clean every time, nothing is left over from an earlier run
+	logger := b.options.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	b.botState = newBotState(logger)
+	b.anomalyAlerts = true
+
+	err := initContractABIs()
+	if err != nil {
+		b.logger.Error("Error reading contract ABIs", zap.Error(err))
+		return err
+	}
 
 	// Load configs
-	allConfig, _, _ = botconfig.Get()
-	config = allConfig.MetisSimpleArbitrageBot
+	if b.options.Config != nil {
+		b.allConfig = *b.options.Config
+	} else {
+		b.allConfig, _, _ = botconfig.Get()
+	}
+	b.config = b.allConfig.MetisSimpleArbitrageBot
 
-	DEBUG = allConfig.DebugModeAll || config.DebugMode
-	bannedTokenAddresses = config.BannedTokens
-	PRIVATE_KEY_EXECUTOR = config.UseAccount
+	b.debug = b.allConfig.DebugModeAll || b.config.DebugMode
+	b.bannedTokenAddresses = b.config.BannedTokens
+	b.privateKeyExecutor = b.config.UseAccount
 
 	// Build our context
-	botContext = models.BotContext{
-		Node: allConfig.NodeName,
-		Main: allConfig.MainName,
+	b.botContext = models.BotContext{
+		Node: b.allConfig.NodeName,
+		Main: b.allConfig.MainName,
 		Bot:  BOT_NAME,
 	}
 
-	logger.Info("Starting bot",
+	// Paper trading shows up as its own bot in logs and metrics
+	if b.config.PaperTrading {
+		b.botContext.Bot = BOT_NAME + PAPER_BOT_SUFFIX
+		b.logger = b.logger.With(zap.Bool("paper", true))
+	}
+
+	b.logger.Info("Starting bot",
 		zap.String("bot", BOT_NAME),
-		zap.String("node", botContext.Node),
-		zap.String("main", botContext.Main),
+		zap.String("node", b.botContext.Node),
+		zap.String("main", b.botContext.Main),
 	)
 
 	// Init constants
-	BASE_WEI = util.ToWei(config.BaseNativePricingAmount, 18)
-	MIN_NATIVE_AMOUNT_WEI = util.ToWei(config.MinumumNativeAmount, 18)
-	MIN_PROFIT_WEI = util.ToWei(config.MinimumProfit, 18)
-	MIN_PROFIT_WEI_FOLLOWUP = util.ToWei(config.MinimumProfit/MIN_PROFIT_FOLLOWUP_DIVISOR, 18)
-	STALE_RESERVE = big.NewInt(0)
-	UPDATED_RESERVE = big.NewInt(1)
+	b.baseWei = util.ToWei(b.config.BaseNativePricingAmount, 18)
+	b.minNativeAmountWei = util.ToWei(b.config.MinumumNativeAmount, 18)
+	b.minProfitWei = util.ToWei(b.config.MinimumProfit, 18)
+	b.minProfitWeiFollowUp = util.ToWei(b.config.MinimumProfit/MIN_PROFIT_FOLLOWUP_DIVISOR, 18)
 
 	// Send init message
-	if DEBUG {
-		logger.Info("DEBUG MODE ON")
+	if b.debug {
+		b.logger.Info("DEBUG MODE ON")
 	}
 
-	str, err := json.Marshal(config)
+	str, err := json.Marshal(b.config)
 	if err != nil {
-		logger.Error("Error marshalling config", zap.Error(err))
-		exit = true
+		b.logger.Error("Error marshalling config", zap.Error(err))
+		return err
 	}
 
-	logger.Info("Setting up...", zap.String("version", BOT_VERSION), zap.String("config", string(str)))
+	b.logger.Info("Setting up...", zap.String("version", BOT_VERSION), zap.String("config", string(str)))
 
-	if config.WriteOnlyNetworkIndex < 0 {
-		RPC_URL := config.AvailableNetworks[config.ReadAndWriteNetworkIndex]
-		rpc_url := os.Getenv(RPC_URL)
+	if len(b.options.ReadClients) > 0 {
+		// Clients from the host are theirs to close
+		var readNames []string
+		for i := range b.options.ReadClients {
+			readNames = append(readNames, fmt.Sprintf("client-%d", i))
+		}
 
-		// Connect to client
-		var err error
-		readClient, err = ethclient.Dial(rpc_url)
+		b.readClient, err = newReadPoolFromClients(readNames, b.options.ReadClients, b.logger)
 		if err != nil {
-			logger.Error("Error connecting to client", zap.Error(err))
-			exit = true
+			b.logger.Error("Error setting up read clients", zap.Error(err))
+			return err
 		}
-		defer readClient.Close()
-
-		// These two are same
-		writeClient = readClient
 	} else {
-		READ_RPC_URL := config.AvailableNetworks[config.ReadAndWriteNetworkIndex]
-		WRITE_RPC_URL := config.AvailableNetworks[config.WriteOnlyNetworkIndex]
-
-		read_rpc_url := os.Getenv(READ_RPC_URL)
-		write_rpc_url := os.Getenv(WRITE_RPC_URL)
+		// Connect to read clients, the primary network first and the fallbacks after it
+		readNetworks := []string{b.config.AvailableNetworks[b.config.ReadAndWriteNetworkIndex]}
+		for _, networkIndex := range b.config.ReadNetworkIndexes {
+			readNetworks = append(readNetworks, b.config.AvailableNetworks[networkIndex])
+		}
 
-		// Connect to clients
-		var err error
-		readClient, err = ethclient.Dial(read_rpc_url)
+		b.readClient, err = newReadPool(readNetworks, b.logger)
 		if err != nil {
-			logger.Error("Error connecting to client", zap.Error(err))
-			exit = true
+			b.logger.Error("Error connecting to client", zap.Error(err))
+			return err
 		}
-		defer readClient.Close()
+		b.closers = append(b.closers, b.readClient.Close)
+	}
+
+	go b.readClient.run(ctx)
 
+	if b.options.WriteClient != nil {
+		b.writeClient = b.options.WriteClient
+	} else if b.config.WriteOnlyNetworkIndex < 0 {
 		// These two are same
-		writeClient, err = ethclient.Dial(write_rpc_url)
+		b.writeClient = b.readClient.primary()
+	} else {
+		WRITE_RPC_URL := b.config.AvailableNetworks[b.config.WriteOnlyNetworkIndex]
+		write_rpc_url := os.Getenv(WRITE_RPC_URL)
+
+		// Connect to write client
+		b.writeClient, err = ethclient.Dial(write_rpc_url)
 		if err != nil {
-			logger.Error("Error connecting to client", zap.Error(err))
-			exit = true
+			b.logger.Error("Error connecting to client", zap.Error(err))
+			return err
 		}
-		defer writeClient.Close()
+		b.closers = append(b.closers, b.writeClient.Close)
 	}
 
+	// Extra endpoints we send our txs to on top of the write client
+	var broadcastNetworks []string
+	for _, networkIndex := range b.config.BroadcastNetworkIndexes {
+		broadcastNetworks = append(broadcastNetworks, b.config.AvailableNetworks[networkIndex])
+	}
+
+	b.broadcast, err = b.newBroadcaster(broadcastNetworks)
+	if err != nil {
+		b.logger.Error("Error connecting to broadcast endpoints", zap.Error(err))
+		return err
+	}
+	b.closers = append(b.closers, b.broadcast.close)
+	b.readClient.broadcast = b.broadcast
+
+	b.tracker = b.newTxTracker()
+
 	// Get DEX data
 	// Get dynamic fees
-	agoraSwapFactory, err := IAgoraSwapFactory.NewIAgoraSwapFactory(common.HexToAddress(AGORASWAP_FACTORY_ADDRESS), readClient)
+	agoraSwapFactory, err := IAgoraSwapFactory.NewIAgoraSwapFactory(common.HexToAddress(AGORASWAP_FACTORY_ADDRESS), b.readClient)
 	if err != nil {
-		logger.Error("Error getting AgoraSwap factory", zap.Error(err))
-		exit = true
+		b.logger.Error("Error getting AgoraSwap factory", zap.Error(err))
+		return err
 	}
-	netSwapFactory, err := INetSwapFactory.NewINetSwapFactory(common.HexToAddress(NETSWAP_FACTORY_ADDRESS), readClient)
+	netSwapFactory, err := INetSwapFactory.NewINetSwapFactory(common.HexToAddress(NETSWAP_FACTORY_ADDRESS), b.readClient)
 	if err != nil {
-		logger.Error("Error getting NetSwap factory", zap.Error(err))
-		exit = true
+		b.logger.Error("Error getting NetSwap factory", zap.Error(err))
+		return err
 	}
 
 	agoraSwapFee, err := agoraSwapFactory.Fee(nil)
 	if err != nil {
-		logger.Error("Error getting AgoraSwap fee", zap.Error(err))
-		exit = true
+		b.logger.Error("Error getting AgoraSwap fee", zap.Error(err))
+		return err
 	}
 
 	netSwapFee, err := netSwapFactory.FeeRate(nil)
 	if err != nil {
-		logger.Error("Error getting NetSwap fee", zap.Error(err))
-		exit = true
+		b.logger.Error("Error getting NetSwap fee", zap.Error(err))
+		return err
 	}
 
 	agoraSwapFee.Mul(agoraSwapFee, big.NewInt(10))
 	netSwapFee.Mul(netSwapFee, big.NewInt(10))
 
-	logger.Info("Pulled DEX fees in FeePerTenThousands",
+	b.logger.Info("Pulled DEX fees in FeePerTenThousands",
 		zap.String("agoraSwap", agoraSwapFee.String()),
 		zap.String("netSwap", netSwapFee.String()),
 	)
 
-	uniswapV2FactoryAddressFeePerTenThousands[AGORASWAP_FACTORY_ADDRESS] = agoraSwapFee.Int64()
-	uniswapV2FactoryAddressFeePerTenThousands[NETSWAP_FACTORY_ADDRESS] = netSwapFee.Int64()
+	b.feePerTenThousands[AGORASWAP_FACTORY_ADDRESS] = agoraSwapFee.Int64()
+	b.feePerTenThousands[NETSWAP_FACTORY_ADDRESS] = netSwapFee.Int64()
 
 	// Get our contract deployments
-	flashQueryAddress, err := deployments.GetDeployedContract(readClient, "FlashUniswapQueryV1")
-	if err != nil {
-		logger.Error("Error getting FlashUniswapQueryV1 address", zap.Error(err))
-		exit = true
-	}
-
-	executorContractAddress, err := deployments.GetDeployedContract(readClient, "FlashSwapExecutorV1")
+	executorContractAddress, err := b.contractAddress("FlashSwapExecutorV1")
 	if err != nil {
-		logger.Error("Error getting FlashSwapExecutorV1 address", zap.Error(err))
-		exit = true
+		b.logger.Error("Error getting FlashSwapExecutorV1 address", zap.Error(err))
+		return err
 	}
 
-	tokenProvidenceAddress, err := deployments.GetDeployedContract(readClient, "TokenProvidenceV1")
+	tokenProvidenceAddress, err := b.contractAddress("TokenProvidenceV1")
 	if err != nil {
-		logger.Error("Error getting TokenProvidenceV1 address", zap.Error(err))
-		exit = true
+		b.logger.Error("Error getting TokenProvidenceV1 address", zap.Error(err))
+		return err
 	}
 
-	logger.Info("Contracts loaded",
-		zap.String("flashUniswapQueryV1", flashQueryAddress.Hex()),
+	b.logger.Info("Contracts loaded",
 		zap.String("flashSwapExecutorV1", executorContractAddress.Hex()),
 		zap.String("tokenProvidenceV1", tokenProvidenceAddress.Hex()),
 	)
 
-	// Get contract bindings
-	flashQueryInstance, err := FlashUniswapQueryV1.NewFlashUniswapQueryV1(flashQueryAddress, readClient)
+	// Get contract bindings, the ones from the options replace them
+	source, err := newChainSource(b.config.ReserveSource, b.readClient, b.contractAddress)
 	if err != nil {
-		logger.Error("Error getting FlashUniswapQueryV1 instance", zap.Error(err))
-		exit = true
+		b.logger.Error("Error getting reserve source", zap.String("reserveSource", b.config.ReserveSource), zap.Error(err))
+		return err
 	}
 
-	executorContract, err := FlashSwapExecutorV1.NewFlashSwapExecutorV1(executorContractAddress, readClient)
-	if err != nil {
-		logger.Error("Error getting FlashSwapExecutorV1 instance", zap.Error(err))
-		exit = true
-	}
-
-	tokenProvidenceContract, err := TokenProvidenceV1.NewTokenProvidenceV1(tokenProvidenceAddress, readClient)
-	if err != nil {
-		logger.Error("Error getting TokenProvidenceV1 instance", zap.Error(err))
-		exit = true
+	var reserveSource ReserveSource = source
+	if b.options.ReserveSource != nil {
+		reserveSource = b.options.ReserveSource
 	}
 
-	// Let's setup our executor account here
-	privateKey, err := crypto.HexToECDSA(os.Getenv(PRIVATE_KEY_EXECUTOR))
-	if err != nil {
-		logger.Error("Error in HexToECDSA for private key", zap.Error(err))
-		exit = true
+	var pairLister PairLister = source
+	if b.options.PairLister != nil {
+		pairLister = b.options.PairLister
 	}
 
-	publicKey := privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		logger.Error("cannot assert type: publicKey is not of type *ecdsa.PublicKey")
-		exit = true
+	var arbSender ArbSender = b.options.ArbSender
+	if arbSender == nil {
+		arbSender, err = newExecutorArbSender(executorContractAddress, b.readClient, b.broadcast)
+		if err != nil {
+			b.logger.Error("Error getting FlashSwapExecutorV1 instance", zap.Error(err))
+			return err
+		}
 	}
 
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-
-	chainId, err := readClient.ChainID(context.Background())
+	chainId, err := b.readClient.ChainID(context.Background())
 	if err != nil {
-		logger.Error("Error getting chainId", zap.Error(err))
-		exit = true
+		b.logger.Error("Error getting chainId", zap.Error(err))
+		return err
 	}
 
-	nonce, err = readClient.PendingNonceAt(context.Background(), fromAddress)
+	// Get initial gas price
+	b.minGasGwei, err = b.readClient.SuggestGasPrice(context.Background())
 	if err != nil {
-		logger.Error("Error getting nonce", zap.Error(err))
-		exit = true
+		b.logger.Error("Error getting gas price", zap.Error(err))
+		return err
 	}
 
-	balance, err := readClient.BalanceAt(context.Background(), fromAddress, nil)
+	b.calculateMinProfit()
+
+	// Setup how we price gas
+	b.gasPricing, err = newGasStrategy(b.config.GasStrategy, b.readClient)
 	if err != nil {
-		logger.Error("Error getting balance", zap.Error(err))
-		exit = true
+		b.logger.Error("Error setting up gas strategy", zap.Error(err))
+		return err
 	}
 
-	currBalance := balance
-
-	// Get initial gas price
-	MIN_GAS_GWEI, err = readClient.SuggestGasPrice(context.Background())
+	err = b.gasPricing.update(context.Background())
 	if err != nil {
-		logger.Error("Error getting gas price", zap.Error(err))
-		exit = true
+		b.logger.Error("Error updating gas pricing", zap.Error(err))
+		return err
 	}
 
-	calculateMinProfit()
-
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainId)
+	// Let's setup our executor accounts here
+	b.executors, err = b.newAccountPool(b.executorAccountEnvs(), chainId, b.config.AccountSelection)
 	if err != nil {
-		logger.Error("Error generating auth", zap.Error(err))
-		exit = true
+		b.logger.Error("Error setting up executor accounts", zap.Error(err))
+		return err
 	}
 
-	auth.Value = big.NewInt(0)      // in wei
-	auth.GasLimit = uint64(3000000) // in units
-	auth.GasPrice = big.NewInt(0).Add(MIN_GAS_GWEI, util.ToWei(MIN_GAS_GWEI_BUFFER, 9))
-	auth.NoSend = false
+	b.currBalance = b.executors.totalBalance()
+	fromAddress := b.executors.primary().address
 
-	logger.Info("Minimum gas price: ", zap.String("gasPrice", util.ToDecimal(MIN_GAS_GWEI, 9).String()))
-
-	// Setup transaction
-	auth.Nonce = big.NewInt(int64(nonce))
-
-	if !DEBUG {
-		// Initialize all markets
-		initAllMarketData(flashQueryInstance)
-		updateReservesBatched(flashQueryInstance)
-		filterMarkets(
-			flashQueryInstance,
-			tokenProvidenceContract,
-			privateKey,
+	var healthChecker HealthChecker = b.options.HealthChecker
+	if healthChecker == nil {
+		healthChecker, err = newTokenProvidenceChecker(
+			tokenProvidenceAddress,
+			b.executors.primary().privateKey,
 			chainId,
-			nonce,
-			MIN_GAS_GWEI,
+			b.executors.primary().nonces.peek(),
 			fromAddress,
-			tokenProvidenceAddress,
-			readClient)
-		sortMartkets()
-		mapMarketAddresses()
-	} else {
-		// DEBUG: Load test data from our json file
-		marketPairsString, err := os.ReadFile(filepath.Join(DATA_BASEPATH, MARKET_PAIRS_BY_TOKEN_JSON_PATH))
-		if err != nil {
-			logger.Error("Error reading file", zap.Error(err))
-			exit = true
-		}
-
-		err = json.Unmarshal(marketPairsString, &marketPairsByToken)
+			b.readClient,
+			b.gasPricing)
 		if err != nil {
-			logger.Error("Error unmarshalling file", zap.Error(err))
-			exit = true
+			b.logger.Error("Error getting TokenProvidenceV1 instance", zap.Error(err))
+			return err
 		}
+	}
 
-		allMarketAddressesString, err := os.ReadFile(filepath.Join(DATA_BASEPATH, ALL_MARKET_ADDRESSES_JSON_PATH))
-		if err != nil {
-			logger.Error("Error reading file", zap.Error(err))
-			exit = true
-		}
+	b.logger.Info("Minimum gas price: ", zap.String("gasPrice", util.ToDecimal(b.minGasGwei, 9).String()))
 
-		err = json.Unmarshal(allMarketAddressesString, &allMarketAddresses)
+	if !b.debug {
+		// Initialize all markets
+		verifier, err := newPairVerifier(b.readClient)
 		if err != nil {
-			logger.Error("Error unmarshalling file", zap.Error(err))
-			exit = true
+			b.logger.Error("Error getting pair verifier", zap.Error(err))
+			return err
 		}
 
-		allMarketReservesString, err := os.ReadFile(filepath.Join(DATA_BASEPATH, ALL_MARKET_RESERVES_JSON_PATH))
+		err = b.initAllMarketData(pairLister, verifier)
 		if err != nil {
-			logger.Error("Error reading file", zap.Error(err))
-			exit = true
-		}
-		err = json.Unmarshal(allMarketReservesString, &allMarketReserves)
-		if err != nil {
-			logger.Error("Error unmarshalling file", zap.Error(err))
-			exit = true
+			b.logger.Error("Error querying for pairs", zap.Error(err))
+			return err
 		}
 
-		allMarketAddressFactoriestring, err := os.ReadFile(filepath.Join(DATA_BASEPATH, ALL_MARKET_ADDRESS_FACTORIES_JSON_PATH))
-		if err != nil {
-			logger.Error("Error reading file", zap.Error(err))
-			exit = true
-		}
-		err = json.Unmarshal(allMarketAddressFactoriestring, &allMarketAddressFactories)
+		err = b.updateReservesBatched(reserveSource)
 		if err != nil {
-			logger.Error("Error unmarshalling file", zap.Error(err))
-			exit = true
+			b.logger.Error("Error querying for batched reserves", zap.Error(err))
+			return err
 		}
 
-		marketMappingString, err := os.ReadFile(filepath.Join(DATA_BASEPATH, MARKET_MAPPING_JSON_PATH))
-		if err != nil {
-			logger.Error("Error reading file", zap.Error(err))
-			exit = true
-		}
-		err = json.Unmarshal(marketMappingString, &marketMapping)
+		b.filterMarkets(reserveSource, healthChecker)
+		b.sortMartkets()
+		b.mapMarketAddresses()
+	} else {
+		// DEBUG: Load test data from our json file
+		err = b.loadMarketSnapshot(DATA_BASEPATH)
 		if err != nil {
-			logger.Error("Error unmarshalling file", zap.Error(err))
-			exit = true
+			b.logger.Error("Error loading market snapshot", zap.Error(err))
+			return err
 		}
 	}
 
-	logger.Info("Pulled all pairs", zap.Int("totalPairs", len(allMarketAddresses)))
+	b.logger.Info("Pulled all pairs", zap.Int("totalPairs", len(b.allMarketAddresses)))
 
 	// Form query
 	// query := ethereum.FilterQuery{
 	// 	Addresses: allMarketAddresses,
 	// }
 
-	// Get contracts
-	uniswapV2ABI, err = abi.JSON(strings.NewReader(string(IUniswapV2PairEvents.IUniswapV2PairEventsABI)))
-	if err != nil {
-		logger.Error("Error reading uniswapV2ABI", zap.Error(err))
-		exit = true
-	}
-
-	hermesV1ABI, err = abi.JSON(strings.NewReader(string(IHermesBaseV1PairEvents.IHermesBaseV1PairEventsABI)))
-	if err != nil {
-		logger.Error("Error reading hermesV1ABI", zap.Error(err))
-		exit = true
-	}
+	b.logs = make(chan types.Log, 200)
 
-	logs := make(chan types.Log, 200)
-
-	// sub, err := writeClient.SubscribeFilterLogs(context.Background(), query, logs)
+	// sub, err := writeClient.SubscribeFilterLogs(context.Background(), query, b.logs)
 	// if err != nil {
 	// 	logger.Error("Error subscribing logs", zap.Error(err))
-	// 	exit = true
+	// 	return err
 	// }
 
-	uniV2EventSignature := []byte("Sync(uint112,uint112)") //
-	uniV2EventHash = crypto.Keccak256Hash(uniV2EventSignature)
-
-	hermesEventSignature := []byte("Sync(uint256,uint256)") //
-	hermesEventHash = crypto.Keccak256Hash(hermesEventSignature)
-
 	//swapEventHash := common.HexToHash("0xd78ad95fa46c994b6551d0da85fc275fe613ce37657fb8d5e3d130840159d822")
 	//feesEventHash := common.HexToHash("0x112c256902bf554b6ed882d2936687aaeb4225e8cd5b51303c90ca6cf43a8602")
 
+	// Journal everything we see and decide, for replaying it later
+	if b.config.RecordJournal {
+		b.journal, err = newRecorder(filepath.Join(DATA_BASEPATH, RECORDER_JOURNAL_DIR), b.logger)
+		if err != nil {
+			b.logger.Error("Error starting recorder", zap.Error(err))
+			return err
+		}
+		b.closers = append(b.closers, b.journal.close)
+	}
+
 	// Update reserves to latest (just so that we don't miss any events)
 	time.Sleep(time.Millisecond * 500)
-	updateReserves(flashQueryInstance)
-	priceMarkets()
+	b.updateReserves(reserveSource)
+	b.priceMarkets()
+
+	// Load the state our executor touches so we can simulate arbs in-process
+	if b.config.SimulateTxsLocally {
+		b.localEVM, err = b.initLocalEVM(b.readClient, tokenProvidenceAddress, executorContractAddress, b.executors.addresses())
+		if err != nil {
+			b.logger.Error("Error loading local EVM, falling back to RPC simulation", zap.Error(err))
+			b.localEVM = nil
+		}
+	}
+
+	// Hold spot prices against a short TWAP, the first sample starts the history
+	switch b.config.TwapGuardMode {
+	case "":
+	case TWAP_GUARD_SKIP, TWAP_GUARD_CAP:
+		b.twap, err = b.newTwapTracker()
+		if err != nil {
+			b.logger.Error("Error starting TWAP tracker", zap.Error(err))
+			return err
+		}
+		b.twap.sample(b.twapPairs())
+	default:
+		err = errors.New("unknown TWAP guard mode: " + b.config.TwapGuardMode)
+		b.logger.Error("Error starting TWAP tracker", zap.Error(err))
+		return err
+	}
 
 	// Store in json the whole map so we can play around with it during testing later
 	err = os.MkdirAll(DATA_BASEPATH, os.ModePerm)
 	if err != nil {
-		logger.Error("Error creating directory", zap.Error(err))
-		exit = true
+		b.logger.Error("Error creating directory", zap.Error(err))
+		return err
 	}
 
-	marketPairsByTokenJson, err := json.Marshal(marketPairsByToken)
+	marketPairsByTokenJson, err := json.Marshal(b.marketPairsByToken)
 	if err != nil {
-		logger.Error("Error marshalling data", zap.Error(err))
-		exit = true
+		b.logger.Error("Error marshalling data", zap.Error(err))
+		return err
 	}
 
 	err = os.WriteFile(filepath.Join(DATA_BASEPATH, MARKET_PAIRS_BY_TOKEN_JSON_PATH), marketPairsByTokenJson, 0644)
 	if err != nil {
-		logger.Error("Error writing data", zap.Error(err))
-		exit = true
+		b.logger.Error("Error writing data", zap.Error(err))
+		return err
 	}
 
-	allMarketAddressesJson, err := json.Marshal(allMarketAddresses)
+	allMarketAddressesJson, err := json.Marshal(b.allMarketAddresses)
 	if err != nil {
-		logger.Error("Error marshalling data", zap.Error(err))
-		exit = true
+		b.logger.Error("Error marshalling data", zap.Error(err))
+		return err
 	}
 
 	err = os.WriteFile(filepath.Join(DATA_BASEPATH, ALL_MARKET_ADDRESSES_JSON_PATH), allMarketAddressesJson, 0644)
 	if err != nil {
-		logger.Error("Error writing data", zap.Error(err))
-		exit = true
+		b.logger.Error("Error writing data", zap.Error(err))
+		return err
 	}
 
-	allMarketReservesJson, err := json.Marshal(allMarketReserves)
+	allMarketReservesJson, err := json.Marshal(b.allMarketReserves)
 	if err != nil {
-		logger.Error("Error marshalling data", zap.Error(err))
-		exit = true
+		b.logger.Error("Error marshalling data", zap.Error(err))
+		return err
 	}
 
 	err = os.WriteFile(filepath.Join(DATA_BASEPATH, ALL_MARKET_RESERVES_JSON_PATH), allMarketReservesJson, 0644)
 	if err != nil {
-		logger.Error("Error writing data", zap.Error(err))
-		exit = true
+		b.logger.Error("Error writing data", zap.Error(err))
+		return err
 	}
 
-	allMarketAddressFactoriesJson, err := json.Marshal(allMarketAddressFactories)
+	allMarketAddressFactoriesJson, err := json.Marshal(b.allMarketAddressFactories)
 	if err != nil {
-		logger.Error("Error marshalling data", zap.Error(err))
-		exit = true
+		b.logger.Error("Error marshalling data", zap.Error(err))
+		return err
 	}
 
 	err = os.WriteFile(filepath.Join(DATA_BASEPATH, ALL_MARKET_ADDRESS_FACTORIES_JSON_PATH), allMarketAddressFactoriesJson, 0644)
 	if err != nil {
-		logger.Error("Error writing data", zap.Error(err))
-		exit = true
+		b.logger.Error("Error writing data", zap.Error(err))
+		return err
 	}
 
-	marketMappingJson, err := json.Marshal(marketMapping)
+	marketMappingJson, err := json.Marshal(b.marketMapping)
 	if err != nil {
-		logger.Error("Error marshalling data", zap.Error(err))
-		exit = true
+		b.logger.Error("Error marshalling data", zap.Error(err))
+		return err
 	}
 
 	err = os.WriteFile(filepath.Join(DATA_BASEPATH, MARKET_MAPPING_JSON_PATH), marketMappingJson, 0644)
 	if err != nil {
-		logger.Error("Error writing data", zap.Error(err))
-		exit = true
+		b.logger.Error("Error writing data", zap.Error(err))
+		return err
+	}
+
+	b.markReservesAsStale()
+
+	// Start the bidding engine for contested arbs
+	if b.config.EnablePGA {
+		b.pga = b.newPGAEngine(arbSender)
+		go b.pga.run(ctx)
 	}
 
-	markReservesAsStale()
+	b.reserveSource = reserveSource
+	b.arbSender = arbSender
+
+	return nil
+}
+
+// The main loop, until the context is cancelled
+func (b *Bot) run(ctx context.Context) {
+	defer b.shutdown()
 
 	// Setup done
-	logger.Info("Setup complete - listening to new events...")
+	b.logger.Info("Setup complete - listening to new events...")
+
+	reserveSource := b.reserveSource
+	arbSender := b.arbSender
+	currBalance := b.currBalance
+	logs := b.logs
 
 	totalOpportunities := 0
 	mostOpporunitiesInBlock := 0
 	var start time.Duration
 
 	ticker5m := time.NewTicker(5 * time.Minute)
+	defer ticker5m.Stop()
 	ticker1m := time.NewTicker(1 * time.Minute)
+	defer ticker1m.Stop()
 	ticker1s := time.NewTicker(1 * time.Second)
+	defer ticker1s.Stop()
 
 	previousBlock := uint64(0)
 	prematureCalcs := 0
@@ -474,17 +603,12 @@ func RunMetisSimpleArbitrageBot(_logger *zap.Logger, _mainWg *sync.WaitGroup, st
 
 	// Main loop
 	for {
-		// Exit if triggered
-		if exit {
-			stop_ch <- true
-			break
-		}
-
 		// Check for stop signal
 		select {
-		case <-stop_ch:
-			logger.Info("Stop signal received")
-			exit = true
+		case <-ctx.Done():
+			b.logger.Info("Stop signal received")
+			b.currBalance = currBalance
+			return
 		// case err := <-sub.Err():
 		// 	if err != nil {
 		// 		logger.Error("Error in subscription", zap.Error(err))
@@ -492,50 +616,51 @@ func RunMetisSimpleArbitrageBot(_logger *zap.Logger, _mainWg *sync.WaitGroup, st
 		// 		if err != nil {
 		// 			logger.Error("Error updating to telegram", zap.Error(err))
 		// 		}
-		// 		exit = true
+		// 		b.cancel()
 		// 	}
 		case <-ticker1m.C:
-			// Update our nonce
-			nonce, err = readClient.PendingNonceAt(context.Background(), fromAddress)
-			if err != nil {
-				logger.Error("Error getting nonce", zap.Error(err))
-				exit = true
-			}
+			// Reconcile our nonces with the chain
+			b.executors.syncNonces()
 
-			auth.Nonce = big.NewInt(int64(nonce))
-
-			logger.Info("Synced nonces to: ", zap.Int64("nonce", int64(nonce)))
+			if b.twap != nil {
+				b.twap.sampleInBackground()
+			}
 		case <-ticker5m.C:
-			// Update our balance
-			currBalance, err = readClient.BalanceAt(context.Background(), fromAddress, nil)
+			// Update our balances, pausing accounts that are running low
+			err := b.executors.refreshBalances()
 			if err != nil {
-				logger.Error("Error getting balance", zap.Error(err))
-				exit = true
+				b.logger.Error("Error getting balance", zap.Error(err))
 				continue
 			}
 
+			currBalance = b.executors.totalBalance()
+
 			// Update our gas price
-			MIN_GAS_GWEI, err = readClient.SuggestGasPrice(context.Background())
+			gasPrice, err := b.readClient.SuggestGasPrice(context.Background())
 			if err != nil {
-				logger.Error("Error getting gas price", zap.Error(err))
-				exit = true
+				b.logger.Error("Error getting gas price", zap.Error(err))
+			} else {
+				b.minGasGwei = gasPrice
 			}
 
-			calculateMinProfit()
+			b.calculateMinProfit()
 
-			auth.GasPrice = big.NewInt(0).Add(MIN_GAS_GWEI, util.ToWei(MIN_GAS_GWEI_BUFFER, 9))
+			b.updateGasPricing()
+			b.executors.applyGasPrices()
+
+			b.broadcast.logStats()
 
 			// Update influxDB
 			go func(currBalance *big.Int) {
-				err := telegram.Update(botContext, fmt.Sprint("Balance: ", util.ToDecimal(currBalance, 18).String()))
+				err := telegram.Update(b.botContext, fmt.Sprint("Balance: ", util.ToDecimal(currBalance, 18).String()))
 				if err != nil {
-					logger.Error("Error updating to telegram", zap.Error(err))
+					b.logger.Error("Error updating to telegram", zap.Error(err))
 				}
 
 				ethBalanceFloat, _ := util.ToDecimal(currBalance, 18).Float64()
 
 				// Write to influxDb
-				influxdb.WriteMEVBalance(botContext, ethBalanceFloat, 0.0, 0.0)
+				influxdb.WriteMEVBalance(b.botContext, ethBalanceFloat, 0.0, 0.0)
 
 				// Flush
 				influxdb.Flush()
@@ -550,56 +675,60 @@ func RunMetisSimpleArbitrageBot(_logger *zap.Logger, _mainWg *sync.WaitGroup, st
 			// Check if we had a big drop
 			if highestBalance.Sub(currBalDecimals).Cmp(decimal.NewFromFloat(MAX_DROP_THRESHOLD_ETH)) > 0 {
 				// Notify rika
-				telegram.Notify(botContext, fmt.Sprint("Large balance drop detected - please check status. Sleeping..."))
+				telegram.Notify(b.botContext, fmt.Sprint("Large balance drop detected - please check status. Sleeping..."))
 
-				// Sleep for a long time
-				time.Sleep(time.Hour * 24)
+				// Sleep for a long time, unless we get stopped
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Hour * 24):
+				}
 			}
 
 		case <-ticker1s.C:
-			updateReserves(flashQueryInstance)
+			b.updateReserves(reserveSource)
 
 			// Start time
 			start = hrtime.Now()
 
-			arbTxs := evaluateMarketsRecursiveAll(false, 0) // evaluateMarkets()
+			arbTxs := b.evaluateMarketsRecursiveAll(false, 0) // evaluateMarkets()
+			b.journal.recordArbs(b.readClient.head(), nil, arbTxs)
 
 			processingDone := hrtime.Since(start)
 
-			logger.Info("Polling and Processing Done", zap.String("duration", processingDone.String()))
+			b.logger.Info("Polling and Processing Done", zap.String("duration", processingDone.String()))
 
 			if len(arbTxs) <= 1 {
-				logger.Debug("No Arbs in Processed Event Block No", zap.Uint64("blockNumber", previousBlock))
-				logger.Debug("Total Time", zap.String("duration", hrtime.Since(start).String()))
+				b.logger.Debug("No Arbs in Processed Event Block No", zap.Uint64("blockNumber", previousBlock))
+				b.logger.Debug("Total Time", zap.String("duration", hrtime.Since(start).String()))
 			} else {
-				// Actually take the opportunity
-				go takeOpportunities(
-					executorContract,
-					executorContractAddress,
-					fromAddress,
-					auth,
-					readClient,
-					arbTxs)
-
-				logger.Debug("Arbs in Processed Event Block No: ", zap.Uint64("blockNumber", previousBlock))
-
-				// Optimisation: Let's do all non-critical stuff here
-				// Update our nonce
-				nonce++
-
-				auth, err = bind.NewKeyedTransactorWithChainID(privateKey, chainId)
-				if err != nil {
-					logger.Error("Error generating auth", zap.Error(err))
-					exit = true
+				// Pick the account to send from
+				account := b.executors.acquire()
+				if account != nil {
+					auth := b.executors.takeAuth(account)
+
+					// Price gas for these arbs and reserve a nonce for this tx
+					b.applyGasPrices(auth, arbTxs)
+					auth.Nonce = new(big.Int).SetUint64(account.nonces.reserve())
+
+					// Actually take the opportunity
+					go b.takeOpportunities(
+						arbSender,
+						account,
+						auth,
+						b.readClient,
+						arbTxs)
+
+					// Optimisation: Let's do all non-critical stuff here
+					err := b.executors.renewAuth(account)
+					if err != nil {
+						b.logger.Error("Error generating auth", zap.Error(err))
+						b.cancel()
+					}
+				} else {
+					b.logger.Info("All executor accounts are paused, skipping arb")
 				}
 
-				auth.Value = big.NewInt(0)      // in wei
-				auth.GasLimit = uint64(3000000) // in units
-				auth.GasPrice = big.NewInt(0).Add(MIN_GAS_GWEI, util.ToWei(MIN_GAS_GWEI_BUFFER, 9))
-				auth.NoSend = false
-
-				// Setup transaction
-				auth.Nonce = big.NewInt(int64(nonce))
+				b.logger.Debug("Arbs in Processed Event Block No: ", zap.Uint64("blockNumber", previousBlock))
 
 				// Track total opportunities
 				totalOpportunities++
@@ -610,10 +739,10 @@ func RunMetisSimpleArbitrageBot(_logger *zap.Logger, _mainWg *sync.WaitGroup, st
 				}
 
 				// Log the opportunities
-				logger.Info("There were opportunities for profit in processed block", zap.Uint64("blockNumber", previousBlock))
+				b.logger.Info("There were opportunities for profit in processed block", zap.Uint64("blockNumber", previousBlock))
 
 				for count, crossedMarket := range arbTxs {
-					logger.Info(fmt.Sprintf("Opportunity %d", count),
+					b.logger.Info(fmt.Sprintf("Opportunity %d", count),
 						zap.String("size", util.ToDecimal(crossedMarket.NativeInAmount, 18).String()),
 						zap.String("tokenOut", util.ToDecimal(crossedMarket.NativeOutAmount, 18).String()),
 						zap.String("profit", util.ToDecimal(crossedMarket.Profit, 18).String()),
@@ -631,29 +760,25 @@ func RunMetisSimpleArbitrageBot(_logger *zap.Logger, _mainWg *sync.WaitGroup, st
 				profitFloat, _ := util.ToDecimal(totalProfit, 18).Float64()
 
 				// Write to influxDb
-				influxdb.WriteMEVOpportunity(botContext, "", 0, profitFloat)
+				influxdb.WriteMEVOpportunity(b.botContext, "", 0, profitFloat)
 			}
 
-			markReservesAsStale()
+			b.markReservesAsStale()
 
-			logger.Info("Update",
-				zap.Int("totalOpportunities", totalOpportunities),
-				zap.Int("arbTxSentCount", arbTxSentCount),
-				zap.Int("failedTxs", totalOpportunities-arbTxSentCount),
-				zap.String("balance", util.ToDecimal(currBalance, 18).String()),
-			)
+			b.logStatus(totalOpportunities, currBalance)
 
 		case vLog := <-logs:
+			b.journal.recordLog(vLog)
 
 			// Get log
 			if vLog.Topics[0] != uniV2EventHash && vLog.Topics[0] != hermesEventHash {
 				continue
 			}
 
-			logger.Info("Got event", zap.Uint64("blockNumber", vLog.BlockNumber))
+			b.logger.Info("Got event", zap.Uint64("blockNumber", vLog.BlockNumber))
 
 			if vLog.BlockNumber == previousBlock {
-				logger.Debug("We didn't wait for all events")
+				b.logger.Debug("We didn't wait for all events")
 				prematureCalcs++
 			}
 
@@ -664,28 +789,29 @@ func RunMetisSimpleArbitrageBot(_logger *zap.Logger, _mainWg *sync.WaitGroup, st
 			start = hrtime.Now()
 
 			// Update reserves
-			tokenAddr := updateReservesByEvent(vLog)
+			tokenAddr := b.updateReservesByEvent(vLog)
 
 			var arbTxs []FlashSwapExecutorV1.Arb
 			subsequentEventOccurred := false
 			newEvent := true
 
 			// Poll for an amount of time via spinlock
-			for hrtime.Since(start) < (time.Microsecond*time.Duration(config.EventDelayMs)) || len(logs) > 0 || newEvent {
+			for hrtime.Since(start) < (time.Microsecond*time.Duration(b.config.EventDelayMs)) || len(logs) > 0 || newEvent {
 				for len(logs) > 0 {
 					vLog := <-logs
+					b.journal.recordLog(vLog)
 
 					if vLog.Topics[0] != uniV2EventHash && vLog.Topics[0] != hermesEventHash {
 						continue
 					}
 
-					logger.Info("Got event at block", zap.Uint64("blockNumber", vLog.BlockNumber))
+					b.logger.Info("Got event at block", zap.Uint64("blockNumber", vLog.BlockNumber))
 
 					if vLog.BlockNumber > previousBlock {
 						previousBlock = vLog.BlockNumber
 					}
 
-					tokenAddr = updateReservesByEvent(vLog)
+					tokenAddr = b.updateReservesByEvent(vLog)
 					subsequentEventOccurred = true
 
 					if !newEvent {
@@ -695,47 +821,48 @@ func RunMetisSimpleArbitrageBot(_logger *zap.Logger, _mainWg *sync.WaitGroup, st
 
 				if newEvent {
 					// Evaluate all markets
-					arbTxs = evaluateMarketsRecursive(false, tokenAddr, 0) // evaluateMarkets()
+					arbTxs = b.evaluateMarketsRecursive(false, tokenAddr, 0) // evaluateMarkets()
+					b.journal.recordArbs(previousBlock, &tokenAddr, arbTxs)
 					newEvent = false
 				}
 			}
 
 			pollingDone := hrtime.Since(start)
 
-			logger.Info("Polling and Processing Done", zap.String("duration", pollingDone.String()))
+			b.logger.Info("Polling and Processing Done", zap.String("duration", pollingDone.String()))
 
 			if len(arbTxs) <= 1 {
-				logger.Debug("No Arbs in Processed Event Block No", zap.Uint64("blockNumber", previousBlock))
-				logger.Debug("Total Time", zap.String("duration", hrtime.Since(start).String()))
+				b.logger.Debug("No Arbs in Processed Event Block No", zap.Uint64("blockNumber", previousBlock))
+				b.logger.Debug("Total Time", zap.String("duration", hrtime.Since(start).String()))
 			} else {
-				// Actually take the opportunity
-				go takeOpportunities(
-					executorContract,
-					executorContractAddress,
-					fromAddress,
-					auth,
-					readClient,
-					arbTxs)
-
-				logger.Debug("Arbs in Processed Event Block No: ", zap.Uint64("blockNumber", previousBlock))
-
-				// Optimisation: Let's do all non-critical stuff here
-				// Update our nonce
-				nonce++
-
-				auth, err = bind.NewKeyedTransactorWithChainID(privateKey, chainId)
-				if err != nil {
-					logger.Error("Error generating auth", zap.Error(err))
-					exit = true
+				// Pick the account to send from
+				account := b.executors.acquire()
+				if account != nil {
+					auth := b.executors.takeAuth(account)
+
+					// Price gas for these arbs and reserve a nonce for this tx
+					b.applyGasPrices(auth, arbTxs)
+					auth.Nonce = new(big.Int).SetUint64(account.nonces.reserve())
+
+					// Actually take the opportunity
+					go b.takeOpportunities(
+						arbSender,
+						account,
+						auth,
+						b.readClient,
+						arbTxs)
+
+					// Optimisation: Let's do all non-critical stuff here
+					err := b.executors.renewAuth(account)
+					if err != nil {
+						b.logger.Error("Error generating auth", zap.Error(err))
+						b.cancel()
+					}
+				} else {
+					b.logger.Info("All executor accounts are paused, skipping arb")
 				}
 
-				auth.Value = big.NewInt(0)      // in wei
-				auth.GasLimit = uint64(3000000) // in units
-				auth.GasPrice = big.NewInt(0).Add(MIN_GAS_GWEI, util.ToWei(MIN_GAS_GWEI_BUFFER, 9))
-				auth.NoSend = false
-
-				// Setup transaction
-				auth.Nonce = big.NewInt(int64(nonce))
+				b.logger.Debug("Arbs in Processed Event Block No: ", zap.Uint64("blockNumber", previousBlock))
 
 				// Track total opportunities
 				totalOpportunities++
@@ -746,10 +873,10 @@ func RunMetisSimpleArbitrageBot(_logger *zap.Logger, _mainWg *sync.WaitGroup, st
 				}
 
 				// Log the opportunities
-				logger.Info("There were opportunities for profit in processed block", zap.Uint64("blockNumber", previousBlock))
+				b.logger.Info("There were opportunities for profit in processed block", zap.Uint64("blockNumber", previousBlock))
 
 				for count, crossedMarket := range arbTxs {
-					logger.Info(fmt.Sprintf("Opportunity %d", count),
+					b.logger.Info(fmt.Sprintf("Opportunity %d", count),
 						zap.String("size", util.ToDecimal(crossedMarket.NativeInAmount, 18).String()),
 						zap.String("tokenOut", util.ToDecimal(crossedMarket.NativeOutAmount, 18).String()),
 						zap.String("profit", util.ToDecimal(crossedMarket.Profit, 18).String()),
@@ -767,34 +894,62 @@ func RunMetisSimpleArbitrageBot(_logger *zap.Logger, _mainWg *sync.WaitGroup, st
 				profitFloat, _ := util.ToDecimal(totalProfit, 18).Float64()
 
 				// Write to influxDb
-				influxdb.WriteMEVOpportunity(botContext, vLog.TxHash.Hex(), int(vLog.BlockNumber), profitFloat)
+				influxdb.WriteMEVOpportunity(b.botContext, vLog.TxHash.Hex(), int(vLog.BlockNumber), profitFloat)
 			}
 
-			markReservesAsStale()
+			b.markReservesAsStale()
 
 			if subsequentEventOccurred {
 				subsequentEvents++
 			}
 
-			logger.Info("Update",
-				zap.Int("totalOpportunities", totalOpportunities),
-				zap.Int("arbTxSentCount", arbTxSentCount),
-				zap.Int("failedTxs", totalOpportunities-arbTxSentCount),
-				zap.String("balance", util.ToDecimal(currBalance, 18).String()),
-			)
+			b.logStatus(totalOpportunities, currBalance)
 		}
 	}
 
+}
+
+// Runs once the main loop is done, or when setup fails
+func (b *Bot) shutdown() {
 	// Let's summarize our session here
-	currBalance, err = readClient.BalanceAt(context.Background(), fromAddress, nil)
-	if err != nil {
-		logger.Error("Error getting balance", zap.Error(err))
-		exit = true
+	if b.executors != nil {
+		err := b.executors.refreshBalances()
+		if err != nil {
+			b.logger.Error("Error getting balance", zap.Error(err))
+		} else {
+			b.currBalance = b.executors.totalBalance()
+		}
 	}
 
 	// Cleanup here after exit
-	logger.Info("Cleanup...")
+	b.logger.Info("Cleanup...")
 	influxdb.Flush()
 
-	mainWg.Done()
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		b.closers[i]()
+	}
+	b.closers = nil
+
+	close(b.done)
+}
+
+func (s *botState) logStatus(totalOpportunities int, currBalance *big.Int) {
+	outcomes, realizedProfit, gasCost := s.tracker.stats()
+
+	s.mu.Lock()
+	sentCount := s.arbTxSentCount
+	s.mu.Unlock()
+
+	s.logger.Info("Update",
+		zap.Int("totalOpportunities", totalOpportunities),
+		zap.Int("arbTxSentCount", sentCount),
+		zap.Int("unsentOpportunities", totalOpportunities-sentCount),
+		zap.Int("successTxs", outcomes[txOutcomeSuccess]),
+		zap.Int("revertedTxs", outcomes[txOutcomeReverted]),
+		zap.Int("noOpTxs", outcomes[txOutcomeNoOp]),
+		zap.Int("timedOutTxs", outcomes[txOutcomeTimedOut]),
+		zap.String("realizedProfit", util.ToDecimal(realizedProfit, 18).String()),
+		zap.String("gasCost", util.ToDecimal(gasCost, 18).String()),
+		zap.String("balance", util.ToDecimal(currBalance, 18).String()),
+	)
 }
@@ -0,0 +1,211 @@
+package metis_simple_arbitrage
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"go.uber.org/zap"
+)
+
+type broadcastError int
+
+const (
+	broadcastErrorNone broadcastError = iota
+	broadcastErrorNonceTooLow
+	broadcastErrorUnderpriced
+	broadcastErrorAlreadyKnown
+	broadcastErrorOther
+)
+
+func (e broadcastError) String() string {
+	switch e {
+	case broadcastErrorNone:
+		return "none"
+	case broadcastErrorNonceTooLow:
+		return "nonceTooLow"
+	case broadcastErrorUnderpriced:
+		return "underpriced"
+	case broadcastErrorAlreadyKnown:
+		return "alreadyKnown"
+	default:
+		return "other"
+	}
+}
+
+func classifyBroadcastError(err error) broadcastError {
+	if err == nil {
+		return broadcastErrorNone
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "nonce too low"):
+		return broadcastErrorNonceTooLow
+	case strings.Contains(msg, "underpriced"):
+		return broadcastErrorUnderpriced
+	case strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction"):
+		return broadcastErrorAlreadyKnown
+	default:
+		return broadcastErrorOther
+	}
+}
+
+// One RPC node we push our signed txs to
+type broadcastEndpoint struct {
+	name   string
+	client *ethclient.Client
+
+	sent         int
+	wins         int
+	errors       map[broadcastError]int
+	totalLatency time.Duration
+	maxLatency   time.Duration
+}
+
+type broadcastResult struct {
+	endpoint *broadcastEndpoint
+	err      error
+	latency  time.Duration
+}
+
+// Sends the same signed tx to every endpoint at once, so one slow node doesn't cost us the race
+type broadcaster struct {
+	mu        sync.Mutex
+	endpoints []*broadcastEndpoint
+	logger    *zap.Logger
+}
+
+// The write client always comes first, extra endpoints are network names from the config
+func (s *botState) newBroadcaster(networkNames []string) (*broadcaster, error) {
+	b := &broadcaster{logger: s.logger}
+	b.endpoints = append(b.endpoints, &broadcastEndpoint{
+		name:   "write",
+		client: s.writeClient,
+		errors: make(map[broadcastError]int),
+	})
+
+	for _, networkName := range networkNames {
+		client, err := ethclient.Dial(os.Getenv(networkName))
+		if err != nil {
+			return nil, err
+		}
+
+		b.endpoints = append(b.endpoints, &broadcastEndpoint{
+			name:   networkName,
+			client: client,
+			errors: make(map[broadcastError]int),
+		})
+	}
+
+	return b, nil
+}
+
+func (b *broadcaster) close() {
+	// The write client is closed by the bot itself
+	for _, endpoint := range b.endpoints[1:] {
+		endpoint.client.Close()
+	}
+}
+
+// Returns as soon as one endpoint accepts the tx, the rest finish in the background for the stats
+// If every endpoint rejects it, returns the most telling error
+func (b *broadcaster) send(ctx context.Context, tx *types.Transaction) error {
+	results := make(chan broadcastResult, len(b.endpoints))
+
+	for _, endpoint := range b.endpoints {
+		go func(endpoint *broadcastEndpoint) {
+			// Each endpoint gets its own deadline, a hung node must not hold its goroutine forever
+			endpointCtx, cancel := context.WithTimeout(ctx, time.Millisecond*BROADCAST_ENDPOINT_TIMEOUT_MS)
+			defer cancel()
+
+			start := time.Now()
+			err := endpoint.client.SendTransaction(endpointCtx, tx)
+			results <- broadcastResult{endpoint: endpoint, err: err, latency: time.Since(start)}
+		}(endpoint)
+	}
+
+	var firstErr error
+	var firstErrClass broadcastError
+	accepted := false
+
+	for i := 0; i < len(b.endpoints); i++ {
+		result := <-results
+		errClass := classifyBroadcastError(result.err)
+
+		b.record(result, errClass, !accepted && errClass == broadcastErrorNone)
+
+		if errClass == broadcastErrorNone || errClass == broadcastErrorAlreadyKnown {
+			if !accepted {
+				accepted = true
+				b.logger.Debug("Tx accepted", zap.String("hash", tx.Hash().Hex()), zap.String("endpoint", result.endpoint.name), zap.String("latency", result.latency.String()))
+
+				// Drain the rest without blocking the caller
+				go b.drain(results, len(b.endpoints)-i-1)
+				return nil
+			}
+			continue
+		}
+
+		// Nonce too low is final, underpriced beats anything unclassified
+		if firstErr == nil || errClass < firstErrClass {
+			firstErr = result.err
+			firstErrClass = errClass
+		}
+	}
+
+	return firstErr
+}
+
+func (b *broadcaster) drain(results chan broadcastResult, remaining int) {
+	for i := 0; i < remaining; i++ {
+		result := <-results
+		b.record(result, classifyBroadcastError(result.err), false)
+	}
+}
+
+func (b *broadcaster) record(result broadcastResult, errClass broadcastError, won bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	endpoint := result.endpoint
+	endpoint.sent++
+	endpoint.totalLatency += result.latency
+	if result.latency > endpoint.maxLatency {
+		endpoint.maxLatency = result.latency
+	}
+	if errClass != broadcastErrorNone {
+		endpoint.errors[errClass]++
+	}
+	if won {
+		endpoint.wins++
+	}
+}
+
+func (b *broadcaster) logStats() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, endpoint := range b.endpoints {
+		var avgLatency time.Duration
+		if endpoint.sent > 0 {
+			avgLatency = endpoint.totalLatency / time.Duration(endpoint.sent)
+		}
+
+		b.logger.Info("Broadcast endpoint stats",
+			zap.String("endpoint", endpoint.name),
+			zap.Int("sent", endpoint.sent),
+			zap.Int("wins", endpoint.wins),
+			zap.String("avgLatency", avgLatency.String()),
+			zap.String("maxLatency", endpoint.maxLatency.String()),
+			zap.Int("nonceTooLow", endpoint.errors[broadcastErrorNonceTooLow]),
+			zap.Int("underpriced", endpoint.errors[broadcastErrorUnderpriced]),
+			zap.Int("alreadyKnown", endpoint.errors[broadcastErrorAlreadyKnown]),
+			zap.Int("other", endpoint.errors[broadcastErrorOther]),
+		)
+	}
+}
@@ -7,6 +7,8 @@ const (
 	ALL_MARKET_RESERVES_JSON_PATH          = "allMarketReserves.json"
 	ALL_MARKET_ADDRESS_FACTORIES_JSON_PATH = "allMarketAddressFactories.json"
 	MARKET_MAPPING_JSON_PATH               = "marketMapping.json"
+	EVM_STATE_JSON_PATH                    = "evmState.json"
+	BACKTEST_LOGS_JSON_PATH                = "syncLogs.json"
 	TEMP_DATA                              = "temp.json"
 
 	// Bot info
@@ -14,6 +16,8 @@ const (
 	BOT_VERSION = "1.1.59"
 	BOT_NETWORK = "Metis"
 
+	PAPER_BOT_SUFFIX = "-paper"
+
 	// UniswappyV2 Arb Info
 	NETSWAP_FACTORY_ADDRESS    = "0x70f51d68D16e8f9e418441280342BD43AC9Dff9f" // Dynamic fee
 	AGORASWAP_FACTORY_ADDRESS  = "0x3c4063B964B1b3bF229315fCc4df61a694B0aE84" // Dynamic fee
@@ -31,6 +35,12 @@ const (
 
 	BATCH_COUNT_LIMIT  = 2000
 	UNISWAP_BATCH_SIZE = 50
+	RESERVE_BATCH_SIZE = 200
+
+	// Factory Scan Params
+	FACTORY_SCAN_DEFAULT_CONCURRENCY = 8
+	FACTORY_SCAN_RETRIES             = 3
+	FACTORY_SCAN_RETRY_DELAY_MS      = 500
 
 	// Profit Params
 	MIN_PROFIT_FOLLOWUP_DIVISOR = 40
@@ -43,11 +53,106 @@ const (
 	GAS_FEE_CAP_MULTIPLIER = 2
 	TRANSFER_GAS_LIMIT     = 23000
 
+	// Gas Strategy Params
+	GAS_STRATEGY_LEGACY         = "legacy"
+	GAS_STRATEGY_EIP1559        = "eip1559"
+	GAS_STRATEGY_PROFIT         = "profit"
+	GAS_STRATEGY_PROFIT_EIP1559 = "profit-eip1559"
+	GAS_FEE_HISTORY_BLOCKS      = 20
+	GAS_TIP_PERCENTILE          = 50
+	GAS_PROFIT_SHARE_PERCENT    = 10
+
+	// Reserve Source Params
+	RESERVE_SOURCE_FLASH_QUERY = "flash-query"
+	RESERVE_SOURCE_MULTICALL   = "multicall"
+	RESERVE_SOURCE_RPC_BATCH   = "rpc-batch"
+	MULTICALL3_ADDRESS         = "0xcA11bde05977b3631167028862bE2a173976CA11"
+	VIEW_CALL_BATCH_SIZE       = 200
+
+	// Token Risk Params
+	TOKEN_RISK_PROXY_SCORE        = 40
+	TOKEN_RISK_SELFDESTRUCT_SCORE = 40
+	TOKEN_RISK_BLACKLIST_SCORE    = 30
+	TOKEN_RISK_PAUSE_SCORE        = 25
+	TOKEN_RISK_FEE_SETTER_SCORE   = 20
+	TOKEN_RISK_DELEGATECALL_SCORE = 15
+	TOKEN_RISK_MINT_SCORE         = 10
+
+	// Anomaly Params
+	ANOMALY_LIQUIDITY_REMOVED_PERCENT = 50
+	ANOMALY_PRICE_JUMP_PERCENT        = 80
+	ANOMALY_NATIVE_DROP_PERCENT       = 60
+	ANOMALY_QUARANTINE_BLOCKS         = 300
+
+	// TWAP Guard Params
+	TWAP_GUARD_SKIP            = "skip"
+	TWAP_GUARD_CAP             = "cap"
+	TWAP_WINDOW_S              = 600
+	TWAP_MAX_DEVIATION_PERCENT = 30
+	TWAP_CAP_PERCENT           = 25
+
+	// Simulation Params
+	SIMULATION_TIMEOUT_MS = 150
+	HEALTH_CHECK_AMOUNT   = 0.1
+
+	// Local EVM Params
+	EVM_PRESTATE_TIMEOUT_MS       = 5000
+	EVM_BALANCE_SLOT_SEARCH_LIMIT = 20
+	EVM_PRESTATE_POOLS_PER_TRACE  = 25
+	EVM_PRESTATE_TRACES_PER_BATCH = 20
+
+	// Nonce Params
+	NONCE_STUCK_TIMEOUT_S         = 120
+	NONCE_CANCEL_GAS_BUMP_PERCENT = 20
+
+	// Tx Tracking Params
+	TX_RECEIPT_TIMEOUT_S = 60
+	TX_RECEIPT_POLL_MS   = 500
+
+	// Executor Account Params
+	ACCOUNT_SELECTION_ROUND_ROBIN   = "round-robin"
+	ACCOUNT_SELECTION_LEAST_PENDING = "least-pending"
+	MIN_EXECUTOR_BALANCE            = 1.0
+
+	// Read Pool Params
+	READ_POOL_HEALTH_CHECK_MS = 2000
+	READ_POOL_TIMEOUT_MS      = 1000
+	READ_POOL_MAX_BLOCK_LAG   = 3
+	READ_POOL_MAX_ERROR_RATE  = 0.5
+	READ_POOL_EWMA_WEIGHT     = 0.2
+
+	// Broadcast Params
+	BROADCAST_ENDPOINT_TIMEOUT_MS = 2000
+
+	// Recorder Params
+	RECORDER_JOURNAL_DIR    = "journal"
+	RECORDER_BUFFER         = 10000
+	RECORDER_MAX_FILE_BYTES = 64 * 1024 * 1024
+	RECORDER_MAX_FILES      = 48
+	RECORDER_MAX_LINE_BYTES = 64 * 1024 * 1024
+
+	// Backtest Params
+	BACKTEST_EVENT_SPACING_US = 200
+
+	// Sweep Params
+	SWEEP_TRIAL_SUBCOMMAND = "metis-sweep-trial"
+	SWEEP_DEFAULT_WORKERS  = 4
+
+	// Research Params
+	RESEARCH_LOG_CHUNK_BLOCKS  = 2000
+	RESEARCH_LOG_ADDRESS_CHUNK = 500
+
 	// Channel Params
 	CHANNEL_BUFFER = 100
 
 	// Arb Params
-	MAX_ARB_PER_TX = 12
+	MAX_ARB_PER_TX      = 12
+	MAX_FOLLOW_UP_DEPTH = 100
+
+	// Split Route Params
+	SPLIT_ROUTE_MIN_PAIRS      = 3
+	SPLIT_ROUTE_MAX_ITERATIONS = 32
+	SPLIT_ROUTE_STEP_DIVISOR   = 4
 
 	// Min Profit Params
 	ARB_FAILURE_GAS_COST      = 100000
@@ -0,0 +1,511 @@
+package metis_simple_arbitrage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
+	"github.com/cryptotriv/raikiri/lib/util"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/holiman/uint256"
+	"go.uber.org/zap"
+)
+
+// Account as returned by the prestateTracer, also used for our json dumps
+type forkedAccount struct {
+	Balance *hexutil.Big                `json:"balance,omitempty"`
+	Nonce   uint64                      `json:"nonce,omitempty"`
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// Where a pool keeps its reserves and where its tokens keep the pool's balances
+type forkedPoolSlots struct {
+	reservesSlot   common.Hash
+	balanceSlots   [2]common.Hash
+	tokenAddresses [2]common.Address
+}
+
+// A local copy of the chain state our executor touches, so ExecuteNativeArb can run in-process
+type forkedState struct {
+	mu       sync.Mutex
+	db       *state.StateDB
+	accounts map[common.Address]*forkedAccount
+	pools    map[common.Address]forkedPoolSlots
+}
+
+type localRevertError struct {
+	data []byte
+}
+
+func (e *localRevertError) Error() string {
+	return vm.ErrExecutionReverted.Error()
+}
+
+func (e *localRevertError) ErrorCode() int {
+	return 3
+}
+
+func (e *localRevertError) ErrorData() interface{} {
+	return hexutil.Encode(e.data)
+}
+
+func newForkedState() (*forkedState, error) {
+	db, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &forkedState{
+		db:       db,
+		accounts: make(map[common.Address]*forkedAccount),
+		pools:    make(map[common.Address]forkedPoolSlots),
+	}, nil
+}
+
+// A call whose touched accounts and storage slots we want in our state
+type prestateCall struct {
+	from  common.Address
+	to    common.Address
+	value *big.Int
+	data  []byte
+}
+
+// Anything that can send a JSON-RPC batch, a single node or our read pool
+type batchCaller interface {
+	BatchCallContext(ctx context.Context, batch []rpc.BatchElem) error
+}
+
+// Pulls the accounts and storage slots touched by each call through debug_traceCall's prestateTracer
+// Traces go out EVM_PRESTATE_TRACES_PER_BATCH at a time, each batch under its own timeout
+func (f *forkedState) loadPrestates(rpcClient batchCaller, calls []prestateCall) error {
+	for start := 0; start < len(calls); start += EVM_PRESTATE_TRACES_PER_BATCH {
+		end := start + EVM_PRESTATE_TRACES_PER_BATCH
+		if end > len(calls) {
+			end = len(calls)
+		}
+
+		prestates := make([]map[common.Address]*forkedAccount, end-start)
+		batch := make([]rpc.BatchElem, end-start)
+		for i, call := range calls[start:end] {
+			callArgs := map[string]interface{}{
+				"from":  call.from,
+				"to":    call.to,
+				"gas":   hexutil.Uint64(GAS_LIMIT_DEFAULT),
+				"value": (*hexutil.Big)(call.value),
+				"data":  hexutil.Bytes(call.data),
+			}
+
+			batch[i] = rpc.BatchElem{
+				Method: "debug_traceCall",
+				Args:   []interface{}{callArgs, "latest", map[string]interface{}{"tracer": "prestateTracer"}},
+				Result: &prestates[i],
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*EVM_PRESTATE_TIMEOUT_MS)
+		err := rpcClient.BatchCallContext(ctx, batch)
+		cancel()
+
+		if err != nil {
+			return err
+		}
+
+		for i, elem := range batch {
+			if elem.Error != nil {
+				return fmt.Errorf("tracing a call to %s from %s: %w", calls[start+i].to.Hex(), calls[start+i].from.Hex(), elem.Error)
+			}
+		}
+
+		f.mu.Lock()
+		for _, prestate := range prestates {
+			for address, account := range prestate {
+				f.setAccount(address, account)
+			}
+		}
+		f.finalise()
+		f.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Commits what we wrote so far, so the journal only ever holds a single simulation
+func (f *forkedState) finalise() {
+	f.db.Finalise(false)
+}
+
+func (f *forkedState) setAccount(address common.Address, account *forkedAccount) {
+	stored, ok := f.accounts[address]
+	if !ok {
+		stored = &forkedAccount{Storage: make(map[common.Hash]common.Hash)}
+		f.accounts[address] = stored
+	}
+
+	if account.Balance != nil {
+		stored.Balance = account.Balance
+		f.db.SetBalance(address, uint256.MustFromBig(account.Balance.ToInt()))
+	}
+	if account.Nonce > stored.Nonce {
+		stored.Nonce = account.Nonce
+		f.db.SetNonce(address, account.Nonce)
+	}
+	if len(account.Code) > 0 {
+		stored.Code = account.Code
+		f.db.SetCode(address, account.Code)
+	}
+	for key, value := range account.Storage {
+		stored.Storage[key] = value
+		f.db.SetState(address, key, value)
+	}
+}
+
+// Finds the reserves slot of the pool and the balance slots of its tokens from what we loaded
+// Pools we cannot map are left out, and any arb on them falls back to an RPC simulation
+func (f *forkedState) mapPool(pool common.Address, tokenAddresses [2]common.Address, reserve0 *big.Int, reserve1 *big.Int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	poolAccount, ok := f.accounts[pool]
+	if !ok {
+		return false
+	}
+
+	// Reserves are packed as reserve0 | reserve1 << 112 | blockTimestampLast << 224
+	packed := packReserves(common.Hash{}, reserve0, reserve1)
+
+	slots := forkedPoolSlots{tokenAddresses: tokenAddresses}
+	foundReserves := false
+
+	for key, value := range poolAccount.Storage {
+		if new(big.Int).And(value.Big(), reservesMask()).Cmp(packed.Big()) == 0 {
+			slots.reservesSlot = key
+			foundReserves = true
+			break
+		}
+	}
+
+	if !foundReserves {
+		return false
+	}
+
+	// Solidity mappings live at keccak256(key . slot), try the usual slot indexes
+	for i, token := range tokenAddresses {
+		tokenAccount, ok := f.accounts[token]
+		if !ok {
+			return false
+		}
+
+		foundBalance := false
+		for slotIndex := int64(0); slotIndex < EVM_BALANCE_SLOT_SEARCH_LIMIT; slotIndex++ {
+			key := mappingSlot(pool, slotIndex)
+			if _, ok := tokenAccount.Storage[key]; ok {
+				slots.balanceSlots[i] = key
+				foundBalance = true
+				break
+			}
+		}
+
+		if !foundBalance {
+			return false
+		}
+	}
+
+	f.pools[pool] = slots
+	return true
+}
+
+// Writes new reserves into the pool and its token balances, called from the same places we update allMarketReserves
+func (f *forkedState) syncReserves(pool common.Address, reserve0 *big.Int, reserve1 *big.Int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	slots, ok := f.pools[pool]
+	if !ok {
+		return
+	}
+
+	current := f.db.GetState(pool, slots.reservesSlot)
+	f.db.SetState(pool, slots.reservesSlot, packReserves(current, reserve0, reserve1))
+
+	// After a Sync, balances and reserves are equal
+	f.db.SetState(slots.tokenAddresses[0], slots.balanceSlots[0], common.BigToHash(reserve0))
+	f.db.SetState(slots.tokenAddresses[1], slots.balanceSlots[1], common.BigToHash(reserve1))
+	f.finalise()
+}
+
+// Pulls the executor's code and storage, like the executors mapping, by tracing executeNativeArb from each of our accounts
+// Empty arbs on each pool make it read the pools without trading, so the trace never reverts on a missing opportunity
+func (f *forkedState) loadExecutorPrestate(rpcClient batchCaller, executorAddress common.Address, fromAddresses []common.Address, pools []common.Address, minProfit *big.Int) error {
+	var calls []prestateCall
+	for _, fromAddress := range fromAddresses {
+		for start := 0; start < len(pools) || start == 0; start += EVM_PRESTATE_POOLS_PER_TRACE {
+			end := start + EVM_PRESTATE_POOLS_PER_TRACE
+			if end > len(pools) {
+				end = len(pools)
+			}
+
+			arbs := make([]FlashSwapExecutorV1.Arb, 0, end-start)
+			for _, pool := range pools[start:end] {
+				arbs = append(arbs, FlashSwapExecutorV1.Arb{
+					BuyFromPair:     pool,
+					NativeInAmount:  big.NewInt(0),
+					TokenAmount:     big.NewInt(0),
+					NativeOutAmount: big.NewInt(0),
+					Profit:          big.NewInt(0),
+					SellToPair:      pool,
+				})
+			}
+
+			data, err := executorABI.Pack("executeNativeArb", arbs, minProfit)
+			if err != nil {
+				return err
+			}
+
+			calls = append(calls, prestateCall{from: fromAddress, to: executorAddress, value: big.NewInt(0), data: data})
+		}
+	}
+
+	err := f.loadPrestates(rpcClient, calls)
+	if err != nil {
+		return fmt.Errorf("loading executor prestate: %w", err)
+	}
+
+	return f.requireCode(executorAddress)
+}
+
+// Calls into an account without code succeed and do nothing, which would pass every arb
+func (f *forkedState) requireCode(address common.Address) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.hasCode(address) {
+		return fmt.Errorf("no code loaded for %s", address.Hex())
+	}
+
+	return nil
+}
+
+func (f *forkedState) hasCode(address common.Address) bool {
+	account, ok := f.accounts[address]
+	return ok && len(account.Code) > 0
+}
+
+func (f *forkedState) canSimulate(arbs []FlashSwapExecutorV1.Arb) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, arb := range arbs {
+		if _, ok := f.pools[arb.BuyFromPair]; !ok {
+			return false
+		}
+		if _, ok := f.pools[arb.SellToPair]; !ok {
+			return false
+		}
+
+		// Native Metis lives in the token contract's storage, not in account balances like in a plain EVM
+		// Mixing it with WMETIS withdraw/deposit would not match what the chain does
+		if arb.BuyFromIsWMetis != arb.SellToIsWMetis {
+			return false
+		}
+
+		// Our traces only reach WMETIS through pools that hold it
+		if arb.BuyFromIsWMetis && !f.hasCode(common.HexToAddress(WMETIS_TOKEN_ADDRESS)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Runs ExecuteNativeArb on the local state without keeping any of its changes
+// Returns the native profit received by from, as measured by its balance before and after
+func (f *forkedState) executeNativeArb(from common.Address, executorContractAddress common.Address, arbs []FlashSwapExecutorV1.Arb, minProfit *big.Int) (*big.Int, uint64, error) {
+	data, err := executorABI.Pack("executeNativeArb", arbs, minProfit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	snapshot := f.db.Snapshot()
+	defer f.db.RevertToSnapshot(snapshot)
+
+	cfg := f.runtimeConfig(from)
+
+	balanceBefore := f.nativeBalance(from)
+
+	ret, leftOverGas, err := runtime.Call(executorContractAddress, data, cfg)
+	if errors.Is(err, vm.ErrExecutionReverted) {
+		return nil, GAS_LIMIT_DEFAULT - leftOverGas, &localRevertError{data: ret}
+	} else if err != nil {
+		return nil, GAS_LIMIT_DEFAULT - leftOverGas, err
+	}
+
+	profit := new(big.Int).Sub(f.nativeBalance(from), balanceBefore)
+
+	return profit, GAS_LIMIT_DEFAULT - leftOverGas, nil
+}
+
+func (f *forkedState) nativeBalance(account common.Address) *big.Int {
+	// Metis keeps native balances in the token's balance mapping at slot 0
+	return f.db.GetState(common.HexToAddress(METIS_TOKEN_ADDRESS), mappingSlot(account, 0)).Big()
+}
+
+func (f *forkedState) runtimeConfig(from common.Address) *runtime.Config {
+	return &runtime.Config{
+		Origin:      from,
+		GasLimit:    GAS_LIMIT_DEFAULT,
+		GasPrice:    big.NewInt(0),
+		Value:       big.NewInt(0),
+		BlockNumber: big.NewInt(0),
+		State:       f.db,
+	}
+}
+
+// Writes all loaded accounts to disk, so they can be loaded again without a node
+func (f *forkedState) save(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := json.Marshal(f.accounts)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+func (f *forkedState) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var accounts map[common.Address]*forkedAccount
+	err = json.Unmarshal(data, &accounts)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for address, account := range accounts {
+		f.setAccount(address, account)
+	}
+	f.finalise()
+
+	return nil
+}
+
+func (s *botState) initLocalEVM(rpcClient batchCaller, tokenProvidenceAddress common.Address, executorAddress common.Address, fromAddresses []common.Address) (*forkedState, error) {
+	forked, err := newForkedState()
+	if err != nil {
+		return nil, err
+	}
+
+	statePath := filepath.Join(DATA_BASEPATH, EVM_STATE_JSON_PATH)
+
+	if s.debug {
+		// DEBUG: Load state from our json file so we can run offline
+		err = forked.load(statePath)
+		if err != nil {
+			return nil, err
+		}
+
+		err = forked.requireCode(executorAddress)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// The health check buys and sells through the pool, so it touches the same state as an arb on that pool
+		var calls []prestateCall
+		for _, pairs := range s.marketPairsByToken {
+			for _, pair := range pairs {
+				data, err := tokenProvidenceABI.Pack("healthCheck", pair.MarketAdress, pair.TokenAddresses[pair.TokenIndex], big.NewInt(pair.FeePerTenThousands))
+				if err != nil {
+					return nil, err
+				}
+
+				calls = append(calls, prestateCall{from: fromAddresses[0], to: tokenProvidenceAddress, value: util.ToWei(HEALTH_CHECK_AMOUNT, 18), data: data})
+			}
+		}
+
+		err = forked.loadPrestates(rpcClient, calls)
+		if err != nil {
+			return nil, fmt.Errorf("loading pool prestate: %w", err)
+		}
+
+		// The arbs themselves run in our executor, which the health check never touches
+		err = forked.loadExecutorPrestate(rpcClient, executorAddress, fromAddresses, s.allMarketAddresses, s.minProfitWeiFollowUp)
+		if err != nil {
+			return nil, err
+		}
+
+		err = forked.save(statePath)
+		if err != nil {
+			s.logger.Error("Error writing local EVM state", zap.Error(err))
+		}
+	}
+
+	// Map every pool so that reserve updates can be written into its storage
+	mappedPools := 0
+	for _, pairs := range s.marketPairsByToken {
+		for _, pair := range pairs {
+			reserves := s.allMarketReserves[pair.TokenReserveIndex]
+			if forked.mapPool(pair.MarketAdress, pair.TokenAddresses, reserves[0], reserves[1]) {
+				mappedPools++
+			}
+		}
+	}
+
+	s.logger.Info("Local EVM loaded",
+		zap.Int("accounts", len(forked.accounts)),
+		zap.Int("mappedPools", mappedPools),
+		zap.Int("totalPools", len(s.allMarketAddresses)),
+	)
+
+	return forked, nil
+}
+
+func (s *botState) syncLocalEVMReserves() {
+	if s.localEVM == nil {
+		return
+	}
+
+	for marketIndex, marketAddress := range s.allMarketAddresses {
+		s.localEVM.syncReserves(marketAddress, s.allMarketReserves[marketIndex][0], s.allMarketReserves[marketIndex][1])
+	}
+}
+
+func packReserves(current common.Hash, reserve0 *big.Int, reserve1 *big.Int) common.Hash {
+	packed := new(big.Int).AndNot(current.Big(), reservesMask())
+	packed.Or(packed, reserve0)
+	packed.Or(packed, new(big.Int).Lsh(reserve1, 112))
+	return common.BigToHash(packed)
+}
+
+func reservesMask() *big.Int {
+	return new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 224), big.NewInt(1))
+}
+
+func mappingSlot(key common.Address, slotIndex int64) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(key.Bytes(), 32), common.BigToHash(big.NewInt(slotIndex)).Bytes())
+}
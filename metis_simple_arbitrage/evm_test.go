@@ -0,0 +1,218 @@
+package metis_simple_arbitrage
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/zap"
+)
+
+// PUSH1 0 PUSH1 0 REVERT, an executor that turns down every arb
+var revertingExecutorCode = common.FromHex("0x60006000fd")
+
+// Serves debug_traceCall with a fixed prestate and remembers what it was asked to trace
+type fakePrestateTracer struct {
+	prestate map[common.Address]*forkedAccount
+	calls    []map[string]interface{}
+}
+
+func (t *fakePrestateTracer) TraceCall(args map[string]interface{}, block string, config map[string]interface{}) (map[common.Address]*forkedAccount, error) {
+	t.calls = append(t.calls, args)
+	return t.prestate, nil
+}
+
+func TestLocalEVMRejectsRevertingArb(t *testing.T) {
+	s := newLocalEVMTestState(t)
+
+	executorAddress := common.HexToAddress("0x00000000000000000000000000000000000000e1")
+	fromAddress := common.HexToAddress("0x00000000000000000000000000000000000000f1")
+	pool := common.HexToAddress("0x00000000000000000000000000000000000000b1")
+
+	tracer := &fakePrestateTracer{prestate: map[common.Address]*forkedAccount{
+		executorAddress: {Code: revertingExecutorCode},
+	}}
+
+	forked := loadLocalEVMTestExecutor(t, tracer, executorAddress, fromAddress, pool)
+	if err := forked.requireCode(executorAddress); err != nil {
+		t.Fatal(err)
+	}
+
+	// The executor is traced the way we call it, from the account that sends the arbs
+	if len(tracer.calls) != 1 {
+		t.Fatalf("expected one trace, got %d", len(tracer.calls))
+	}
+	if to := tracer.calls[0]["to"]; !strings.EqualFold(to.(string), executorAddress.Hex()) {
+		t.Fatalf("traced a call to %v", to)
+	}
+	if from := tracer.calls[0]["from"]; !strings.EqualFold(from.(string), fromAddress.Hex()) {
+		t.Fatalf("traced a call from %v", from)
+	}
+	data, err := hexutil.Decode(tracer.calls[0]["data"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, executorABI.Methods["executeNativeArb"].ID) {
+		t.Fatalf("traced %x, not executeNativeArb", data)
+	}
+
+	arbs := []FlashSwapExecutorV1.Arb{{
+		BuyFromPair:     pool,
+		NativeInAmount:  big.NewInt(1e18),
+		TokenAmount:     big.NewInt(1e18),
+		NativeOutAmount: big.NewInt(2e18),
+		Profit:          big.NewInt(1e18),
+		SellToPair:      pool,
+	}}
+
+	_, _, err = forked.executeNativeArb(fromAddress, executorAddress, arbs, s.minProfitWeiFollowUp)
+	var revertErr *localRevertError
+	if !errors.As(err, &revertErr) {
+		t.Fatalf("expected the arb to revert locally, got %v", err)
+	}
+
+	s.localEVM = forked
+	if passed := s.simulateArbsLocally(executorAddress, fromAddress, arbs); len(passed) != 0 {
+		t.Fatalf("expected the reverting arb to be dropped, %d passed", len(passed))
+	}
+}
+
+// Every account that sends arbs is traced, over as many traces as the pools need
+func TestLocalEVMTracesExecutorForEveryAccount(t *testing.T) {
+	initTestContractABIs(t)
+
+	executorAddress := common.HexToAddress("0x00000000000000000000000000000000000000e1")
+	fromAddresses := []common.Address{
+		common.HexToAddress("0x00000000000000000000000000000000000000f1"),
+		common.HexToAddress("0x00000000000000000000000000000000000000f2"),
+	}
+
+	pools := make([]common.Address, EVM_PRESTATE_POOLS_PER_TRACE+1)
+	for i := range pools {
+		pools[i] = common.BigToAddress(big.NewInt(int64(0xb000 + i)))
+	}
+
+	tracer := &fakePrestateTracer{prestate: map[common.Address]*forkedAccount{
+		executorAddress: {Code: revertingExecutorCode},
+	}}
+
+	client := serveLocalEVMTestTracer(t, tracer)
+
+	forked, err := newForkedState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = forked.loadExecutorPrestate(client, executorAddress, fromAddresses, pools, big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traced := make(map[string]int)
+	for _, call := range tracer.calls {
+		traced[strings.ToLower(call["from"].(string))]++
+	}
+	for _, fromAddress := range fromAddresses {
+		if traced[strings.ToLower(fromAddress.Hex())] != 2 {
+			t.Fatalf("expected 2 traces from %s, got %v", fromAddress.Hex(), traced)
+		}
+	}
+}
+
+// Without the executor's code every call would succeed, so loading must fail instead
+func TestLocalEVMRequiresExecutorCode(t *testing.T) {
+	initTestContractABIs(t)
+
+	executorAddress := common.HexToAddress("0x00000000000000000000000000000000000000e1")
+	fromAddress := common.HexToAddress("0x00000000000000000000000000000000000000f1")
+	pool := common.HexToAddress("0x00000000000000000000000000000000000000b1")
+
+	tracer := &fakePrestateTracer{prestate: map[common.Address]*forkedAccount{
+		pool: {Storage: map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(1))}},
+	}}
+
+	client := serveLocalEVMTestTracer(t, tracer)
+
+	forked, err := newForkedState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = forked.loadExecutorPrestate(client, executorAddress, []common.Address{fromAddress}, []common.Address{pool}, big.NewInt(0))
+	if err == nil {
+		t.Fatal("expected loading to fail without executor code")
+	}
+}
+
+func loadLocalEVMTestExecutor(t *testing.T, tracer *fakePrestateTracer, executorAddress common.Address, fromAddress common.Address, pool common.Address) *forkedState {
+	client := serveLocalEVMTestTracer(t, tracer)
+
+	forked, err := newForkedState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = forked.loadExecutorPrestate(client, executorAddress, []common.Address{fromAddress}, []common.Address{pool}, big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return forked
+}
+
+func serveLocalEVMTestTracer(t *testing.T, tracer *fakePrestateTracer) *rpc.Client {
+	server := rpc.NewServer()
+	if err := server.RegisterName("debug", tracer); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+
+	client := rpc.DialInProc(server)
+	t.Cleanup(client.Close)
+
+	return client
+}
+
+func initTestContractABIs(t *testing.T) {
+	err := initContractABIs()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newLocalEVMTestState(t *testing.T) *botState {
+	initTestContractABIs(t)
+
+	s := newBotState(zap.NewNop())
+	s.minProfitWeiFollowUp = big.NewInt(0)
+
+	return s
+}
+
+// The executor returns what the arbs made, the paper fill and the local EVM both read it back
+func TestUnpackExecutorProfit(t *testing.T) {
+	initTestContractABIs(t)
+
+	output, err := executorABI.Methods["executeNativeArb"].Outputs.Pack(big.NewInt(12345))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profit, err := unpackExecutorProfit(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profit.Cmp(big.NewInt(12345)) != 0 {
+		t.Fatalf("unpacked %v", profit)
+	}
+
+	if _, err := unpackExecutorProfit(nil); err == nil {
+		t.Fatal("expected empty output to fail")
+	}
+}
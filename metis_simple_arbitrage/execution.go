@@ -1,111 +1,101 @@
 package metis_simple_arbitrage
 
 import (
+	"context"
 	"strings"
 	"time"
 
 	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/loov/hrtime"
 	"go.uber.org/zap"
 )
 
-func takeOpportunities(
-	executorContract *FlashSwapExecutorV1.FlashSwapExecutorV1,
-	executorContractAddress common.Address,
-	fromAddress common.Address,
+func (s *botState) takeOpportunities(
+	arbSender ArbSender,
+	account *executorAccount,
 	auth *bind.TransactOpts,
 	// privateKey *ecdsa.PrivateKey,
 	// chainId *big.Int,
 	// currentNonce uint64,
 	// gasPrice *big.Int,
-	readClient *ethclient.Client,
+	readClient *readPool,
 	arbs []FlashSwapExecutorV1.Arb) {
 
 	var start time.Duration
 
-	if !config.PerformanceMode {
+	if !s.config.PerformanceMode {
 		start = hrtime.Now()
 	}
 
-	// Build transaction
-	// if config.SimulateTxs {
-
-	// 	auth.NoSend = true
-	// 	simulateTx, err := executorContract.ExecuteNativeArb(
-	// 		auth,
-	// 		arbs,
-	// 		MIN_PROFIT_WEI_FOLLOWUP)
-	// 	if handleIf(err) {
-	// 		return
-	// 	}
-
-	// 	// Estimate gas used
-	// 	msg := ethereum.CallMsg{
-	// 		From:     fromAddress,
-	// 		To:       &executorContractAddress,
-	// 		Gas:      simulateTx.Gas(),
-	// 		GasPrice: simulateTx.GasPrice(),
-	// 		Value:    simulateTx.Value(),
-	// 		Data:     simulateTx.Data(),
-	// 	}
-
-	// 	_, err = readClient.EstimateGas(context.Background(), msg)
-	// 	if handleIf(err) {
-	// 		logMessage(models.Error, "EstimateGas failed for arb, skipping")
-	// 		return
-	// 	}
-
-	// 	if !config.PerformanceMode {
-	// 		logMessage(models.Info, fmt.Sprint("Simulate arb done: ", hrtime.Since(start)))
-	// 	}
-
-	// 	auth.NoSend = false
-	// }
+	// Simulate before we send, dropping arbs that would revert
+	if s.config.SimulateTxs {
+		arbs = s.simulateArbs(arbSender.Address(), account.address, readClient, arbs)
+		if len(arbs) == 0 {
+			s.logger.Info("No arbs left after simulation, skipping")
+			account.nonces.release(auth.Nonce.Uint64(), nil)
+			return
+		}
+	}
 
 	// Send transaction
-	tx, err := executorContract.ExecuteNativeArb(
+	tx, err := arbSender.SignArbs(
 		auth,
 		arbs,
-		MIN_PROFIT_WEI_FOLLOWUP)
+		s.minProfitWeiFollowUp)
+
+	// Paper trading: signed but never broadcast, the tracker simulates it at the next block instead
+	if s.config.PaperTrading && err == nil {
+		s.logger.Info("Paper arb tx signed! Hash: ", zap.String("hash", tx.Hash().Hex()))
+
+		account.nonces.release(auth.Nonce.Uint64(), nil)
 
-	logger.Debug("Sent arb tx with nonce: ", zap.Uint64("nonce", auth.Nonce.Uint64()))
-	logger.Debug("Tx for arb sent: ", zap.String("duration", hrtime.Since(start).String()))
+		s.mu.Lock()
+		s.arbTxSentCount++
+		s.mu.Unlock()
+
+		s.tracker.trackPaper(tx, account.address, arbs)
+		return
+	}
 
 	if err == nil {
-		logger.Info("Arb Tx Sent! Hash: ", zap.String("hash", tx.Hash().Hex()))
+		err = arbSender.Send(context.Background(), tx)
 
-		mu.Lock()
-		arbTxSentCount++
-		mu.Unlock()
+		// The node has it already, so it is live and has to be tracked like any tx we sent
+		if classifyBroadcastError(err) == broadcastErrorAlreadyKnown {
+			err = nil
+		}
+	}
+
+	s.logger.Debug("Sent arb tx with nonce: ", zap.Uint64("nonce", auth.Nonce.Uint64()))
+	s.logger.Debug("Tx for arb sent: ", zap.String("duration", hrtime.Since(start).String()))
 
-		// time.Sleep(30 * time.Second)
+	if err == nil {
+		s.logger.Info("Arb Tx Sent! Hash: ", zap.String("hash", tx.Hash().Hex()))
 
-		// Get the receipt to see if the tx was successful
-		// receipt, err := readClient.TransactionReceipt(context.Background(), tx.Hash())
-		// if err != nil {
-		// 	logger.Error("Error getting receipt for arb tx: ", zap.Error(err))
-		// 	return
-		// }
+		account.nonces.markSent(auth.Nonce.Uint64(), tx)
+		s.journal.recordTx(tx, account.address, arbs)
 
-		// revert := false
-		// if receipt.Status == 0 {
-		// 	revert = true
-		// }
+		s.mu.Lock()
+		s.arbTxSentCount++
+		s.mu.Unlock()
 
-		// success := false
-		// if len(receipt.Logs) > 0 {
-		// 	success = true
-		// }
+		// Follow the tx until it is mined, to see if it was successful
+		s.tracker.track(tx, account.address, arbs)
 
-		// influxdb.WriteMEVTxSent(botContext, tx.Hash().Hex(), int(receipt.BlockNumber.Int64()), success, revert)
+		// Keep bidding on it if others go for the same pools
+		if s.pga != nil {
+			s.pga.open(account, auth, arbs, tx)
+		}
 	} else if strings.Contains(err.Error(), "nonce too low") {
-		logger.Error("Expected error found for arb tx: ", zap.Error(err))
-		logger.Error("Another bot sent a faster tx for arb")
+		s.logger.Error("Expected error found for arb tx: ", zap.Error(err))
+		s.logger.Error("Another bot sent a faster tx for arb")
+
+		account.nonces.release(auth.Nonce.Uint64(), err)
 	} else {
 		// This error we are not sure, let's log it
-		logger.Error("Unhandled error found for arb tx: ", zap.Error(err))
+		s.logger.Error("Unhandled error found for arb tx: ", zap.Error(err))
+
+		account.nonces.release(auth.Nonce.Uint64(), err)
 	}
 }
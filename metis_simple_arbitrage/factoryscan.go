@@ -0,0 +1,157 @@
+package metis_simple_arbitrage
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+)
+
+// One range of a factory's pairs, results are kept by position so the order doesn't depend on which worker finished first
+type factoryScanBatch struct {
+	factoryIndex int
+	start        int
+	end          int
+
+	pairs    [][3]common.Address
+	isStable []bool
+	err      error
+}
+
+// Lists the pairs of every factory, concurrency is shared across factories and their batches
+// The batches come back grouped by factory in the order of factories, each factory's in index order
+func (s *botState) scanFactories(pairLister PairLister, factories []string) ([][]*factoryScanBatch, error) {
+	workers := s.config.FactoryScanConcurrency
+	if workers <= 0 {
+		workers = FACTORY_SCAN_DEFAULT_CONCURRENCY
+	}
+
+	// How many pairs each factory has, that tells us the batches
+	pairCounts := make([]int, len(factories))
+	countErrs := make([]error, len(factories))
+	runBounded(workers, len(factories), func(i int) {
+		countErrs[i] = s.withScanRetries("allPairsLength", factories[i], func() error {
+			count, err := pairLister.PairCount(nil, common.HexToAddress(factories[i]))
+			if err != nil {
+				return err
+			}
+			pairCounts[i] = int(count.Int64())
+			return nil
+		})
+	})
+
+	var batches []*factoryScanBatch
+	batchesByFactory := make([][]*factoryScanBatch, len(factories))
+	for i, factoryAddress := range factories {
+		if countErrs[i] != nil {
+			return nil, countErrs[i]
+		}
+
+		pairCount := pairCounts[i]
+		if pairCount > BATCH_COUNT_LIMIT*UNISWAP_BATCH_SIZE {
+			s.logger.Warn("Factory has more pairs than we scan", zap.String("factoryAddress", factoryAddress), zap.Int("pairCount", pairCount))
+			pairCount = BATCH_COUNT_LIMIT * UNISWAP_BATCH_SIZE
+		}
+
+		for start := 0; start < pairCount; start += UNISWAP_BATCH_SIZE {
+			end := start + UNISWAP_BATCH_SIZE
+			if end > pairCount {
+				end = pairCount
+			}
+
+			batch := &factoryScanBatch{factoryIndex: i, start: start, end: end}
+			batches = append(batches, batch)
+			batchesByFactory[i] = append(batchesByFactory[i], batch)
+		}
+	}
+
+	s.logger.Info("Scanning factories", zap.Int("factories", len(factories)), zap.Int("batches", len(batches)), zap.Int("workers", workers))
+
+	runBounded(workers, len(batches), func(i int) {
+		batch := batches[i]
+		factoryAddress := factories[batch.factoryIndex]
+
+		batch.err = s.withScanRetries("getPairsByIndexRange", factoryAddress, func() error {
+			pairs, err := pairLister.ListPairs(nil, common.HexToAddress(factoryAddress), big.NewInt(int64(batch.start)), big.NewInt(int64(batch.end)))
+			if err != nil {
+				return err
+			}
+			batch.pairs = pairs
+			return nil
+		})
+		if batch.err != nil || factoryAddress != HERMES_FACTORY_ADDRESS {
+			return
+		}
+
+		// Hermes stable pairs are priced differently, they get filtered out
+		var addressFilter []common.Address
+		for _, pair := range batch.pairs {
+			addressFilter = append(addressFilter, pair[2])
+		}
+
+		batch.err = s.withScanRetries("filterVolatileHermesPairs", factoryAddress, func() error {
+			isStable, err := pairLister.StableHermesPairs(nil, addressFilter)
+			if err != nil {
+				return err
+			}
+			batch.isStable = isStable
+			return nil
+		})
+	})
+
+	for _, batch := range batches {
+		if batch.err != nil {
+			return nil, batch.err
+		}
+	}
+
+	return batchesByFactory, nil
+}
+
+// Runs job for 0 to n-1 on at most workers goroutines
+func runBounded(workers int, n int, job func(i int)) {
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				job(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// The read pool already moves on to other endpoints, this rides out moments where all of them fail
+func (s *botState) withScanRetries(method string, factoryAddress string, call func() error) error {
+	var err error
+	for attempt := 0; attempt <= FACTORY_SCAN_RETRIES; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Millisecond * time.Duration(FACTORY_SCAN_RETRY_DELAY_MS*attempt))
+		}
+
+		err = call()
+		if err == nil || isDeterministicReadError(err) {
+			return err
+		}
+
+		s.logger.Warn("Factory scan call failed",
+			zap.String("method", method),
+			zap.String("factoryAddress", factoryAddress),
+			zap.Int("attempt", attempt+1),
+			zap.Error(err),
+		)
+	}
+
+	return err
+}
@@ -0,0 +1,235 @@
+package metis_simple_arbitrage
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
+	"github.com/cryptotriv/raikiri/lib/util"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"go.uber.org/zap"
+)
+
+// Either GasPrice is set for legacy txs, or GasFeeCap and GasTipCap for dynamic fee txs
+type gasPrices struct {
+	GasPrice  *big.Int
+	GasFeeCap *big.Int
+	GasTipCap *big.Int
+}
+
+// Decides what we pay for gas, consulted every time we build a bind.TransactOpts
+type gasStrategy interface {
+	name() string
+	// Refreshes from the chain
+	update(ctx context.Context) error
+	// Prices for a tx carrying these arbs, arbs can be nil when they are not known yet
+	prices(arbs []FlashSwapExecutorV1.Arb) gasPrices
+}
+
+func newGasStrategy(strategyName string, readClient *readPool) (gasStrategy, error) {
+	switch strategyName {
+	case "", GAS_STRATEGY_LEGACY:
+		return &legacyGasStrategy{readClient: readClient}, nil
+	case GAS_STRATEGY_EIP1559:
+		return &eip1559GasStrategy{readClient: readClient}, nil
+	case GAS_STRATEGY_PROFIT:
+		return &profitGasStrategy{base: &legacyGasStrategy{readClient: readClient}}, nil
+	case GAS_STRATEGY_PROFIT_EIP1559:
+		return &profitGasStrategy{base: &eip1559GasStrategy{readClient: readClient}}, nil
+	default:
+		return nil, errors.New("unknown gas strategy: " + strategyName)
+	}
+}
+
+// Builds the auth for an arb tx with gas priced by our strategy
+// The nonce is set when the tx is actually sent
+func (s *botState) newTransactOpts(privateKey *ecdsa.PrivateKey, chainId *big.Int) (*bind.TransactOpts, error) {
+	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainId)
+	if err != nil {
+		return nil, err
+	}
+
+	auth.Value = big.NewInt(0)      // in wei
+	auth.GasLimit = uint64(3000000) // in units
+	auth.NoSend = true              // only signed here, the broadcaster sends it
+
+	s.applyGasPrices(auth, nil)
+
+	return auth, nil
+}
+
+func (s *botState) applyGasPrices(auth *bind.TransactOpts, arbs []FlashSwapExecutorV1.Arb) {
+	setGasPrices(auth, s.gasPricing.prices(arbs))
+}
+
+func setGasPrices(auth *bind.TransactOpts, prices gasPrices) {
+	auth.GasPrice = prices.GasPrice
+	auth.GasFeeCap = prices.GasFeeCap
+	auth.GasTipCap = prices.GasTipCap
+}
+
+// What we always did: the node's suggestion plus a small buffer
+type legacyGasStrategy struct {
+	mu         sync.Mutex
+	gasPrice   *big.Int
+	readClient *readPool
+}
+
+func (s *legacyGasStrategy) name() string {
+	return GAS_STRATEGY_LEGACY
+}
+
+func (s *legacyGasStrategy) update(ctx context.Context) error {
+	gasPrice, err := s.readClient.SuggestGasPrice(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.gasPrice = big.NewInt(0).Add(gasPrice, util.ToWei(MIN_GAS_GWEI_BUFFER, 9))
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *legacyGasStrategy) prices(arbs []FlashSwapExecutorV1.Arb) gasPrices {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return gasPrices{GasPrice: new(big.Int).Set(s.gasPrice)}
+}
+
+// Fee cap and tip derived from the base fees and tips of recent blocks
+type eip1559GasStrategy struct {
+	mu         sync.Mutex
+	baseFee    *big.Int
+	gasTipCap  *big.Int
+	readClient *readPool
+}
+
+func (s *eip1559GasStrategy) name() string {
+	return GAS_STRATEGY_EIP1559
+}
+
+func (s *eip1559GasStrategy) update(ctx context.Context) error {
+	feeHistory, err := s.readClient.FeeHistory(ctx, GAS_FEE_HISTORY_BLOCKS, nil, []float64{GAS_TIP_PERCENTILE})
+	if err != nil {
+		return err
+	}
+
+	if len(feeHistory.BaseFee) == 0 {
+		return errors.New("chain does not report base fees")
+	}
+
+	// The last base fee is the one for the next block
+	baseFee := feeHistory.BaseFee[len(feeHistory.BaseFee)-1]
+
+	var tips []*big.Int
+	for _, reward := range feeHistory.Reward {
+		if len(reward) > 0 {
+			tips = append(tips, reward[0])
+		}
+	}
+
+	gasTipCap := big.NewInt(0)
+	if len(tips) > 0 {
+		sort.Slice(tips, func(i, j int) bool {
+			return tips[i].Cmp(tips[j]) < 0
+		})
+		gasTipCap = tips[len(tips)/2]
+	}
+	gasTipCap = new(big.Int).Add(gasTipCap, util.ToWei(MIN_GAS_GWEI_BUFFER, 9))
+
+	s.mu.Lock()
+	s.baseFee = baseFee
+	s.gasTipCap = gasTipCap
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *eip1559GasStrategy) prices(arbs []FlashSwapExecutorV1.Arb) gasPrices {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Leave room for the base fee to rise before we are included
+	gasFeeCap := new(big.Int).Mul(s.baseFee, big.NewInt(GAS_FEE_CAP_MULTIPLIER))
+	gasFeeCap.Add(gasFeeCap, s.gasTipCap)
+
+	return gasPrices{GasFeeCap: gasFeeCap, GasTipCap: new(big.Int).Set(s.gasTipCap)}
+}
+
+// Pays a share of the expected profit, never less than the base strategy
+type profitGasStrategy struct {
+	base gasStrategy
+}
+
+func (s *profitGasStrategy) name() string {
+	return GAS_STRATEGY_PROFIT + "/" + s.base.name()
+}
+
+func (s *profitGasStrategy) update(ctx context.Context) error {
+	return s.base.update(ctx)
+}
+
+func (s *profitGasStrategy) prices(arbs []FlashSwapExecutorV1.Arb) gasPrices {
+	prices := s.base.prices(arbs)
+	if len(arbs) == 0 {
+		return prices
+	}
+
+	expectedProfit := big.NewInt(0)
+	for _, arb := range arbs {
+		expectedProfit.Add(expectedProfit, arb.Profit)
+	}
+
+	gasEstimate := arbGasEstimate(arbs)
+
+	profitGasPrice := new(big.Int).Mul(expectedProfit, big.NewInt(GAS_PROFIT_SHARE_PERCENT))
+	profitGasPrice.Div(profitGasPrice, big.NewInt(100))
+	profitGasPrice.Div(profitGasPrice, gasEstimate)
+
+	if prices.GasPrice != nil {
+		if profitGasPrice.Cmp(prices.GasPrice) > 0 {
+			prices.GasPrice = profitGasPrice
+		}
+		return prices
+	}
+
+	// For dynamic fees the share goes to the tip
+	if profitGasPrice.Cmp(prices.GasTipCap) > 0 {
+		prices.GasFeeCap = new(big.Int).Add(prices.GasFeeCap, new(big.Int).Sub(profitGasPrice, prices.GasTipCap))
+		prices.GasTipCap = profitGasPrice
+	}
+
+	return prices
+}
+
+// Rough gas used by a tx carrying these arbs, two swaps per arb
+func arbGasEstimate(arbs []FlashSwapExecutorV1.Arb) *big.Int {
+	return big.NewInt(int64(ARB_BASE_GAS + ARB_GAS_BYTECODE_GAS + ARB_GAS_PER_SWAP*2*len(arbs)))
+}
+
+func (s *botState) updateGasPricing() {
+	err := s.gasPricing.update(context.Background())
+	if err != nil {
+		s.logger.Error("Error updating gas pricing", zap.String("strategy", s.gasPricing.name()), zap.Error(err))
+		return
+	}
+
+	prices := s.gasPricing.prices(nil)
+
+	if prices.GasPrice != nil {
+		s.logger.Info("Gas pricing updated", zap.String("strategy", s.gasPricing.name()), zap.String("gasPrice", util.ToDecimal(prices.GasPrice, 9).String()))
+	} else {
+		s.logger.Info("Gas pricing updated",
+			zap.String("strategy", s.gasPricing.name()),
+			zap.String("gasFeeCap", util.ToDecimal(prices.GasFeeCap, 9).String()),
+			zap.String("gasTipCap", util.ToDecimal(prices.GasTipCap, 9).String()),
+		)
+	}
+}
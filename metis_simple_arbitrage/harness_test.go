@@ -0,0 +1,423 @@
+//go:build harness
+
+package metis_simple_arbitrage
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
+	"github.com/cryptotriv/raikiri/gen/FlashUniswapQueryV1"
+	"github.com/cryptotriv/raikiri/gen/MockERC20"
+	"github.com/cryptotriv/raikiri/gen/MockUniswapV2Factory"
+	"github.com/cryptotriv/raikiri/gen/MockUniswapV2Pair"
+	"github.com/cryptotriv/raikiri/gen/MockWMETIS"
+	"github.com/cryptotriv/raikiri/gen/TokenProvidenceV1"
+	"github.com/cryptotriv/raikiri/lib/models"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/node"
+	"go.uber.org/zap"
+)
+
+// The mocks live in contracts/mocks, their bindings are generated next to our other contracts with go generate
+// Pinned to solc 0.8.19, abigen is the go-ethereum version in go.mod so it runs from the module cache
+// Run with go generate, then go test -tags harness
+//go:generate sh -c "solc --version | grep -q 'Version: 0.8.19+' || { echo 'the harness needs solc 0.8.19 on PATH' >&2; exit 1; }"
+//go:generate solc --optimize --overwrite --abi --bin -o ../build/mocks ../contracts/mocks/MockERC20.sol ../contracts/mocks/MockWMETIS.sol ../contracts/mocks/MockUniswapV2Pair.sol ../contracts/mocks/MockUniswapV2Factory.sol
+//go:generate solc --optimize --overwrite --bin --allow-paths ..,../.. -o ../build/contracts ../contracts/FlashSwapExecutorV1.sol
+//go:generate go run github.com/ethereum/go-ethereum/cmd/abigen --abi ../build/mocks/MockERC20.abi --bin ../build/mocks/MockERC20.bin --pkg MockERC20 --type MockERC20 --out ../gen/MockERC20/MockERC20.go
+//go:generate go run github.com/ethereum/go-ethereum/cmd/abigen --abi ../build/mocks/MockWMETIS.abi --bin ../build/mocks/MockWMETIS.bin --pkg MockWMETIS --type MockWMETIS --out ../gen/MockWMETIS/MockWMETIS.go
+//go:generate go run github.com/ethereum/go-ethereum/cmd/abigen --abi ../build/mocks/MockUniswapV2Pair.abi --bin ../build/mocks/MockUniswapV2Pair.bin --pkg MockUniswapV2Pair --type MockUniswapV2Pair --out ../gen/MockUniswapV2Pair/MockUniswapV2Pair.go
+//go:generate go run github.com/ethereum/go-ethereum/cmd/abigen --abi ../build/mocks/MockUniswapV2Factory.abi --bin ../build/mocks/MockUniswapV2Factory.bin --pkg MockUniswapV2Factory --type MockUniswapV2Factory --out ../gen/MockUniswapV2Factory/MockUniswapV2Factory.go
+
+const (
+	harnessExecutorKeyEnv = "HARNESS_PRIVATE_KEY_EXECUTOR"
+	harnessChainId        = 1337
+	harnessBlockTime      = 250 * time.Millisecond
+	harnessTxTimeout      = 30 * time.Second
+	harnessArbTimeout     = 90 * time.Second
+
+	// The executor's bindings come from its ABI alone, its deploy code from the solc run above
+	harnessExecutorBinPath = "../build/contracts/FlashSwapExecutorV1.bin"
+)
+
+// Runtime code of the mocks we place at fixed addresses in genesis
+type harnessCodes struct {
+	erc20   []byte
+	wmetis  []byte
+	factory []byte
+}
+
+// What the test deployed on the simulated chain
+type harnessChain struct {
+	metis     *MockERC20.MockERC20
+	contracts map[string]common.Address
+}
+
+// Seeds two tokens with the same price gap between two DEXes and runs the bot against them
+// The live loop only sends when it found more than one arb, hence two tokens
+func TestSimulatedChainArbitrage(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs a simulated chain")
+	}
+
+	// Read before we leave the package directory
+	executorBin, err := os.ReadFile(harnessExecutorBinPath)
+	if err != nil {
+		t.Fatalf("%v, run go generate first", err)
+	}
+
+	// The bot writes its market snapshot under DATA_BASEPATH
+	t.Chdir(t.TempDir())
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	executorAddress := crypto.PubkeyToAddress(key.PublicKey)
+	t.Setenv(harnessExecutorKeyEnv, hex.EncodeToString(crypto.FromECDSA(key)))
+
+	codes := harnessRuntimeCodes(t, key)
+
+	// METIS, WMETIS and every factory the bot knows sit at their mainnet addresses
+	alloc := types.GenesisAlloc{
+		executorAddress:                           {Balance: harnessEther(1_000_000)},
+		common.HexToAddress(METIS_TOKEN_ADDRESS):  {Code: codes.erc20},
+		common.HexToAddress(WMETIS_TOKEN_ADDRESS): {Code: codes.wmetis},
+	}
+	for _, factoryAddress := range uniswapV2FactoryAddresses {
+		alloc[common.HexToAddress(factoryAddress)] = types.Account{Code: codes.factory}
+	}
+
+	// Served over IPC so the bot gets a real ethclient, nothing leaves the box
+	ipcPath := filepath.Join(t.TempDir(), "sim.ipc")
+	sim := simulated.NewBackend(alloc, func(nodeConf *node.Config, ethConf *ethconfig.Config) {
+		nodeConf.IPCPath = ipcPath
+	})
+	t.Cleanup(func() { sim.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	// Mine blocks on a timer like a real chain would
+	go func() {
+		ticker := time.NewTicker(harnessBlockTime)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sim.Commit()
+			}
+		}
+	}()
+
+	client, err := ethclient.Dial(ipcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	chain := harnessDeploy(t, client, key, common.FromHex(strings.TrimSpace(string(executorBin))))
+	harnessPinInitCodeHashes(t, client)
+
+	balanceBefore, err := chain.metis.BalanceOf(nil, executorAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bot := NewBot(BotOptions{
+		Logger:      zap.NewNop(),
+		Config:      harnessConfig(),
+		ReadClients: []*ethclient.Client{client},
+		WriteClient: client,
+		Contracts:   chain.contracts,
+	})
+
+	err = bot.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(bot.Stop)
+
+	if len(bot.marketPairsByToken) != 2 {
+		t.Fatalf("expected 2 tokens to pass market filtering, got %d", len(bot.marketPairsByToken))
+	}
+
+	// Found, sent, mined and profitable
+	deadline := time.Now().Add(harnessArbTimeout)
+	for {
+		outcomes, realizedProfit, _ := bot.tracker.stats()
+		if outcomes[txOutcomeSuccess] > 0 && realizedProfit.Sign() > 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			bot.mu.Lock()
+			sentCount := bot.arbTxSentCount
+			bot.mu.Unlock()
+
+			t.Fatalf("no profitable arb mined: sent %d, outcomes %v, realized profit %s", sentCount, outcomes, realizedProfit)
+		}
+
+		time.Sleep(harnessBlockTime)
+	}
+
+	balanceAfter, err := chain.metis.BalanceOf(nil, executorAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if balanceAfter.Cmp(balanceBefore) <= 0 {
+		t.Fatalf("executor METIS balance did not grow: before %s, after %s", balanceBefore, balanceAfter)
+	}
+}
+
+// Deploys the mocks on a throwaway chain to read their runtime code
+func harnessRuntimeCodes(t *testing.T, key *ecdsa.PrivateKey) harnessCodes {
+	t.Helper()
+
+	boot := simulated.NewBackend(types.GenesisAlloc{
+		crypto.PubkeyToAddress(key.PublicKey): {Balance: harnessEther(1_000)},
+	})
+	defer boot.Close()
+
+	client := boot.Client()
+	auth := harnessAuth(t, key)
+
+	erc20Address, _, _, err := MockERC20.DeployMockERC20(auth, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boot.Commit()
+
+	wmetisAddress, _, _, err := MockWMETIS.DeployMockWMETIS(auth, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boot.Commit()
+
+	factoryAddress, _, _, err := MockUniswapV2Factory.DeployMockUniswapV2Factory(auth, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boot.Commit()
+
+	var codes harnessCodes
+	for _, code := range []struct {
+		address common.Address
+		into    *[]byte
+	}{
+		{erc20Address, &codes.erc20},
+		{wmetisAddress, &codes.wmetis},
+		{factoryAddress, &codes.factory},
+	} {
+		*code.into, err = client.CodeAt(context.Background(), code.address, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(*code.into) == 0 {
+			t.Fatalf("no code at %s", code.address.Hex())
+		}
+	}
+
+	return codes
+}
+
+// Deploys our contracts, then sets up two tokens that are cheaper on Tethys than on NetSwap
+func harnessDeploy(t *testing.T, client *ethclient.Client, key *ecdsa.PrivateKey, executorBin []byte) harnessChain {
+	t.Helper()
+
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	metisAddress := common.HexToAddress(METIS_TOKEN_ADDRESS)
+
+	metis, err := MockERC20.NewMockERC20(metisAddress, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flashQueryAddress, tx, _, err := FlashUniswapQueryV1.DeployFlashUniswapQueryV1(harnessAuth(t, key), client)
+	harnessMined(t, client, tx, err)
+
+	tokenProvidenceAddress, tx, _, err := TokenProvidenceV1.DeployTokenProvidenceV1(harnessAuth(t, key), client, owner, metisAddress)
+	harnessMined(t, client, tx, err)
+
+	executorABI, err := FlashSwapExecutorV1.FlashSwapExecutorV1MetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executorAddress, tx, _, err := bind.DeployContract(harnessAuth(t, key), *executorABI, executorBin, client, owner, metisAddress, common.HexToAddress(WMETIS_TOKEN_ADDRESS))
+	harnessMined(t, client, tx, err)
+
+	// The health check pays for its test buy in METIS
+	tx, err = metis.Mint(harnessAuth(t, key), tokenProvidenceAddress, harnessEther(1_000))
+	harnessMined(t, client, tx, err)
+
+	// Fees in fee per thousands, like the real AgoraSwap and NetSwap factories
+	for factoryAddress, fee := range map[string]int64{
+		AGORASWAP_FACTORY_ADDRESS: 1,
+		NETSWAP_FACTORY_ADDRESS:   3,
+	} {
+		factory, err := MockUniswapV2Factory.NewMockUniswapV2Factory(common.HexToAddress(factoryAddress), client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tx, err = factory.SetFee(harnessAuth(t, key), big.NewInt(fee))
+		harnessMined(t, client, tx, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		tokenAddress, tx, token, err := MockERC20.DeployMockERC20(harnessAuth(t, key), client)
+		harnessMined(t, client, tx, err)
+
+		// 10% more tokens per METIS on Tethys
+		harnessSeedPair(t, client, key, NETSWAP_FACTORY_ADDRESS, 30, metis, token, tokenAddress, harnessEther(1_000_000), harnessEther(1_000_000))
+		harnessSeedPair(t, client, key, TETHYS_FACTORY_ADDRESS, uniswapV2FactoryAddressFeePerTenThousands[TETHYS_FACTORY_ADDRESS], metis, token, tokenAddress, harnessEther(1_000_000), harnessEther(1_100_000))
+	}
+
+	return harnessChain{
+		metis: metis,
+		contracts: map[string]common.Address{
+			"FlashUniswapQueryV1": flashQueryAddress,
+			"FlashSwapExecutorV1": executorAddress,
+			"TokenProvidenceV1":   tokenProvidenceAddress,
+		},
+	}
+}
+
+// Every factory is our mock, so its pairs are verified against the mock pair's init code hash
+func harnessPinInitCodeHashes(t *testing.T, client *ethclient.Client) {
+	t.Helper()
+
+	saved := uniswapV2FactoryInitCodeHashes
+	t.Cleanup(func() { uniswapV2FactoryInitCodeHashes = saved })
+
+	uniswapV2FactoryInitCodeHashes = make(map[string]string)
+	for _, factoryAddress := range uniswapV2FactoryAddresses {
+		factory, err := MockUniswapV2Factory.NewMockUniswapV2Factory(common.HexToAddress(factoryAddress), client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		initCodeHash, err := factory.INITCODEPAIRHASH(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		uniswapV2FactoryInitCodeHashes[factoryAddress] = common.Hash(initCodeHash).Hex()
+	}
+}
+
+// Creates a METIS pair on a factory and fills it with the given reserves
+func harnessSeedPair(
+	t *testing.T,
+	client *ethclient.Client,
+	key *ecdsa.PrivateKey,
+	factoryAddress string,
+	feePerTenThousands int64,
+	metis *MockERC20.MockERC20,
+	token *MockERC20.MockERC20,
+	tokenAddress common.Address,
+	metisReserve *big.Int,
+	tokenReserve *big.Int) {
+
+	t.Helper()
+
+	metisAddress := common.HexToAddress(METIS_TOKEN_ADDRESS)
+
+	factory, err := MockUniswapV2Factory.NewMockUniswapV2Factory(common.HexToAddress(factoryAddress), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := factory.CreatePair(harnessAuth(t, key), metisAddress, tokenAddress, big.NewInt(feePerTenThousands))
+	harnessMined(t, client, tx, err)
+
+	pairAddress, err := factory.GetPair(nil, metisAddress, tokenAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = metis.Mint(harnessAuth(t, key), pairAddress, metisReserve)
+	harnessMined(t, client, tx, err)
+
+	tx, err = token.Mint(harnessAuth(t, key), pairAddress, tokenReserve)
+	harnessMined(t, client, tx, err)
+
+	pair, err := MockUniswapV2Pair.NewMockUniswapV2Pair(pairAddress, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = pair.Sync(harnessAuth(t, key))
+	harnessMined(t, client, tx, err)
+}
+
+// Polls reserves every second from our contracts on the simulated chain, no subscriptions, no PGA
+func harnessConfig() *models.AllBotsConfig {
+	return &models.AllBotsConfig{
+		NodeName: "harness",
+		MainName: "harness",
+		MetisSimpleArbitrageBot: models.SimpleArbitrageBot{
+			AvailableNetworks:        []string{"HARNESS_RPC_URL"},
+			ReadAndWriteNetworkIndex: 0,
+			WriteOnlyNetworkIndex:    -1,
+			UseAccount:               harnessExecutorKeyEnv,
+			BaseNativePricingAmount:  1,
+			MinumumNativeAmount:      1,
+			MinimumProfit:            0.01,
+		},
+	}
+}
+
+func harnessAuth(t *testing.T, key *ecdsa.PrivateKey) *bind.TransactOpts {
+	t.Helper()
+
+	auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(harnessChainId))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return auth
+}
+
+func harnessMined(t *testing.T, client *ethclient.Client, tx *types.Transaction, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), harnessTxTimeout)
+	defer cancel()
+
+	receipt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("tx %s reverted", tx.Hash().Hex())
+	}
+}
+
+func harnessEther(amount int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(amount), big.NewInt(1e18))
+}
@@ -1,57 +1,133 @@
 package metis_simple_arbitrage
 
 import (
-	"context"
-	"crypto/ecdsa"
+	"encoding/json"
 	"math/big"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
-	"github.com/cryptotriv/raikiri/gen/FlashUniswapQueryV1"
+	"github.com/cryptotriv/raikiri/gen/IHermesBaseV1PairEvents"
+	"github.com/cryptotriv/raikiri/gen/IUniswapV2PairEvents"
 	"github.com/cryptotriv/raikiri/gen/TokenProvidenceV1"
 	"github.com/cryptotriv/raikiri/lib/ethmarket"
 	"github.com/cryptotriv/raikiri/lib/models"
 	"github.com/cryptotriv/raikiri/lib/util"
-	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/loov/hrtime"
 	"go.uber.org/zap"
 )
 
-func initAllMarketData(flashQueryInstance *FlashUniswapQueryV1.FlashUniswapQueryV1) {
+// Loads the market json files the bot writes on startup
+func (s *botState) loadMarketSnapshot(basePath string) error {
+	s.resetMarketState()
+
+	files := []struct {
+		path string
+		data interface{}
+	}{
+		{MARKET_PAIRS_BY_TOKEN_JSON_PATH, &s.marketPairsByToken},
+		{ALL_MARKET_ADDRESSES_JSON_PATH, &s.allMarketAddresses},
+		{ALL_MARKET_RESERVES_JSON_PATH, &s.allMarketReserves},
+		{ALL_MARKET_ADDRESS_FACTORIES_JSON_PATH, &s.allMarketAddressFactories},
+		{MARKET_MAPPING_JSON_PATH, &s.marketMapping},
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(basePath, file.path))
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal(data, file.data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Forgets every market we know of
+func (s *botState) resetMarketState() {
+	s.allMarketAddresses = nil
+	s.allMarketAddressFactories = nil
+	s.allMarketReserves = nil
+	s.quarantinedMarkets = make(map[common.Address]string)
+	s.tokenRisks = make(map[common.Address]tokenRisk)
+	s.quarantinedTokens = make(map[common.Address]uint64)
+	s.blockStartReserves = make(map[common.Address]reserveBaseline)
+	s.lastReserveBlock = 0
+	s.marketPairsByToken = make(map[common.Address][]models.UniswappyV2Pair)
+	s.marketMapping = make(map[common.Address]models.MarketMapping)
+}
+
+// Parses the ABIs the bots decode events and pack calls with, only the first call does the work
+func initContractABIs() error {
+	contractABIsOnce.Do(func() {
+		contractABIsErr = parseContractABIs()
+	})
+
+	return contractABIsErr
+}
+
+func parseContractABIs() error {
+	var err error
+
+	uniswapV2ABI, err = abi.JSON(strings.NewReader(string(IUniswapV2PairEvents.IUniswapV2PairEventsABI)))
+	if err != nil {
+		return err
+	}
+
+	hermesV1ABI, err = abi.JSON(strings.NewReader(string(IHermesBaseV1PairEvents.IHermesBaseV1PairEventsABI)))
+	if err != nil {
+		return err
+	}
+
+	executorABI, err = abi.JSON(strings.NewReader(string(FlashSwapExecutorV1.FlashSwapExecutorV1ABI)))
+	if err != nil {
+		return err
+	}
+
+	tokenProvidenceABI, err = abi.JSON(strings.NewReader(string(TokenProvidenceV1.TokenProvidenceV1ABI)))
+	if err != nil {
+		return err
+	}
+
+	uniV2EventHash = crypto.Keccak256Hash([]byte("Sync(uint112,uint112)"))
+	hermesEventHash = crypto.Keccak256Hash([]byte("Sync(uint256,uint256)"))
+
+	return nil
+}
+
+// Pairs that fail the verifier's authenticity checks are left out, a nil verifier takes every pair
+func (s *botState) initAllMarketData(pairLister PairLister, verifier *pairVerifier) error {
+	factories := uniswapV2FactoryAddresses[:]
+
+	// Pairs come back in the same order however the scan was spread out
+	batchesByFactory, err := s.scanFactories(pairLister, factories)
+	if err != nil {
+		return err
+	}
+
 	// Repeat for each factory address
-	for _, factoryAddress := range uniswapV2FactoryAddresses {
-		logger.Info("Querying for Factory Address: ", zap.String("factoryAddress", factoryAddress))
+	for factoryIndex, factoryAddress := range factories {
 		totalPairs := 0
 
-		// Repeat for multiple batches, call getPairsByIndexRange
-		for count := 0; count < BATCH_COUNT_LIMIT*UNISWAP_BATCH_SIZE; count += UNISWAP_BATCH_SIZE {
-			batch, err := flashQueryInstance.GetPairsByIndexRange(nil, common.HexToAddress(factoryAddress), big.NewInt(int64(count)), big.NewInt(int64(count+UNISWAP_BATCH_SIZE)))
-			if err != nil {
-				logger.Error("Error querying for pairs", zap.Error(err))
-				exit = true
-			}
-
-			totalPairs += len(batch)
+		var candidates []models.UniswappyV2Pair
+		var candidatePairs [][3]common.Address
 
-			var addressFilter []common.Address
-			var pairIsStable []bool
+		for _, scanned := range batchesByFactory[factoryIndex] {
+			batch := scanned.pairs
+			pairIsStable := scanned.isStable
 
-			// Prepare to filter batch if these are Hermes pairs
-			if factoryAddress == HERMES_FACTORY_ADDRESS {
-				for _, pair := range batch {
-					addressFilter = append(addressFilter, pair[2])
-				}
-				pairIsStable, err = flashQueryInstance.FilterVolatileHermesPairs(nil, addressFilter)
-				if err != nil {
-					logger.Error("Error querying for Hermes pairs", zap.Error(err))
-					exit = true
-				}
-			}
+			totalPairs += len(batch)
 
 			for index, pair := range batch {
 				metisIndex, tokenIndex := getTokenIndexesInPair(pair[0], pair[1])
@@ -63,7 +139,7 @@ func initAllMarketData(flashQueryInstance *FlashUniswapQueryV1.FlashUniswapQuery
 				metisAddress := pair[metisIndex]
 
 				// Check if token is banned
-				if addressInSlice(tokenAddress, bannedTokenAddresses) {
+				if addressInSlice(tokenAddress, s.bannedTokenAddresses) {
 					continue
 				}
 
@@ -78,7 +154,7 @@ func initAllMarketData(flashQueryInstance *FlashUniswapQueryV1.FlashUniswapQuery
 				}
 
 				// Call reserves to see if it reverts
-				// _, err := flashQueryInstance.GetReservesByPairs(nil, []common.Address{pair[2]})
+				// _, err := reserveSource.GetReserves(nil, []common.Address{pair[2]})
 				// if err != nil {
 				// 	logger.Error("Error querying for reserves", zap.String("address", pair[2].Hex()), zap.Error(err))
 				// 	continue
@@ -88,135 +164,175 @@ func initAllMarketData(flashQueryInstance *FlashUniswapQueryV1.FlashUniswapQuery
 				uniswapV2Pair := models.UniswappyV2Pair{
 					MarketAdress:       pair[2],
 					Factory:            common.HexToAddress(factoryAddress),
-					FeePerTenThousands: uniswapV2FactoryAddressFeePerTenThousands[factoryAddress],
+					FeePerTenThousands: s.feePerTenThousands[factoryAddress],
 					TokenAddresses:     [2]common.Address{pair[0], pair[1]},
 					WethAddress:        metisAddress,
 					NativeIndex:        metisIndex,
 					TokenIndex:         tokenIndex}
 
-				marketPairsByToken[tokenAddress] = append(marketPairsByToken[tokenAddress], uniswapV2Pair)
-				allMarketAddresses = append(allMarketAddresses, pair[2])
+				candidates = append(candidates, uniswapV2Pair)
+				candidatePairs = append(candidatePairs, pair)
 			}
+		}
 
-			if len(batch) < UNISWAP_BATCH_SIZE {
-				break // We have queried all available markets for this factory address
+		// Only pairs the factory really deployed get near our executor
+		rejections := make([]error, len(candidates))
+		if verifier != nil {
+			rejections, err = verifier.verifyPairs(common.HexToAddress(factoryAddress), factoryAddress == HERMES_FACTORY_ADDRESS, candidatePairs)
+			if err != nil {
+				return err
+			}
+		}
+
+		for index, uniswapV2Pair := range candidates {
+			if rejections[index] != nil {
+				s.quarantinedMarkets[uniswapV2Pair.MarketAdress] = rejections[index].Error()
+				s.logger.Warn("Pair is not genuine - removed from markets", zap.String("marketAddress", uniswapV2Pair.MarketAdress.Hex()), zap.Error(rejections[index]))
+				continue
 			}
+
+			tokenAddress := uniswapV2Pair.TokenAddresses[uniswapV2Pair.TokenIndex]
+			s.marketPairsByToken[tokenAddress] = append(s.marketPairsByToken[tokenAddress], uniswapV2Pair)
+			s.allMarketAddresses = append(s.allMarketAddresses, uniswapV2Pair.MarketAdress)
 		}
 
-		logger.Info("Total pairs for the factory address: ", zap.Int("totalPairs", totalPairs))
+		s.logger.Info("Total pairs for the factory address: ", zap.String("factoryAddress", factoryAddress), zap.Int("totalPairs", totalPairs))
 	}
+
+	return nil
 }
 
-func updateReserves(flashQueryInstance *FlashUniswapQueryV1.FlashUniswapQueryV1) {
+func (s *botState) updateReserves(reserveSource ReserveSource) {
 	var start time.Duration
 
-	if !config.PerformanceMode {
+	if !s.config.PerformanceMode {
 		start = hrtime.Now()
 	}
 
 	// We update reserves
-	var err error
-	allMarketReserves, err = flashQueryInstance.GetReservesByPairs(nil, allMarketAddresses)
+	// The read pool already tried every endpoint, keep the reserves we have and retry on the next update
+	marketReserves, excluded, err := fetchReserves(reserveSource, nil, s.allMarketAddresses)
 	if err != nil {
-		logger.Error("Error querying for reserves", zap.Error(err))
-		exit = true
+		s.logger.Error("Error querying for reserves", zap.Error(err))
+		return
 	}
 
-	logger.Info("Update All Reserves", zap.String("duration", hrtime.Since(start).String()))
+	// Only once the markets are set up, before that the indexes are still moving
+	if len(s.marketMapping) > 0 {
+		blockNumber := s.readClient.head()
+		if blockNumber > s.lastReserveBlock {
+			s.lastReserveBlock = blockNumber
+		}
+		s.checkReserveAnomalies(s.allMarketReserves, marketReserves, s.lastReserveBlock)
+	}
+
+	s.allMarketReserves = marketReserves
+
+	// One broken pool shouldn't take the others down with it
+	s.quarantineMarkets(excluded)
+
+	s.journal.recordReserves(s.readClient.head(), s.allMarketReserves)
+
+	s.syncLocalEVMReserves()
+
+	s.logger.Info("Update All Reserves", zap.String("duration", hrtime.Since(start).String()))
 }
 
-func updateReservesBatched(flashQueryInstance *FlashUniswapQueryV1.FlashUniswapQueryV1) {
+func (s *botState) updateReservesBatched(reserveSource ReserveSource) error {
 	var start time.Duration
 
-	if !config.PerformanceMode {
+	if !s.config.PerformanceMode {
 		start = hrtime.Now()
 	}
 
 	// We update reserves
-	batches := len(allMarketAddresses) / 200
-	modulus := len(allMarketAddresses) % 200
-
-	logger.Info("Update All Reserves", zap.Int("length", len(allMarketAddresses)), zap.Int("batches", batches), zap.Int("remainder", modulus))
+	s.logger.Info("Update All Reserves", zap.Int("length", len(s.allMarketAddresses)), zap.Int("batchSize", RESERVE_BATCH_SIZE))
 
-	for count := 0; count < batches+1; count++ {
-		var length int
+	marketReserves, excluded, err := fetchReserves(reserveSource, nil, s.allMarketAddresses)
+	if err != nil {
+		return err
+	}
 
-		if count == batches {
-			length = modulus
-		} else {
-			length = 200
-		}
+	s.allMarketReserves = marketReserves
 
-		marketReserves, err := flashQueryInstance.GetReservesByPairs(nil, allMarketAddresses[count*200:(count*200)+length])
-		if err != nil {
-			logger.Error("Error querying for batched reserves", zap.Error(err))
-			exit = true
-		}
+	s.quarantineMarkets(excluded)
 
-		allMarketReserves = append(allMarketReserves, marketReserves...)
-	}
+	s.logger.Info("Update All Reserves", zap.String("duration", hrtime.Since(start).String()))
 
-	logger.Info("Update All Reserves", zap.String("duration", hrtime.Since(start).String()))
+	return nil
 }
 
 // Only called when event IsBlock is false
-func updateReservesByEvent(vLog types.Log) common.Address {
+func (s *botState) updateReservesByEvent(vLog types.Log) common.Address {
+
+	var reservesUpdate models.ReservesSyncEvent
 
 	// Unpack accordingly
 	if vLog.Topics[0] == hermesEventHash {
 		err := hermesV1ABI.UnpackIntoInterface(&reservesUpdate, "Sync", vLog.Data)
 		if err != nil {
-			logger.Error("Error unpacking hermesEventHash", zap.Error(err))
-			exit = true
+			// Leave the reserves as they are, the next full update fixes them
+			s.logger.Error("Error unpacking hermesEventHash", zap.Error(err))
+			return common.Address{}
 		}
 	} else {
 		err := uniswapV2ABI.UnpackIntoInterface(&reservesUpdate, "Sync", vLog.Data)
 		if err != nil {
-			logger.Error("Error unpacking uniswapV2", zap.Error(err))
-			exit = true
+			s.logger.Error("Error unpacking uniswapV2", zap.Error(err))
+			return common.Address{}
 		}
 	}
 
-	mapping := marketMapping[vLog.Address]
-	pair := marketPairsByToken[mapping.TokenAddress][mapping.Index]
+	// Quarantined markets can still have logs in flight
+	mapping, ok := s.marketMapping[vLog.Address]
+	if !ok {
+		return common.Address{}
+	}
+	pair := s.marketPairsByToken[mapping.TokenAddress][mapping.Index]
+
+	if vLog.BlockNumber > s.lastReserveBlock {
+		s.lastReserveBlock = vLog.BlockNumber
+	}
+
+	// Rugs and wild moves look like huge arbs, keep away from the token for a while
+	baseline := s.blockBaseline(vLog.Address, vLog.BlockNumber, s.allMarketReserves[pair.TokenReserveIndex])
+	reason := s.reserveAnomaly(pair, baseline, reservesUpdate.Reserve0, reservesUpdate.Reserve1)
+	if reason != "" {
+		s.quarantineToken(mapping.TokenAddress, vLog.Address, vLog.BlockNumber, reason)
+	}
 
 	// Update reserves
-	allMarketReserves[pair.TokenReserveIndex][0] = new(big.Int).Set(reservesUpdate.Reserve0)
-	allMarketReserves[pair.TokenReserveIndex][1] = new(big.Int).Set(reservesUpdate.Reserve1)
-	allMarketReserves[pair.TokenReserveIndex][2] = UPDATED_RESERVE
+	s.allMarketReserves[pair.TokenReserveIndex][0] = new(big.Int).Set(reservesUpdate.Reserve0)
+	s.allMarketReserves[pair.TokenReserveIndex][1] = new(big.Int).Set(reservesUpdate.Reserve1)
+	s.allMarketReserves[pair.TokenReserveIndex][2] = UPDATED_RESERVE
+
+	if s.localEVM != nil {
+		s.localEVM.syncReserves(vLog.Address, reservesUpdate.Reserve0, reservesUpdate.Reserve1)
+	}
 
 	// Update prices
-	// How much token will I get from BASE_WEI Metis
-	marketPairsByToken[mapping.TokenAddress][mapping.Index].SellWethPrice = ethmarket.GetAmountOut(allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
-		allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
-		BASE_WEI,
+	// How much token will I get from baseWei Metis
+	s.marketPairsByToken[mapping.TokenAddress][mapping.Index].SellWethPrice = ethmarket.GetAmountOut(s.allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
+		s.allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
+		s.baseWei,
 		pair.FeePerTenThousands)
 
-	// How much token do I need to buy back BASE_WEI Metis
-	marketPairsByToken[mapping.TokenAddress][mapping.Index].BuyWethPrice = ethmarket.GetAmountIn(allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
-		allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
-		BASE_WEI,
+	// How much token do I need to buy back baseWei Metis
+	s.marketPairsByToken[mapping.TokenAddress][mapping.Index].BuyWethPrice = ethmarket.GetAmountIn(s.allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
+		s.allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
+		s.baseWei,
 		pair.FeePerTenThousands)
 
 	return mapping.TokenAddress
 }
 
-func filterMarkets(
-	flashQueryInstance *FlashUniswapQueryV1.FlashUniswapQueryV1,
-	tokenProvidenceContract *TokenProvidenceV1.TokenProvidenceV1,
-	privateKey *ecdsa.PrivateKey,
-	chainId *big.Int,
-	nonce uint64,
-	gasPrice *big.Int,
-	fromAddress common.Address,
-	tokenProvidenceAddress common.Address,
-	readClient *ethclient.Client) {
+func (s *botState) filterMarkets(reserveSource ReserveSource, healthChecker HealthChecker) {
 	// Here, we repeat through all pairs in marketPairsByToken, find their position in allMarketAddresses and assign an index
-	for token, pairs := range marketPairsByToken {
+	for token, pairs := range s.marketPairsByToken {
 		for pairCount, pair := range pairs {
-			for marketIndex, marketAddress := range allMarketAddresses {
+			for marketIndex, marketAddress := range s.allMarketAddresses {
 				if pair.MarketAdress == marketAddress {
-					marketPairsByToken[token][pairCount].TokenReserveIndex = marketIndex
+					s.marketPairsByToken[token][pairCount].TokenReserveIndex = marketIndex
 					break
 				}
 			}
@@ -226,12 +342,12 @@ func filterMarkets(
 	var newMarketPairsByTokenWithMinAmounts map[common.Address][]models.UniswappyV2Pair = make(map[common.Address][]models.UniswappyV2Pair)
 
 	// Make sure Metis reserve greater than minimum
-	for token, pairs := range marketPairsByToken {
+	for token, pairs := range s.marketPairsByToken {
 		for _, pair := range pairs {
-			metisReserve := allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex]
-			tokenReserve := allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex]
+			metisReserve := s.allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex]
+			tokenReserve := s.allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex]
 
-			if metisReserve.Cmp(MIN_NATIVE_AMOUNT_WEI) >= 0 && tokenReserve.Cmp(big.NewInt(100)) >= 0 {
+			if metisReserve.Cmp(s.minNativeAmountWei) >= 0 && tokenReserve.Cmp(big.NewInt(100)) >= 0 {
 				newMarketPairsByTokenWithMinAmounts[token] = append(newMarketPairsByTokenWithMinAmounts[token], pair)
 			}
 		}
@@ -246,22 +362,19 @@ func filterMarkets(
 		}
 	}
 
+	// Drop tokens whose owner can turn on us, going by their bytecode
+	s.excludeRiskyTokens(newMarketPairsByToken)
+
 	// Do health check for each token
 	var newAllMarketAddresses []common.Address
 	var newHealthyMarketPairsByToken map[common.Address][]models.UniswappyV2Pair = make(map[common.Address][]models.UniswappyV2Pair)
 	var newAllMarketAddressFactories []common.Address
 
 	for token, pairs := range newMarketPairsByToken {
-		if tokenIsHealthy(token,
-			pairs[0],
-			tokenProvidenceContract,
-			privateKey,
-			chainId,
-			nonce,
-			gasPrice,
-			fromAddress,
-			tokenProvidenceAddress,
-			readClient) {
+		err := healthChecker.CheckToken(token, pairs[0])
+		if err != nil {
+			s.logger.Info("Token is unhealthy - removed from markets", zap.String("tokenAddress", token.Hex()), zap.Error(err))
+		} else {
 			newHealthyMarketPairsByToken[token] = append(newHealthyMarketPairsByToken[token], pairs...)
 
 			for _, pair := range pairs {
@@ -271,21 +384,21 @@ func filterMarkets(
 		}
 	}
 
-	// Assign new to global vars
-	marketPairsByToken = newHealthyMarketPairsByToken
-	allMarketAddresses = newAllMarketAddresses
-	allMarketAddressFactories = newAllMarketAddressFactories
+	// Assign new to the state
+	s.marketPairsByToken = newHealthyMarketPairsByToken
+	s.allMarketAddresses = newAllMarketAddresses
+	s.allMarketAddressFactories = newAllMarketAddressFactories
 
 	// Here we update reserves again for our new allMarketAddresses
-	updateReserves(flashQueryInstance)
+	s.updateReserves(reserveSource)
 
 	// Here, we repeat through all pairs in marketPairsByToken, find their position in allMarketAddresses and assign an index
 	// We do this again since markets have been filtered out
-	for token, pairs := range marketPairsByToken {
+	for token, pairs := range s.marketPairsByToken {
 		for pairCount, pair := range pairs {
-			for marketIndex, marketAddress := range allMarketAddresses {
+			for marketIndex, marketAddress := range s.allMarketAddresses {
 				if pair.MarketAdress == marketAddress {
-					marketPairsByToken[token][pairCount].TokenReserveIndex = marketIndex
+					s.marketPairsByToken[token][pairCount].TokenReserveIndex = marketIndex
 					break
 				}
 			}
@@ -293,73 +406,23 @@ func filterMarkets(
 	}
 }
 
-func tokenIsHealthy(
-	token common.Address,
-	pair models.UniswappyV2Pair,
-	tokenProvidenceContract *TokenProvidenceV1.TokenProvidenceV1,
-	privateKey *ecdsa.PrivateKey,
-	chainId *big.Int,
-	nonce uint64,
-	gasPrice *big.Int,
-	fromAddress common.Address,
-	tokenProvidenceAddress common.Address,
-	readClient *ethclient.Client) bool {
-
-	// Setup transaction
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainId)
-	if err != nil {
-		logger.Error("Error creating auth", zap.Error(err))
-		exit = true
-	}
-
-	auth.Nonce = big.NewInt(int64(nonce))
-	auth.Value = util.ToWei(0.1, 18) // in wei
-	auth.GasLimit = uint64(3000000)  // in units
-	auth.GasPrice = gasPrice
-	auth.NoSend = true
-
-	// Build transaction
-	simulateTx, err := tokenProvidenceContract.HealthCheck(
-		auth,
-		pair.MarketAdress,
-		token,
-		big.NewInt(pair.FeePerTenThousands))
-
-	if err != nil {
-		logger.Info("Failed to generate simmulation tx", zap.Error(err))
-		return false
-	}
-
-	// Estimate gas used
-	msg := ethereum.CallMsg{
-		From:     fromAddress,
-		To:       &tokenProvidenceAddress,
-		Gas:      simulateTx.Gas(),
-		GasPrice: simulateTx.GasPrice(),
-		Value:    simulateTx.Value(),
-		Data:     simulateTx.Data(),
-	}
-
-	// Simulate transaction
-	_, err = readClient.CallContract(context.Background(), msg, nil)
-	if err != nil {
-		logger.Info("Token is unhealthy - removed from markets", zap.String("tokenAddress", token.Hex()), zap.Error(err))
-		return false
-	}
+func (s *botState) calculateMinProfit() {
+	s.minProfitWei, s.minProfitWeiFollowUp = minProfitFor(s.minGasGwei, FAILURE_BUFFER_MULTIPLIER, MIN_PROFIT_FOLLOWUP_DIVISOR)
 
-	return true
+	s.logger.Info("Min profit: ", zap.String("minProfit", util.ToDecimal(s.minProfitWei, 18).String()))
+	s.logger.Info("Min follow-up profit: ", zap.String("minProfitFollowUp", util.ToDecimal(s.minProfitWeiFollowUp, 18).String()))
 }
 
-func calculateMinProfit() {
-	txCost := big.NewInt(0).Mul(big.NewInt(0).Add(MIN_GAS_GWEI, util.ToWei(MIN_GAS_GWEI_BUFFER, 9)), big.NewInt(ARB_FAILURE_GAS_COST))
-	MIN_PROFIT_WEI = txCost.Mul(txCost, big.NewInt(FAILURE_BUFFER_MULTIPLIER))
-	MIN_PROFIT_WEI_FOLLOWUP = big.NewInt(0).Div(MIN_PROFIT_WEI, big.NewInt(MIN_PROFIT_FOLLOWUP_DIVISOR))
+// Enough profit to pay for failureBufferMultiplier failed txs at this gas price
+func minProfitFor(gasPrice *big.Int, failureBufferMultiplier int64, followUpDivisor int64) (*big.Int, *big.Int) {
+	txCost := big.NewInt(0).Mul(big.NewInt(0).Add(gasPrice, util.ToWei(MIN_GAS_GWEI_BUFFER, 9)), big.NewInt(ARB_FAILURE_GAS_COST))
+	minProfit := txCost.Mul(txCost, big.NewInt(failureBufferMultiplier))
+	minProfitFollowUp := big.NewInt(0).Div(minProfit, big.NewInt(followUpDivisor))
 
-	logger.Info("Min profit: ", zap.String("minProfit", util.ToDecimal(MIN_PROFIT_WEI, 18).String()))
-	logger.Info("Min follow-up profit: ", zap.String("minProfitFollowUp", util.ToDecimal(MIN_PROFIT_WEI_FOLLOWUP, 18).String()))
+	return minProfit, minProfitFollowUp
 }
 
-func evaluateMarketsRecursive(isFollowUp bool, tokenAddress common.Address, depth int) []FlashSwapExecutorV1.Arb {
+func (s *botState) evaluateMarketsRecursive(isFollowUp bool, tokenAddress common.Address, depth int) []FlashSwapExecutorV1.Arb {
 	// If we're updating via Sync events, we already priced it in updateReservesByEvent
 	// Now cross all of them and find those with profit potential
 	var arbs []FlashSwapExecutorV1.Arb
@@ -369,9 +432,13 @@ func evaluateMarketsRecursive(isFollowUp bool, tokenAddress common.Address, dept
 
 	var crossedMarkets [][2]models.UniswappyV2Pair
 
-	for _, refPair := range marketPairsByToken[tokenAddress] {
-		for _, pair := range marketPairsByToken[tokenAddress] {
-			if isStaleReserves(refPair, pair) {
+	if s.isTokenQuarantined(tokenAddress) {
+		return arbs
+	}
+
+	for _, refPair := range s.marketPairsByToken[tokenAddress] {
+		for _, pair := range s.marketPairsByToken[tokenAddress] {
+			if s.isStaleReserves(refPair, pair) {
 				continue
 			} else if refPair.MarketAdress == pair.MarketAdress {
 				continue
@@ -390,23 +457,28 @@ func evaluateMarketsRecursive(isFollowUp bool, tokenAddress common.Address, dept
 		for i := 0; i < len(crossedMarkets); i++ {
 			// Find the optimal size for the crossed market
 			optimalSize := ethmarket.CalculateOptimalTokenInTwoFees(
-				allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].NativeIndex],
-				allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].TokenIndex],
-				allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].TokenIndex],
-				allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].NativeIndex],
+				s.allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].NativeIndex],
+				s.allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].TokenIndex],
+				s.allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].TokenIndex],
+				s.allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].NativeIndex],
 				crossedMarkets[i][1].FeePerTenThousands,
 				crossedMarkets[i][0].FeePerTenThousands).BigInt()
 
+			optimalSize = s.twapGuardSize(crossedMarkets[i][1], crossedMarkets[i][0], optimalSize)
+			if optimalSize == nil {
+				continue
+			}
+
 			// Calculate the profit from this optimal size
 			tokensOutFromBuyingSize := ethmarket.GetAmountOut(
-				allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].NativeIndex],
-				allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].TokenIndex],
+				s.allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].NativeIndex],
+				s.allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].TokenIndex],
 				optimalSize,
 				crossedMarkets[i][1].FeePerTenThousands)
 
 			proceedsFromSellingTokens := ethmarket.GetAmountOut(
-				allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].TokenIndex],
-				allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].NativeIndex],
+				s.allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].TokenIndex],
+				s.allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].NativeIndex],
 				tokensOutFromBuyingSize,
 				crossedMarkets[i][0].FeePerTenThousands)
 
@@ -414,7 +486,7 @@ func evaluateMarketsRecursive(isFollowUp bool, tokenAddress common.Address, dept
 
 			// Store in bestCrossedMarket the highest profit
 			// Or if it's the first market and passes minimum profit
-			if (profit.Cmp(MIN_PROFIT_WEI) > 0 && !isFollowUp) || (profit.Cmp(MIN_PROFIT_WEI_FOLLOWUP) > 0 && isFollowUp) {
+			if (profit.Cmp(s.minProfitWei) > 0 && !isFollowUp) || (profit.Cmp(s.minProfitWeiFollowUp) > 0 && isFollowUp) {
 				if !profitOpportunityFound {
 					profitOpportunityFound = true
 
@@ -462,7 +534,13 @@ func evaluateMarketsRecursive(isFollowUp bool, tokenAddress common.Address, dept
 			}
 		}
 
-		if profitOpportunityFound {
+		// Check if splitting the trade across several pools beats the single best arb
+		routeArbs, routeCrossedMarkets, routeProfit := s.findSplitRoute(s.marketPairsByToken[tokenAddress], s.evaluationMinProfit(isFollowUp))
+
+		if len(routeArbs) > 1 && s.isBetterRoute(routeProfit, bestArb, profitOpportunityFound, isFollowUp) {
+			arbs = append(arbs, routeArbs...)
+			arbsCrossedMarkets = append(arbsCrossedMarkets, routeCrossedMarkets...)
+		} else if profitOpportunityFound {
 			arbs = append(arbs, bestArb)
 			arbsCrossedMarkets = append(arbsCrossedMarkets, bestArbCrossedMarkets)
 		}
@@ -473,21 +551,21 @@ func evaluateMarketsRecursive(isFollowUp bool, tokenAddress common.Address, dept
 	// }
 
 	// Only search follow up depth of 1
-	if len(arbs) > 0 && depth < 100 { //&& !isFollowUp {
+	if len(arbs) > 0 && depth < s.maxFollowUpDepth { //&& !isFollowUp {
 		// start = hrtime.Now()
 
 		for i := 0; i < len(arbs); i++ {
 			// Update reserves based on the bestArb
-			updateReserveByArb(arbs[i], arbsCrossedMarkets[i], false)
+			s.updateReserveByArb(arbs[i], arbsCrossedMarkets[i], false)
 		}
 
 		// Call this function again, and append if there is a follow-up arb
 		// Due to recursive function, it will keep calling until there are no more new arbs
-		followUpArbs := evaluateMarketsRecursive(true, tokenAddress, depth+1)
+		followUpArbs := s.evaluateMarketsRecursive(true, tokenAddress, depth+1)
 
 		for i := 0; i < len(arbs); i++ {
 			// Revert the calculation from bestArb
-			updateReserveByArb(arbs[i], arbsCrossedMarkets[i], true)
+			s.updateReserveByArb(arbs[i], arbsCrossedMarkets[i], true)
 		}
 
 		if len(followUpArbs) > 0 {
@@ -503,7 +581,7 @@ func evaluateMarketsRecursive(isFollowUp bool, tokenAddress common.Address, dept
 	return arbs
 }
 
-func evaluateMarketsRecursiveAll(isFollowUp bool, depth int) []FlashSwapExecutorV1.Arb {
+func (s *botState) evaluateMarketsRecursiveAll(isFollowUp bool, depth int) []FlashSwapExecutorV1.Arb {
 	// If we're updating via Sync events, we already priced it in updateReservesByEvent
 	// Now cross all of them and find those with profit potential
 	var arbs []FlashSwapExecutorV1.Arb
@@ -511,12 +589,16 @@ func evaluateMarketsRecursiveAll(isFollowUp bool, depth int) []FlashSwapExecutor
 
 	// start := hrtime.Now()
 
-	for _, pairs := range marketPairsByToken {
+	for token, pairs := range s.marketPairsByToken {
+		if s.isTokenQuarantined(token) {
+			continue
+		}
+
 		var crossedMarkets [][2]models.UniswappyV2Pair
 
 		for _, refPair := range pairs {
 			for _, pair := range pairs {
-				if isStaleReserves(refPair, pair) {
+				if s.isStaleReserves(refPair, pair) {
 					continue
 				} else if refPair.MarketAdress == pair.MarketAdress {
 					continue
@@ -535,23 +617,28 @@ func evaluateMarketsRecursiveAll(isFollowUp bool, depth int) []FlashSwapExecutor
 			for i := 0; i < len(crossedMarkets); i++ {
 				// Find the optimal size for the crossed market
 				optimalSize := ethmarket.CalculateOptimalTokenInTwoFees(
-					allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].NativeIndex],
-					allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].TokenIndex],
-					allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].TokenIndex],
-					allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].NativeIndex],
+					s.allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].NativeIndex],
+					s.allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].TokenIndex],
+					s.allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].TokenIndex],
+					s.allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].NativeIndex],
 					crossedMarkets[i][1].FeePerTenThousands,
 					crossedMarkets[i][0].FeePerTenThousands).BigInt()
 
+				optimalSize = s.twapGuardSize(crossedMarkets[i][1], crossedMarkets[i][0], optimalSize)
+				if optimalSize == nil {
+					continue
+				}
+
 				// Calculate the profit from this optimal size
 				tokensOutFromBuyingSize := ethmarket.GetAmountOut(
-					allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].NativeIndex],
-					allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].TokenIndex],
+					s.allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].NativeIndex],
+					s.allMarketReserves[crossedMarkets[i][1].TokenReserveIndex][crossedMarkets[i][1].TokenIndex],
 					optimalSize,
 					crossedMarkets[i][1].FeePerTenThousands)
 
 				proceedsFromSellingTokens := ethmarket.GetAmountOut(
-					allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].TokenIndex],
-					allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].NativeIndex],
+					s.allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].TokenIndex],
+					s.allMarketReserves[crossedMarkets[i][0].TokenReserveIndex][crossedMarkets[i][0].NativeIndex],
 					tokensOutFromBuyingSize,
 					crossedMarkets[i][0].FeePerTenThousands)
 
@@ -559,7 +646,7 @@ func evaluateMarketsRecursiveAll(isFollowUp bool, depth int) []FlashSwapExecutor
 
 				// Store in bestCrossedMarket the highest profit
 				// Or if it's the first market and passes minimum profit
-				if (profit.Cmp(MIN_PROFIT_WEI) > 0 && !isFollowUp) || (profit.Cmp(MIN_PROFIT_WEI_FOLLOWUP) > 0 && isFollowUp) {
+				if (profit.Cmp(s.minProfitWei) > 0 && !isFollowUp) || (profit.Cmp(s.minProfitWeiFollowUp) > 0 && isFollowUp) {
 					if !profitOpportunityFound {
 						profitOpportunityFound = true
 
@@ -607,7 +694,13 @@ func evaluateMarketsRecursiveAll(isFollowUp bool, depth int) []FlashSwapExecutor
 				}
 			}
 
-			if profitOpportunityFound {
+			// Check if splitting the trade across several pools beats the single best arb
+			routeArbs, routeCrossedMarkets, routeProfit := s.findSplitRoute(pairs, s.evaluationMinProfit(isFollowUp))
+
+			if len(routeArbs) > 1 && s.isBetterRoute(routeProfit, bestArb, profitOpportunityFound, isFollowUp) {
+				arbs = append(arbs, routeArbs...)
+				arbsCrossedMarkets = append(arbsCrossedMarkets, routeCrossedMarkets...)
+			} else if profitOpportunityFound {
 				arbs = append(arbs, bestArb)
 				arbsCrossedMarkets = append(arbsCrossedMarkets, bestArbCrossedMarkets)
 			}
@@ -619,21 +712,21 @@ func evaluateMarketsRecursiveAll(isFollowUp bool, depth int) []FlashSwapExecutor
 	// }
 
 	// Only search follow up depth of 1
-	if len(arbs) > 0 && depth < 100 { //&& !isFollowUp {
+	if len(arbs) > 0 && depth < s.maxFollowUpDepth { //&& !isFollowUp {
 		// start = hrtime.Now()
 
 		for i := 0; i < len(arbs); i++ {
 			// Update reserves based on the bestArb
-			updateReserveByArb(arbs[i], arbsCrossedMarkets[i], false)
+			s.updateReserveByArb(arbs[i], arbsCrossedMarkets[i], false)
 		}
 
 		// Call this function again, and append if there is a follow-up arb
 		// Due to recursive function, it will keep calling until there are no more new arbs
-		followUpArbs := evaluateMarketsRecursiveAll(true, depth+1)
+		followUpArbs := s.evaluateMarketsRecursiveAll(true, depth+1)
 
 		for i := 0; i < len(arbs); i++ {
 			// Revert the calculation from bestArb
-			updateReserveByArb(arbs[i], arbsCrossedMarkets[i], true)
+			s.updateReserveByArb(arbs[i], arbsCrossedMarkets[i], true)
 		}
 
 		if len(followUpArbs) > 0 {
@@ -649,45 +742,45 @@ func evaluateMarketsRecursiveAll(isFollowUp bool, depth int) []FlashSwapExecutor
 	return arbs
 }
 
-func updateReserveByArb(arb FlashSwapExecutorV1.Arb, crossedMarket [2]models.UniswappyV2Pair, isUndo bool) {
+func (s *botState) updateReserveByArb(arb FlashSwapExecutorV1.Arb, crossedMarket [2]models.UniswappyV2Pair, isUndo bool) {
 	// BuyFromPair: crossedMarket[1]
 	// SellToPair: crossedMarket[0]
 
 	// Update BuyFromPair reserves
-	for count, pair := range marketPairsByToken[crossedMarket[1].TokenAddresses[crossedMarket[1].TokenIndex]] {
+	for count, pair := range s.marketPairsByToken[crossedMarket[1].TokenAddresses[crossedMarket[1].TokenIndex]] {
 		if pair.MarketAdress == crossedMarket[1].MarketAdress {
 			// Update reserves
 			// Since we buy token from them, Native is added and Token is removed
 			// The inverse is done on Undo
 			if !isUndo {
 				if crossedMarket[1].Factory.Hex() == HERMES_FACTORY_ADDRESS {
-					allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex] = allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex].Add(allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex], arb.NativeInAmount).Sub(allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex], new(big.Int).Div(arb.NativeInAmount, big.NewInt(10000-uniswapV2FactoryAddressFeePerTenThousands[crossedMarket[1].TokenAddresses[crossedMarket[1].TokenIndex].Hex()])))
+					s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex] = s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex].Add(s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex], arb.NativeInAmount).Sub(s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex], new(big.Int).Div(arb.NativeInAmount, big.NewInt(10000-s.feePerTenThousands[crossedMarket[1].TokenAddresses[crossedMarket[1].TokenIndex].Hex()])))
 				} else {
-					allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex] = allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex].Add(allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex], arb.NativeInAmount)
+					s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex] = s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex].Add(s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex], arb.NativeInAmount)
 				}
-				allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].TokenIndex] = allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].TokenIndex].Sub(allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].TokenIndex], arb.TokenAmount)
-				allMarketReserves[crossedMarket[1].TokenReserveIndex][2] = UPDATED_RESERVE
+				s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].TokenIndex] = s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].TokenIndex].Sub(s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].TokenIndex], arb.TokenAmount)
+				s.allMarketReserves[crossedMarket[1].TokenReserveIndex][2] = UPDATED_RESERVE
 			} else {
 				if crossedMarket[1].Factory.Hex() == HERMES_FACTORY_ADDRESS {
-					allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex] = allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex].Add(allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex], new(big.Int).Div(arb.NativeInAmount, big.NewInt(10000-uniswapV2FactoryAddressFeePerTenThousands[crossedMarket[1].TokenAddresses[crossedMarket[1].TokenIndex].Hex()]))).Sub(allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex], arb.NativeInAmount)
+					s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex] = s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex].Add(s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex], new(big.Int).Div(arb.NativeInAmount, big.NewInt(10000-s.feePerTenThousands[crossedMarket[1].TokenAddresses[crossedMarket[1].TokenIndex].Hex()]))).Sub(s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex], arb.NativeInAmount)
 				} else {
-					allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex] = allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex].Sub(allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex], arb.NativeInAmount)
+					s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex] = s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex].Sub(s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].NativeIndex], arb.NativeInAmount)
 				}
-				allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].TokenIndex] = allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].TokenIndex].Add(allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].TokenIndex], arb.TokenAmount)
-				allMarketReserves[crossedMarket[1].TokenReserveIndex][2] = UPDATED_RESERVE
+				s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].TokenIndex] = s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].TokenIndex].Add(s.allMarketReserves[crossedMarket[1].TokenReserveIndex][crossedMarket[1].TokenIndex], arb.TokenAmount)
+				s.allMarketReserves[crossedMarket[1].TokenReserveIndex][2] = UPDATED_RESERVE
 			}
 
 			// Update prices
-			// How much token will I get from BASE_WEI Metis
-			marketPairsByToken[crossedMarket[1].TokenAddresses[crossedMarket[1].TokenIndex]][count].SellWethPrice = ethmarket.GetAmountOut(allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
-				allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
-				BASE_WEI,
+			// How much token will I get from baseWei Metis
+			s.marketPairsByToken[crossedMarket[1].TokenAddresses[crossedMarket[1].TokenIndex]][count].SellWethPrice = ethmarket.GetAmountOut(s.allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
+				s.allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
+				s.baseWei,
 				pair.FeePerTenThousands)
 
-			// How much token do I need to buy back BASE_WEI Metis
-			marketPairsByToken[crossedMarket[1].TokenAddresses[crossedMarket[1].TokenIndex]][count].BuyWethPrice = ethmarket.GetAmountIn(allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
-				allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
-				BASE_WEI,
+			// How much token do I need to buy back baseWei Metis
+			s.marketPairsByToken[crossedMarket[1].TokenAddresses[crossedMarket[1].TokenIndex]][count].BuyWethPrice = ethmarket.GetAmountIn(s.allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
+				s.allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
+				s.baseWei,
 				pair.FeePerTenThousands)
 
 			break
@@ -695,43 +788,43 @@ func updateReserveByArb(arb FlashSwapExecutorV1.Arb, crossedMarket [2]models.Uni
 	}
 
 	// Update SellToPair reserves
-	for count, pair := range marketPairsByToken[crossedMarket[0].TokenAddresses[crossedMarket[0].TokenIndex]] {
+	for count, pair := range s.marketPairsByToken[crossedMarket[0].TokenAddresses[crossedMarket[0].TokenIndex]] {
 		if pair.MarketAdress == crossedMarket[0].MarketAdress {
 			// Update reserves
 			// Since we sell token to them, Native is removed and Token is added
 			// The inverse is done on Undo
 			if !isUndo {
-				allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].NativeIndex] = allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].NativeIndex].Sub(allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].NativeIndex], arb.NativeOutAmount)
+				s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].NativeIndex] = s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].NativeIndex].Sub(s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].NativeIndex], arb.NativeOutAmount)
 				if crossedMarket[0].Factory.Hex() == HERMES_FACTORY_ADDRESS {
-					allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex] = allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex].Add(allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex], arb.TokenAmount).Sub(allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex], new(big.Int).Div(arb.TokenAmount, big.NewInt(10000-uniswapV2FactoryAddressFeePerTenThousands[crossedMarket[0].TokenAddresses[crossedMarket[0].TokenIndex].Hex()])))
+					s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex] = s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex].Add(s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex], arb.TokenAmount).Sub(s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex], new(big.Int).Div(arb.TokenAmount, big.NewInt(10000-s.feePerTenThousands[crossedMarket[0].TokenAddresses[crossedMarket[0].TokenIndex].Hex()])))
 				} else {
-					allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex] = allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex].Add(allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex], arb.TokenAmount)
+					s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex] = s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex].Add(s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex], arb.TokenAmount)
 
 				}
-				allMarketReserves[crossedMarket[0].TokenReserveIndex][2] = UPDATED_RESERVE
+				s.allMarketReserves[crossedMarket[0].TokenReserveIndex][2] = UPDATED_RESERVE
 			} else {
-				allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].NativeIndex] = allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].NativeIndex].Add(allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].NativeIndex], arb.NativeOutAmount)
+				s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].NativeIndex] = s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].NativeIndex].Add(s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].NativeIndex], arb.NativeOutAmount)
 				if crossedMarket[0].Factory.Hex() == HERMES_FACTORY_ADDRESS {
-					allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex] = allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex].Add(allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex], new(big.Int).Div(arb.TokenAmount, big.NewInt(10000-uniswapV2FactoryAddressFeePerTenThousands[crossedMarket[0].TokenAddresses[crossedMarket[0].TokenIndex].Hex()]))).Sub(allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex], arb.TokenAmount)
+					s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex] = s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex].Add(s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex], new(big.Int).Div(arb.TokenAmount, big.NewInt(10000-s.feePerTenThousands[crossedMarket[0].TokenAddresses[crossedMarket[0].TokenIndex].Hex()]))).Sub(s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex], arb.TokenAmount)
 
 				} else {
-					allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex] = allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex].Sub(allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex], arb.TokenAmount)
+					s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex] = s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex].Sub(s.allMarketReserves[crossedMarket[0].TokenReserveIndex][crossedMarket[0].TokenIndex], arb.TokenAmount)
 
 				}
-				allMarketReserves[crossedMarket[0].TokenReserveIndex][2] = UPDATED_RESERVE
+				s.allMarketReserves[crossedMarket[0].TokenReserveIndex][2] = UPDATED_RESERVE
 			}
 
 			// Update prices
-			// How much token will I get from BASE_WEI Metis
-			marketPairsByToken[crossedMarket[0].TokenAddresses[crossedMarket[0].TokenIndex]][count].SellWethPrice = ethmarket.GetAmountOut(allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
-				allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
-				BASE_WEI,
+			// How much token will I get from baseWei Metis
+			s.marketPairsByToken[crossedMarket[0].TokenAddresses[crossedMarket[0].TokenIndex]][count].SellWethPrice = ethmarket.GetAmountOut(s.allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
+				s.allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
+				s.baseWei,
 				pair.FeePerTenThousands)
 
-			// How much token do I need to buy back BASE_WEI Metis
-			marketPairsByToken[crossedMarket[0].TokenAddresses[crossedMarket[0].TokenIndex]][count].BuyWethPrice = ethmarket.GetAmountIn(allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
-				allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
-				BASE_WEI,
+			// How much token do I need to buy back baseWei Metis
+			s.marketPairsByToken[crossedMarket[0].TokenAddresses[crossedMarket[0].TokenIndex]][count].BuyWethPrice = ethmarket.GetAmountIn(s.allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
+				s.allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
+				s.baseWei,
 				pair.FeePerTenThousands)
 
 			break
@@ -739,42 +832,42 @@ func updateReserveByArb(arb FlashSwapExecutorV1.Arb, crossedMarket [2]models.Uni
 	}
 }
 
-func priceMarkets() {
-	for token, pairs := range marketPairsByToken {
+func (s *botState) priceMarkets() {
+	for token, pairs := range s.marketPairsByToken {
 		for count, pair := range pairs {
 			// Figure out prices with Metis as reference
 			// How much token will I get from 0.1 Metis
-			marketPairsByToken[token][count].SellWethPrice = ethmarket.GetAmountOut(allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
-				allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
-				BASE_WEI,
+			s.marketPairsByToken[token][count].SellWethPrice = ethmarket.GetAmountOut(s.allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
+				s.allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
+				s.baseWei,
 				pair.FeePerTenThousands)
 
 			// How much token do I need to buy back 0.1 Metis
-			marketPairsByToken[token][count].BuyWethPrice = ethmarket.GetAmountIn(allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
-				allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
-				BASE_WEI,
+			s.marketPairsByToken[token][count].BuyWethPrice = ethmarket.GetAmountIn(s.allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex],
+				s.allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex],
+				s.baseWei,
 				pair.FeePerTenThousands)
 		}
 	}
 }
 
-func isStaleReserves(buyFromPair models.UniswappyV2Pair, sellToPair models.UniswappyV2Pair) bool {
-	return allMarketReserves[buyFromPair.TokenReserveIndex][2].Cmp(STALE_RESERVE) == 0 && allMarketReserves[sellToPair.TokenReserveIndex][2].Cmp(STALE_RESERVE) == 0
+func (s *botState) isStaleReserves(buyFromPair models.UniswappyV2Pair, sellToPair models.UniswappyV2Pair) bool {
+	return s.allMarketReserves[buyFromPair.TokenReserveIndex][2].Cmp(STALE_RESERVE) == 0 && s.allMarketReserves[sellToPair.TokenReserveIndex][2].Cmp(STALE_RESERVE) == 0
 }
 
-func markReservesAsStale() {
+func (s *botState) markReservesAsStale() {
 	// We use index 2 (which are reserve updated timestamps from our FlashQuery) to indicate stale and updated reserves
 	// Later, we skip stale reserves because we should have previously analyzed them and found no opportunities
-	for count := range allMarketReserves {
-		allMarketReserves[count][2] = STALE_RESERVE
+	for count := range s.allMarketReserves {
+		s.allMarketReserves[count][2] = STALE_RESERVE
 	}
 }
 
-func mapMarketAddresses() {
+func (s *botState) mapMarketAddresses() {
 	// Create mapping
-	for tokenAddress, pairs := range marketPairsByToken {
+	for tokenAddress, pairs := range s.marketPairsByToken {
 		for count, pair := range pairs {
-			marketMapping[pair.MarketAdress] = models.MarketMapping{
+			s.marketMapping[pair.MarketAdress] = models.MarketMapping{
 				TokenAddress: tokenAddress,
 				Index:        count,
 			}
@@ -782,14 +875,14 @@ func mapMarketAddresses() {
 	}
 }
 
-func sortMartkets() {
+func (s *botState) sortMartkets() {
 	// Sort each token market pair by their liquidity
 	// If there is imbalance, the first arb we find would be between two most liquid pairs
-	for token, pairs := range marketPairsByToken {
+	for token, pairs := range s.marketPairsByToken {
 		sort.Slice(pairs, func(i, j int) bool {
-			return allMarketReserves[pairs[i].TokenReserveIndex][pairs[i].NativeIndex].Cmp(allMarketReserves[pairs[j].TokenReserveIndex][pairs[j].NativeIndex]) > 0
+			return s.allMarketReserves[pairs[i].TokenReserveIndex][pairs[i].NativeIndex].Cmp(s.allMarketReserves[pairs[j].TokenReserveIndex][pairs[j].NativeIndex]) > 0
 		})
 
-		marketPairsByToken[token] = pairs
+		s.marketPairsByToken[token] = pairs
 	}
 }
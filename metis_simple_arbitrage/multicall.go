@@ -0,0 +1,409 @@
+package metis_simple_arbitrage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Only the views we read, so we don't need bindings for every DEX
+const (
+	viewPairABI = `[
+		{"name":"getReserves","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"reserve0","type":"uint112"},{"name":"reserve1","type":"uint112"},{"name":"blockTimestampLast","type":"uint32"}]},
+		{"name":"token0","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+		{"name":"token1","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+		{"name":"factory","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+		{"name":"price0CumulativeLast","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+		{"name":"price1CumulativeLast","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+		{"name":"metadata","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"dec0","type":"uint256"},{"name":"dec1","type":"uint256"},{"name":"r0","type":"uint256"},{"name":"r1","type":"uint256"},{"name":"st","type":"bool"},{"name":"t0","type":"address"},{"name":"t1","type":"address"}]}
+	]`
+	viewFactoryABI = `[
+		{"name":"allPairsLength","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+		{"name":"allPairs","type":"function","stateMutability":"view","inputs":[{"name":"","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},
+		{"name":"getPair","type":"function","stateMutability":"view","inputs":[{"name":"","type":"address"},{"name":"","type":"address"}],"outputs":[{"name":"","type":"address"}]}
+	]`
+	// Hermes keeps a stable and a volatile pair for the same tokens
+	viewHermesFactoryABI = `[
+		{"name":"getPair","type":"function","stateMutability":"view","inputs":[{"name":"","type":"address"},{"name":"","type":"address"},{"name":"","type":"bool"}],"outputs":[{"name":"","type":"address"}]}
+	]`
+	// Uniswap forks name their pair init code hash differently, Solidly forks like Hermes have pairCodeHash
+	viewInitCodeHashABI = `[
+		{"name":"INIT_CODE_PAIR_HASH","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]},
+		{"name":"INIT_CODE_HASH","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]},
+		{"name":"pairCodeHash","type":"function","stateMutability":"pure","inputs":[],"outputs":[{"name":"","type":"bytes32"}]}
+	]`
+	multicall3ABI = `[
+		{"name":"aggregate3","type":"function","stateMutability":"payable","inputs":[{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}]}],"outputs":[{"name":"returnData","type":"tuple[]","components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}]}]}
+	]`
+)
+
+// The target answered but not like a pair would
+var errBadPairOutput = errors.New("bad pair output")
+
+type viewCall struct {
+	to   common.Address
+	data []byte
+}
+
+type multicallCall struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicallResult struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// Reads reserves and pairs with plain view calls on the pairs and factories themselves
+// Batched either through a Multicall3 aggregate or a JSON-RPC batch of eth_calls, so it runs on chains without our query contract
+type viewCallSource struct {
+	readClient  *readPool
+	multicall   common.Address
+	useRPCBatch bool
+
+	pairABI      abi.ABI
+	factoryABI   abi.ABI
+	multicallABI abi.ABI
+}
+
+func newViewCallSource(readClient *readPool, multicall common.Address, useRPCBatch bool) (*viewCallSource, error) {
+	s := &viewCallSource{readClient: readClient, multicall: multicall, useRPCBatch: useRPCBatch}
+
+	var err error
+	s.pairABI, err = abi.JSON(strings.NewReader(viewPairABI))
+	if err != nil {
+		return nil, err
+	}
+
+	s.factoryABI, err = abi.JSON(strings.NewReader(viewFactoryABI))
+	if err != nil {
+		return nil, err
+	}
+
+	s.multicallABI, err = abi.JSON(strings.NewReader(multicall3ABI))
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *viewCallSource) GetReserves(callOpts *bind.CallOpts, pairs []common.Address) ([][3]*big.Int, error) {
+	outputs, err := s.callEach(callOpts, s.pairABI, "getReserves", pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	reserves := make([][3]*big.Int, len(pairs))
+	for i, output := range outputs {
+		values, err := s.pairABI.Unpack("getReserves", output)
+		if err != nil {
+			return nil, fmt.Errorf("%w: getReserves of %s: %v", errBadPairOutput, pairs[i].Hex(), err)
+		}
+
+		reserves[i] = [3]*big.Int{values[0].(*big.Int), values[1].(*big.Int), new(big.Int).SetUint64(uint64(values[2].(uint32)))}
+	}
+
+	return reserves, nil
+}
+
+func (s *viewCallSource) PairCount(callOpts *bind.CallOpts, factory common.Address) (*big.Int, error) {
+	data, err := s.factoryABI.Pack("allPairsLength")
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := s.call(callOpts, []viewCall{{to: factory, data: data}})
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := s.factoryABI.Unpack("allPairsLength", outputs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return values[0].(*big.Int), nil
+}
+
+// Same range rules as getPairsByIndexRange in our query contract
+func (s *viewCallSource) ListPairs(callOpts *bind.CallOpts, factory common.Address, start *big.Int, end *big.Int) ([][3]common.Address, error) {
+	length, err := s.PairCount(callOpts, factory)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := new(big.Int).Set(end)
+	if stop.Cmp(length) > 0 {
+		stop.Set(length)
+	}
+	if stop.Cmp(start) < 0 {
+		return nil, errors.New("start cannot be higher than stop")
+	}
+
+	var calls []viewCall
+	for i := new(big.Int).Set(start); i.Cmp(stop) < 0; i.Add(i, big.NewInt(1)) {
+		data, err := s.factoryABI.Pack("allPairs", new(big.Int).Set(i))
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, viewCall{to: factory, data: data})
+	}
+
+	outputs, err := s.call(callOpts, calls)
+	if err != nil {
+		return nil, err
+	}
+
+	pairAddresses := make([]common.Address, len(outputs))
+	for i, output := range outputs {
+		values, err := s.factoryABI.Unpack("allPairs", output)
+		if err != nil {
+			return nil, err
+		}
+		pairAddresses[i] = values[0].(common.Address)
+	}
+
+	token0s, err := s.addressEach(callOpts, "token0", pairAddresses)
+	if err != nil {
+		return nil, err
+	}
+
+	token1s, err := s.addressEach(callOpts, "token1", pairAddresses)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make([][3]common.Address, len(pairAddresses))
+	for i, pairAddress := range pairAddresses {
+		pairs[i] = [3]common.Address{token0s[i], token1s[i], pairAddress}
+	}
+
+	return pairs, nil
+}
+
+func (s *viewCallSource) StableHermesPairs(callOpts *bind.CallOpts, pairs []common.Address) ([]bool, error) {
+	outputs, err := s.callEach(callOpts, s.pairABI, "metadata", pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	stable := make([]bool, len(pairs))
+	for i, output := range outputs {
+		values, err := s.pairABI.Unpack("metadata", output)
+		if err != nil {
+			return nil, fmt.Errorf("metadata of %s: %w", pairs[i].Hex(), err)
+		}
+		stable[i] = values[4].(bool)
+	}
+
+	return stable, nil
+}
+
+func (s *viewCallSource) addressEach(callOpts *bind.CallOpts, method string, targets []common.Address) ([]common.Address, error) {
+	outputs, err := s.callEach(callOpts, s.pairABI, method, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]common.Address, len(outputs))
+	for i, output := range outputs {
+		values, err := s.pairABI.Unpack(method, output)
+		if err != nil {
+			return nil, fmt.Errorf("%s of %s: %w", method, targets[i].Hex(), err)
+		}
+		addresses[i] = values[0].(common.Address)
+	}
+
+	return addresses, nil
+}
+
+// The same argument-less view on every target
+func (s *viewCallSource) callEach(callOpts *bind.CallOpts, contractABI abi.ABI, method string, targets []common.Address) ([][]byte, error) {
+	data, err := contractABI.Pack(method)
+	if err != nil {
+		return nil, err
+	}
+
+	calls := make([]viewCall, len(targets))
+	for i, target := range targets {
+		calls[i] = viewCall{to: target, data: data}
+	}
+
+	return s.call(callOpts, calls)
+}
+
+// Runs the calls in batches, the outputs come back in the order of the calls
+// Any failing call fails the whole request, like a revert in our query contract would
+func (s *viewCallSource) call(callOpts *bind.CallOpts, calls []viewCall) ([][]byte, error) {
+	outputs, callErrs, err := s.batches(callOpts, calls, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, callErr := range callErrs {
+		if callErr != nil {
+			return nil, fmt.Errorf("call to %s: %w", calls[i].to.Hex(), callErr)
+		}
+	}
+
+	return outputs, nil
+}
+
+// Like call, but a failing call only fails its own entry
+func (s *viewCallSource) tryCall(callOpts *bind.CallOpts, calls []viewCall) ([][]byte, []error, error) {
+	return s.batches(callOpts, calls, true)
+}
+
+func (s *viewCallSource) batches(callOpts *bind.CallOpts, calls []viewCall, allowFailure bool) ([][]byte, []error, error) {
+	if callOpts == nil {
+		callOpts = &bind.CallOpts{}
+	}
+
+	ctx := callOpts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var outputs [][]byte
+	var callErrs []error
+	for start := 0; start < len(calls); start += VIEW_CALL_BATCH_SIZE {
+		end := start + VIEW_CALL_BATCH_SIZE
+		if end > len(calls) {
+			end = len(calls)
+		}
+
+		var batch [][]byte
+		var batchErrs []error
+		var err error
+		if s.useRPCBatch {
+			batch, batchErrs, err = s.rpcBatch(ctx, callOpts, calls[start:end])
+		} else {
+			batch, batchErrs, err = s.aggregate(ctx, callOpts, calls[start:end], allowFailure)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		outputs = append(outputs, batch...)
+		callErrs = append(callErrs, batchErrs...)
+	}
+
+	return outputs, callErrs, nil
+}
+
+func (s *viewCallSource) aggregate(ctx context.Context, callOpts *bind.CallOpts, calls []viewCall, allowFailure bool) ([][]byte, []error, error) {
+	multicallCalls := make([]multicallCall, len(calls))
+	for i, call := range calls {
+		multicallCalls[i] = multicallCall{Target: call.to, AllowFailure: allowFailure, CallData: call.data}
+	}
+
+	data, err := s.multicallABI.Pack("aggregate3", multicallCalls)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msg := ethereum.CallMsg{From: callOpts.From, To: &s.multicall, Data: data}
+
+	var output []byte
+	if callOpts.Pending {
+		output, err = s.readClient.PendingCallContract(ctx, msg)
+	} else {
+		output, err = s.readClient.CallContract(ctx, msg, callOpts.BlockNumber)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values, err := s.multicallABI.Unpack("aggregate3", output)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := *abi.ConvertType(values[0], new([]multicallResult)).(*[]multicallResult)
+	if len(results) != len(calls) {
+		return nil, nil, fmt.Errorf("multicall returned %d results for %d calls", len(results), len(calls))
+	}
+
+	outputs := make([][]byte, len(results))
+	callErrs := make([]error, len(results))
+	for i, result := range results {
+		outputs[i] = result.ReturnData
+		if !result.Success {
+			callErrs[i] = errors.New("execution reverted")
+		}
+	}
+
+	return outputs, callErrs, nil
+}
+
+func (s *viewCallSource) rpcBatch(ctx context.Context, callOpts *bind.CallOpts, calls []viewCall) ([][]byte, []error, error) {
+	block := "latest"
+	if callOpts.Pending {
+		block = "pending"
+	} else if callOpts.BlockNumber != nil {
+		block = hexutil.EncodeBig(callOpts.BlockNumber)
+	}
+
+	outputs := make([]hexutil.Bytes, len(calls))
+	batch := make([]rpc.BatchElem, len(calls))
+	for i, call := range calls {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args: []interface{}{
+				map[string]interface{}{"from": callOpts.From, "to": call.to, "data": hexutil.Bytes(call.data)},
+				block,
+			},
+			Result: &outputs[i],
+		}
+	}
+
+	err := s.readClient.BatchCallContext(ctx, batch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := make([][]byte, len(calls))
+	callErrs := make([]error, len(calls))
+	for i, elem := range batch {
+		results[i] = outputs[i]
+		callErrs[i] = elem.Error
+	}
+
+	return results, callErrs, nil
+}
+
+// Reserves and pairs together, so a single config switch picks both
+type chainSource interface {
+	ReserveSource
+	PairLister
+}
+
+// Only the flash query source needs a deployment of ours, lookup is called for it alone
+func newChainSource(sourceName string, readClient *readPool, lookup func(name string) (common.Address, error)) (chainSource, error) {
+	switch sourceName {
+	case "", RESERVE_SOURCE_FLASH_QUERY:
+		flashQueryAddress, err := lookup("FlashUniswapQueryV1")
+		if err != nil {
+			return nil, err
+		}
+		return newFlashQuerySource(flashQueryAddress, readClient)
+	case RESERVE_SOURCE_MULTICALL:
+		return newViewCallSource(readClient, common.HexToAddress(MULTICALL3_ADDRESS), false)
+	case RESERVE_SOURCE_RPC_BATCH:
+		return newViewCallSource(readClient, common.Address{}, true)
+	default:
+		return nil, errors.New("unknown reserve source: " + sourceName)
+	}
+}
@@ -0,0 +1,371 @@
+package metis_simple_arbitrage
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+// Where an executor account gets the nonces for its txs
+type nonceSource interface {
+	// The nonce the next tx would get, without reserving it
+	peek() uint64
+	reserve() uint64
+	markSent(nonce uint64, tx *types.Transaction)
+	release(nonce uint64, err error)
+	pendingTxs() []pendingTx
+	sync() error
+}
+
+// Paper trading never broadcasts, so it gets nonces that can't leave gaps behind
+func (s *botState) newNonceSource(address common.Address, privateKey *ecdsa.PrivateKey, chainId *big.Int) (nonceSource, error) {
+	if s.config.PaperTrading {
+		return s.newPaperNonceSource(address)
+	}
+
+	nonces, err := s.newNonceManager(address, privateKey, chainId)
+	if err != nil {
+		return nil, err
+	}
+
+	return nonces, nil
+}
+
+type pendingTx struct {
+	Nonce     uint64
+	Hash      common.Hash
+	GasPrice  *big.Int
+	GasTipCap *big.Int
+	SentAt    time.Time
+	IsCancel  bool
+}
+
+// Hands out nonces for our executor account and keeps track of every tx we sent until it is mined or dropped
+type nonceManager struct {
+	mu         sync.Mutex
+	address    common.Address
+	privateKey *ecdsa.PrivateKey
+	chainId    *big.Int
+	nextNonce  uint64
+	reserved   map[uint64]time.Time
+	ours       map[uint64]bool // Nonces we handed out ourselves, the only ones we may cancel
+	pending    map[uint64]pendingTx
+	state      *botState
+}
+
+func (s *botState) newNonceManager(address common.Address, privateKey *ecdsa.PrivateKey, chainId *big.Int) (*nonceManager, error) {
+	nextNonce, err := s.readClient.PendingNonceAt(context.Background(), address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nonceManager{
+		address:    address,
+		privateKey: privateKey,
+		chainId:    chainId,
+		nextNonce:  nextNonce,
+		reserved:   make(map[uint64]time.Time),
+		ours:       make(map[uint64]bool),
+		pending:    make(map[uint64]pendingTx),
+		state:      s,
+	}, nil
+}
+
+// Returns the nonce the next tx would get, without reserving it
+func (n *nonceManager) peek() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.nextNonce
+}
+
+// Reserves a nonce for a tx we are about to send
+func (n *nonceManager) reserve() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	nonce := n.nextNonce
+	n.nextNonce++
+	n.reserved[nonce] = time.Now()
+	n.ours[nonce] = true
+
+	return nonce
+}
+
+// Marks a reserved nonce as broadcast
+func (n *nonceManager) markSent(nonce uint64, tx *types.Transaction) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.reserved, nonce)
+	n.pending[nonce] = pendingTx{
+		Nonce:     nonce,
+		Hash:      tx.Hash(),
+		GasPrice:  tx.GasPrice(),
+		GasTipCap: tx.GasTipCap(),
+		SentAt:    time.Now(),
+	}
+}
+
+// Hands back a reserved nonce whose tx was never broadcast
+// If it was the last one handed out we reuse it, otherwise it is a gap that sync() will cancel
+// A tx the node already knows is broadcast, it goes through markSent instead
+func (n *nonceManager) release(nonce uint64, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.reserved, nonce)
+
+	if err != nil && strings.Contains(err.Error(), "nonce too low") {
+		// The nonce is taken on chain, nothing to reclaim or cancel
+		delete(n.ours, nonce)
+		return
+	}
+
+	if nonce == n.nextNonce-1 {
+		n.nextNonce--
+		delete(n.ours, nonce)
+	}
+}
+
+// Returns all txs that are sent but not yet mined, ordered by nonce
+func (n *nonceManager) pendingTxs() []pendingTx {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	txs := make([]pendingTx, 0, len(n.pending))
+	for _, tx := range n.pending {
+		txs = append(txs, tx)
+	}
+
+	sort.Slice(txs, func(i, j int) bool {
+		return txs[i].Nonce < txs[j].Nonce
+	})
+
+	return txs
+}
+
+// Reconciles with the chain: forgets mined txs, and cancels gaps and stuck txs so later nonces can go through
+func (n *nonceManager) sync() error {
+	minedNonce, err := n.state.readClient.NonceAt(context.Background(), n.address, nil)
+	if err != nil {
+		return err
+	}
+
+	chainPendingNonce, err := n.state.readClient.PendingNonceAt(context.Background(), n.address)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+
+	// Everything below the mined nonce is final, whether it was ours or a replacement
+	for nonce, tx := range n.pending {
+		if nonce < minedNonce {
+			n.state.logger.Debug("Pending tx done", zap.Uint64("nonce", nonce), zap.String("hash", tx.Hash.Hex()), zap.Bool("isCancel", tx.IsCancel))
+			delete(n.pending, nonce)
+		}
+	}
+
+	for nonce := range n.ours {
+		if nonce < minedNonce {
+			delete(n.ours, nonce)
+		}
+	}
+
+	// Someone else sent from this account, skip past their nonces
+	// They are not ours, so they never count as gaps
+	if chainPendingNonce > n.nextNonce {
+		n.state.logger.Info("Nonce moved ahead on chain", zap.Uint64("local", n.nextNonce), zap.Uint64("chain", chainPendingNonce))
+		n.nextNonce = chainPendingNonce
+	}
+
+	// Any nonce we handed out that is neither reserved nor pending is a gap
+	// Stuck txs are treated the same, a cancellation replaces them
+	var toCancel []uint64
+	for nonce := minedNonce; nonce < n.nextNonce; nonce++ {
+		if _, ok := n.reserved[nonce]; ok || !n.ours[nonce] {
+			continue
+		}
+
+		tx, ok := n.pending[nonce]
+		if !ok || time.Since(tx.SentAt) > time.Second*NONCE_STUCK_TIMEOUT_S {
+			toCancel = append(toCancel, nonce)
+		}
+	}
+
+	n.mu.Unlock()
+
+	for _, nonce := range toCancel {
+		err := n.cancel(nonce)
+		if err != nil {
+			n.state.logger.Error("Error cancelling nonce", zap.Uint64("nonce", nonce), zap.Error(err))
+		}
+	}
+
+	n.state.logger.Info("Synced nonces to: ",
+		zap.Uint64("nonce", n.peek()),
+		zap.Uint64("minedNonce", minedNonce),
+		zap.Int("pendingTxs", len(n.pendingTxs())),
+		zap.Int("cancelled", len(toCancel)),
+	)
+
+	return nil
+}
+
+// Sends a 0 value transfer to ourselves at nonce, priced above whatever is pending there
+func (n *nonceManager) cancel(nonce uint64) error {
+	prices := n.state.gasPricing.prices(nil)
+
+	n.mu.Lock()
+	previous, hasPrevious := n.pending[nonce]
+	n.mu.Unlock()
+
+	var tx *types.Transaction
+
+	if prices.GasPrice != nil {
+		if hasPrevious {
+			prices.GasPrice = maxBig(prices.GasPrice, bumpGasPrice(previous.GasPrice))
+		}
+
+		tx = types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			To:       &n.address,
+			Value:    big.NewInt(0),
+			Gas:      TRANSFER_GAS_LIMIT,
+			GasPrice: prices.GasPrice,
+		})
+	} else {
+		if hasPrevious {
+			// tx.GasPrice() is the fee cap for dynamic fee txs
+			prices.GasFeeCap = maxBig(prices.GasFeeCap, bumpGasPrice(previous.GasPrice))
+			prices.GasTipCap = maxBig(prices.GasTipCap, bumpGasPrice(previous.GasTipCap))
+		}
+
+		tx = types.NewTx(&types.DynamicFeeTx{
+			ChainID:   n.chainId,
+			Nonce:     nonce,
+			To:        &n.address,
+			Value:     big.NewInt(0),
+			Gas:       TRANSFER_GAS_LIMIT,
+			GasFeeCap: prices.GasFeeCap,
+			GasTipCap: prices.GasTipCap,
+		})
+	}
+
+	signedTx, err := types.SignTx(tx, types.LatestSignerForChainID(n.chainId), n.privateKey)
+	if err != nil {
+		return err
+	}
+
+	err = n.state.broadcast.send(context.Background(), signedTx)
+	if err != nil && strings.Contains(err.Error(), "nonce too low") {
+		// Got mined in the meantime
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	n.state.logger.Info("Sent cancellation tx", zap.Uint64("nonce", nonce), zap.String("hash", signedTx.Hash().Hex()))
+
+	n.mu.Lock()
+	n.pending[nonce] = pendingTx{
+		Nonce:     nonce,
+		Hash:      signedTx.Hash(),
+		GasPrice:  signedTx.GasPrice(),
+		GasTipCap: signedTx.GasTipCap(),
+		SentAt:    time.Now(),
+		IsCancel:  true,
+	}
+	n.mu.Unlock()
+
+	return nil
+}
+
+func bumpGasPrice(gasPrice *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(gasPrice, big.NewInt(100+NONCE_CANCEL_GAS_BUMP_PERCENT))
+	return bumped.Div(bumped, big.NewInt(100))
+}
+
+// Nonces for paper trades, which are signed but never sent
+// Nothing is ever pending, so there is nothing to cancel and we start over from the chain on every sync
+type paperNonceSource struct {
+	mu        sync.Mutex
+	address   common.Address
+	nextNonce uint64
+	reserved  int
+	state     *botState
+}
+
+func (s *botState) newPaperNonceSource(address common.Address) (*paperNonceSource, error) {
+	nextNonce, err := s.readClient.PendingNonceAt(context.Background(), address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &paperNonceSource{address: address, nextNonce: nextNonce, state: s}, nil
+}
+
+func (n *paperNonceSource) peek() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.nextNonce
+}
+
+func (n *paperNonceSource) reserve() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	nonce := n.nextNonce
+	n.nextNonce++
+	n.reserved++
+
+	return nonce
+}
+
+func (n *paperNonceSource) markSent(nonce uint64, tx *types.Transaction) {
+	n.release(nonce, nil)
+}
+
+func (n *paperNonceSource) release(nonce uint64, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.reserved > 0 {
+		n.reserved--
+	}
+
+	if nonce == n.nextNonce-1 {
+		n.nextNonce--
+	}
+}
+
+func (n *paperNonceSource) pendingTxs() []pendingTx {
+	return nil
+}
+
+func (n *paperNonceSource) sync() error {
+	chainPendingNonce, err := n.state.readClient.PendingNonceAt(context.Background(), n.address)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	if n.reserved == 0 {
+		n.nextNonce = chainPendingNonce
+	}
+	n.mu.Unlock()
+
+	n.state.logger.Info("Synced paper nonces to: ", zap.Uint64("nonce", n.peek()))
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package metis_simple_arbitrage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Checks a pair is really one its factory deployed before we trade through it
+// A lookalike pair runs whatever it wants in the flash swap callback, which is how an executor gets drained
+type pairVerifier struct {
+	calls            *viewCallSource
+	hermesFactoryABI abi.ABI
+	initCodeHashABI  abi.ABI
+	initCodeHashes   map[common.Address]common.Hash
+}
+
+// Plain JSON-RPC batches, so it works whichever reserve source we use
+// Fails unless every factory we load pairs from has its init code hash pinned
+func newPairVerifier(readClient *readPool) (*pairVerifier, error) {
+	initCodeHashes, err := pinnedInitCodeHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	calls, err := newViewCallSource(readClient, common.Address{}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	hermesFactoryABI, err := abi.JSON(strings.NewReader(viewHermesFactoryABI))
+	if err != nil {
+		return nil, err
+	}
+
+	initCodeHashABI, err := abi.JSON(strings.NewReader(viewInitCodeHashABI))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pairVerifier{calls: calls, hermesFactoryABI: hermesFactoryABI, initCodeHashABI: initCodeHashABI, initCodeHashes: initCodeHashes}, nil
+}
+
+// The init code hash of every factory in uniswapV2FactoryAddresses, keyed by address
+func pinnedInitCodeHashes() (map[common.Address]common.Hash, error) {
+	initCodeHashes := make(map[common.Address]common.Hash)
+	var missing []string
+
+	for _, factoryAddress := range uniswapV2FactoryAddresses {
+		initCodeHash := common.HexToHash(uniswapV2FactoryInitCodeHashes[factoryAddress])
+		if initCodeHash == (common.Hash{}) {
+			missing = append(missing, factoryAddress)
+			continue
+		}
+
+		initCodeHashes[common.HexToAddress(factoryAddress)] = initCodeHash
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no init code hash pinned for factories %s", strings.Join(missing, ", "))
+	}
+
+	return initCodeHashes, nil
+}
+
+// For each pair, why it was rejected or nil if it is genuine
+// The error is for when we couldn't check at all
+func (v *pairVerifier) verifyPairs(factory common.Address, isHermes bool, pairs [][3]common.Address) ([]error, error) {
+	rejections := make([]error, len(pairs))
+	if len(pairs) == 0 {
+		return rejections, nil
+	}
+
+	// The factory must list the pair for its tokens
+	getPairCalls := make([]viewCall, len(pairs))
+	for i, pair := range pairs {
+		var data []byte
+		var err error
+		if isHermes {
+			// We only keep volatile Hermes pairs
+			data, err = v.hermesFactoryABI.Pack("getPair", pair[0], pair[1], false)
+		} else {
+			data, err = v.calls.factoryABI.Pack("getPair", pair[0], pair[1])
+		}
+		if err != nil {
+			return nil, err
+		}
+		getPairCalls[i] = viewCall{to: factory, data: data}
+	}
+
+	outputs, callErrs, err := v.calls.tryCall(nil, getPairCalls)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, pair := range pairs {
+		listed, err := v.unpackAddress(v.calls.factoryABI, "getPair", outputs[i], callErrs[i])
+		if err != nil {
+			rejections[i] = fmt.Errorf("getPair: %w", err)
+		} else if listed != pair[2] {
+			rejections[i] = fmt.Errorf("factory lists %s for these tokens", listed.Hex())
+		}
+	}
+
+	// And the pair must point back at the factory
+	// Hermes pairs keep their factory in a private immutable, the CREATE2 check below covers them
+	if !isHermes {
+		data, err := v.calls.pairABI.Pack("factory")
+		if err != nil {
+			return nil, err
+		}
+
+		factoryCalls := make([]viewCall, len(pairs))
+		for i, pair := range pairs {
+			factoryCalls[i] = viewCall{to: pair[2], data: data}
+		}
+
+		outputs, callErrs, err = v.calls.tryCall(nil, factoryCalls)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range pairs {
+			if rejections[i] != nil {
+				continue
+			}
+
+			pairFactory, err := v.unpackAddress(v.calls.pairABI, "factory", outputs[i], callErrs[i])
+			if err != nil {
+				rejections[i] = fmt.Errorf("factory: %w", err)
+			} else if pairFactory != factory {
+				rejections[i] = fmt.Errorf("pair says its factory is %s", pairFactory.Hex())
+			}
+		}
+	}
+
+	// Only the factory can have deployed a pair at the CREATE2 address of its tokens
+	initCodeHash, err := v.initCodeHash(factory)
+	if err != nil {
+		return nil, fmt.Errorf("init code hash of %s: %w", factory.Hex(), err)
+	}
+
+	for i, pair := range pairs {
+		if rejections[i] != nil {
+			continue
+		}
+
+		expected := pairAddressFor(factory, initCodeHash, pair[0], pair[1], isHermes)
+		if expected != pair[2] {
+			rejections[i] = fmt.Errorf("not at the factory's CREATE2 address %s", expected.Hex())
+		}
+	}
+
+	return rejections, nil
+}
+
+// The pinned init code hash of a factory's pairs
+// A factory that reports a different hash than the pinned one is not the contract we think it is
+func (v *pairVerifier) initCodeHash(factory common.Address) (common.Hash, error) {
+	pinned, ok := v.initCodeHashes[factory]
+	if !ok {
+		return common.Hash{}, errors.New("none pinned")
+	}
+
+	methods := []string{"INIT_CODE_PAIR_HASH", "INIT_CODE_HASH", "pairCodeHash"}
+
+	calls := make([]viewCall, len(methods))
+	for i, method := range methods {
+		data, err := v.initCodeHashABI.Pack(method)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		calls[i] = viewCall{to: factory, data: data}
+	}
+
+	outputs, callErrs, err := v.calls.tryCall(nil, calls)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	for i := range methods {
+		if callErrs[i] != nil || len(outputs[i]) != common.HashLength {
+			continue
+		}
+
+		if reported := common.BytesToHash(outputs[i]); reported != pinned {
+			return common.Hash{}, fmt.Errorf("factory reports %s, pinned %s", reported.Hex(), pinned.Hex())
+		}
+		break
+	}
+
+	return pinned, nil
+}
+
+// Where the factory deploys the pair of two tokens, Hermes adds whether it is stable to the salt
+func pairAddressFor(factory common.Address, initCodeHash common.Hash, tokenA common.Address, tokenB common.Address, isHermes bool) common.Address {
+	token0, token1 := tokenA, tokenB
+	if bytes.Compare(token0.Bytes(), token1.Bytes()) > 0 {
+		token0, token1 = token1, token0
+	}
+
+	packed := append(token0.Bytes(), token1.Bytes()...)
+	if isHermes {
+		// We only keep volatile Hermes pairs
+		packed = append(packed, 0)
+	}
+
+	return crypto.CreateAddress2(factory, crypto.Keccak256Hash(packed), initCodeHash.Bytes())
+}
+
+func (v *pairVerifier) unpackAddress(contractABI abi.ABI, method string, output []byte, callErr error) (common.Address, error) {
+	if callErr != nil {
+		return common.Address{}, callErr
+	}
+
+	values, err := contractABI.Unpack(method, output)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return values[0].(common.Address), nil
+}
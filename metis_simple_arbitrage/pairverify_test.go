@@ -0,0 +1,169 @@
+package metis_simple_arbitrage
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/zap"
+)
+
+// Uniswap V2 WETH/USDC on mainnet, whichever order the tokens come in
+func TestPairAddressFor(t *testing.T) {
+	factory := common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f")
+	initCodeHash := common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f")
+	usdc := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	weth := common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	want := common.HexToAddress("0xB4e16d0168e52d35CaCD2c6185b44281Ec28C9Dc")
+
+	for _, tokens := range [][2]common.Address{{usdc, weth}, {weth, usdc}} {
+		if got := pairAddressFor(factory, initCodeHash, tokens[0], tokens[1], false); got != want {
+			t.Fatalf("got %s, want %s", got.Hex(), want.Hex())
+		}
+	}
+
+	// The stable flag is part of a Hermes salt, so the same tokens land elsewhere
+	if got := pairAddressFor(factory, initCodeHash, usdc, weth, true); got == want {
+		t.Fatal("hermes salt ignored the stable flag")
+	}
+}
+
+// Answers the eth_calls the verifier makes, for one factory and the pairs it deployed
+type fakeFactoryChain struct {
+	factory common.Address
+	pairs   map[[2]common.Address]common.Address
+	// What pairs say their factory is, the factory itself unless set
+	pairFactories map[common.Address]common.Address
+}
+
+func (c *fakeFactoryChain) BlockNumber() hexutil.Uint64 {
+	return 1
+}
+
+func (c *fakeFactoryChain) Call(args map[string]interface{}, block string) (hexutil.Bytes, error) {
+	to := common.HexToAddress(args["to"].(string))
+	data, err := hexutil.Decode(args["data"].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	selector := hexutil.Encode(data[:4])
+	switch {
+	case to == c.factory && (selector == "0xe6a43905" || selector == "0x6801cc30"):
+		// getPair(address,address) and Hermes' getPair(address,address,bool)
+		tokenA := common.BytesToAddress(data[4:36])
+		tokenB := common.BytesToAddress(data[36:68])
+		if pair, ok := c.pairs[[2]common.Address{tokenA, tokenB}]; ok {
+			return common.LeftPadBytes(pair.Bytes(), 32), nil
+		}
+		return common.LeftPadBytes(c.pairs[[2]common.Address{tokenB, tokenA}].Bytes(), 32), nil
+	case to != c.factory && selector == "0xc45a0155":
+		// factory()
+		pairFactory, ok := c.pairFactories[to]
+		if !ok {
+			pairFactory = c.factory
+		}
+		return common.LeftPadBytes(pairFactory.Bytes(), 32), nil
+	default:
+		return nil, errors.New("execution reverted")
+	}
+}
+
+// Every factory we load pairs from, with pins of our own, keeps its genuine pairs and drops the rest
+func TestVerifyPairsForEveryFactory(t *testing.T) {
+	savedInitCodeHashes := uniswapV2FactoryInitCodeHashes
+	t.Cleanup(func() { uniswapV2FactoryInitCodeHashes = savedInitCodeHashes })
+
+	uniswapV2FactoryInitCodeHashes = make(map[string]string)
+	for i, factoryAddress := range uniswapV2FactoryAddresses {
+		uniswapV2FactoryInitCodeHashes[factoryAddress] = common.BigToHash(big.NewInt(int64(i + 1))).Hex()
+	}
+
+	metis := common.HexToAddress(METIS_TOKEN_ADDRESS)
+	token := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	lookalikeToken := common.HexToAddress("0x00000000000000000000000000000000000000a2")
+	impostorToken := common.HexToAddress("0x00000000000000000000000000000000000000a3")
+
+	for _, factoryAddress := range uniswapV2FactoryAddresses {
+		t.Run(factoryAddress, func(t *testing.T) {
+			factory := common.HexToAddress(factoryAddress)
+			isHermes := factoryAddress == HERMES_FACTORY_ADDRESS
+			initCodeHash := common.HexToHash(uniswapV2FactoryInitCodeHashes[factoryAddress])
+
+			genuine := pairAddressFor(factory, initCodeHash, metis, token, isHermes)
+			// Listed by the factory but not deployed by it
+			lookalike := common.HexToAddress("0x00000000000000000000000000000000000000c1")
+			// Claims the factory, which never heard of it
+			impostor := common.HexToAddress("0x00000000000000000000000000000000000000c2")
+
+			chain := &fakeFactoryChain{
+				factory: factory,
+				pairs: map[[2]common.Address]common.Address{
+					{metis, token}:          genuine,
+					{metis, lookalikeToken}: lookalike,
+				},
+			}
+
+			verifier := newPairVerifierForTest(t, chain)
+
+			rejections, err := verifier.verifyPairs(factory, isHermes, [][3]common.Address{
+				{metis, token, genuine},
+				{token, metis, genuine},
+				{metis, lookalikeToken, lookalike},
+				{metis, impostorToken, impostor},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, wantRejected := range []bool{false, false, true, true} {
+				if (rejections[i] != nil) != wantRejected {
+					t.Fatalf("pair %d: rejection %v, want rejected %v", i, rejections[i], wantRejected)
+				}
+			}
+		})
+	}
+}
+
+func TestPairVerifierRequiresEveryPin(t *testing.T) {
+	savedInitCodeHashes := uniswapV2FactoryInitCodeHashes
+	t.Cleanup(func() { uniswapV2FactoryInitCodeHashes = savedInitCodeHashes })
+
+	uniswapV2FactoryInitCodeHashes = make(map[string]string)
+	for i, factoryAddress := range uniswapV2FactoryAddresses[1:] {
+		uniswapV2FactoryInitCodeHashes[factoryAddress] = common.BigToHash(big.NewInt(int64(i + 1))).Hex()
+	}
+
+	_, err := pinnedInitCodeHashes()
+	if err == nil || !strings.Contains(err.Error(), uniswapV2FactoryAddresses[0]) {
+		t.Fatalf("expected the unpinned factory to be named, got %v", err)
+	}
+}
+
+func newPairVerifierForTest(t *testing.T, chain *fakeFactoryChain) *pairVerifier {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", chain); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+
+	client := ethclient.NewClient(rpc.DialInProc(server))
+	t.Cleanup(client.Close)
+
+	readClient, err := newReadPoolFromClients([]string{"fake"}, []*ethclient.Client{client}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := newPairVerifier(readClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return verifier
+}
@@ -0,0 +1,290 @@
+package metis_simple_arbitrage
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"sync"
+
+	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
+	"github.com/cryptotriv/raikiri/lib/util"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+	"go.uber.org/zap"
+)
+
+// One of our arb txs that we keep rebidding on until its block lands
+type auction struct {
+	account     *executorAccount
+	nonce       uint64
+	auth        bind.TransactOpts
+	arbs        []FlashSwapExecutorV1.Arb
+	pools       []common.Address
+	tokens      []common.Address
+	gasPrice    *big.Int
+	maxGasPrice *big.Int
+	startBlock  uint64
+	hash        common.Hash
+	firstHash   common.Hash
+}
+
+// Each executor account has its own nonces, so an auction is only unique per account
+type auctionKey struct {
+	account common.Address
+	nonce   uint64
+}
+
+func (a *auction) key() auctionKey {
+	return auctionKey{account: a.account.address, nonce: a.nonce}
+}
+
+// Watches pending txs that touch the same pools as our arbs and outbids them by replacing our tx
+type pgaEngine struct {
+	mu           sync.Mutex
+	auctions     map[auctionKey]*auction
+	currentBlock uint64
+	arbSender    ArbSender
+	state        *botState
+}
+
+func (s *botState) newPGAEngine(arbSender ArbSender) *pgaEngine {
+	return &pgaEngine{
+		auctions:  make(map[auctionKey]*auction),
+		arbSender: arbSender,
+		state:     s,
+	}
+}
+
+func (p *pgaEngine) run(ctx context.Context) {
+	pendingTxs := make(chan *types.Transaction, CHANNEL_BUFFER)
+	heads := make(chan *types.Header, CHANNEL_BUFFER)
+
+	pendingSub, err := gethclient.New(p.state.writeClient.Client()).SubscribeFullPendingTransactions(ctx, pendingTxs)
+	if err != nil {
+		p.state.logger.Error("Error subscribing to pending txs, PGA disabled", zap.Error(err))
+		return
+	}
+	defer pendingSub.Unsubscribe()
+
+	headSub, err := p.state.readClient.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		p.state.logger.Error("Error subscribing to new heads, PGA disabled", zap.Error(err))
+		return
+	}
+	defer headSub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-pendingSub.Err():
+			p.state.logger.Error("Error in pending tx subscription, PGA stopped", zap.Error(err))
+			return
+		case err := <-headSub.Err():
+			p.state.logger.Error("Error in new head subscription, PGA stopped", zap.Error(err))
+			return
+		case head := <-heads:
+			p.onNewBlock(head.Number.Uint64())
+		case tx := <-pendingTxs:
+			p.onPendingTx(tx)
+		}
+	}
+}
+
+// Starts bidding for an arb tx we just sent, if it is worth fighting for
+func (p *pgaEngine) open(account *executorAccount, auth *bind.TransactOpts, arbs []FlashSwapExecutorV1.Arb, tx *types.Transaction) {
+	expectedProfit := big.NewInt(0)
+	for _, arb := range arbs {
+		expectedProfit.Add(expectedProfit, arb.Profit)
+	}
+
+	minPGAProfit := new(big.Int).Mul(p.state.minProfitWei, big.NewInt(MIN_PROFIT_PGA_MULTIPLIER))
+	if expectedProfit.Cmp(minPGAProfit) < 0 {
+		return
+	}
+
+	// Never bid more than our share of the expected profit
+	gasEstimate := big.NewInt(int64(PGA_GAS_PER_ARB * len(arbs)))
+	maxGasPrice := new(big.Int).Mul(expectedProfit, big.NewInt(int64(PERCENTAGE_TO_MINER_CONST*100)))
+	maxGasPrice.Div(maxGasPrice, big.NewInt(100))
+	maxGasPrice.Div(maxGasPrice, gasEstimate)
+
+	// Router swaps name the token path instead of the pools, so we watch both
+	var pools []common.Address
+	var tokens []common.Address
+	for _, arb := range arbs {
+		pools = append(pools, arb.BuyFromPair, arb.SellToPair)
+		if mapping, ok := p.state.marketMapping[arb.BuyFromPair]; ok {
+			tokens = append(tokens, mapping.TokenAddress)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a := &auction{
+		account:     account,
+		nonce:       auth.Nonce.Uint64(),
+		auth:        *auth,
+		arbs:        arbs,
+		pools:       pools,
+		tokens:      tokens,
+		gasPrice:    tx.GasTipCap(),
+		maxGasPrice: maxGasPrice,
+		startBlock:  p.currentBlock,
+		hash:        tx.Hash(),
+		firstHash:   tx.Hash(),
+	}
+	p.auctions[a.key()] = a
+}
+
+// Our txs are either in the block that just landed or lost, so we stop bidding
+func (p *pgaEngine) onNewBlock(blockNumber uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.currentBlock = blockNumber
+
+	for key, a := range p.auctions {
+		if blockNumber > a.startBlock {
+			p.state.logger.Debug("Closing auction", zap.String("account", key.account.Hex()), zap.Uint64("nonce", key.nonce), zap.String("gasPrice", util.ToDecimal(a.gasPrice, 9).String()))
+			delete(p.auctions, key)
+		}
+	}
+}
+
+func (p *pgaEngine) onPendingTx(tx *types.Transaction) {
+	// Skip our own txs
+	if tx.To() == nil || *tx.To() == p.arbSender.Address() {
+		return
+	}
+
+	p.mu.Lock()
+	var contested []*auction
+	for _, a := range p.auctions {
+		if a.hash == tx.Hash() {
+			continue
+		}
+		if contests(tx.Data(), a) {
+			contested = append(contested, a)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, a := range contested {
+		p.rebid(a, tx)
+	}
+}
+
+func (p *pgaEngine) rebid(a *auction, competitorTx *types.Transaction) {
+	// Pick the bid under the lock, but never hold it across signing and sending
+	p.mu.Lock()
+	if current, ok := p.auctions[a.key()]; !ok || current != a {
+		p.mu.Unlock()
+		return
+	}
+
+	// Ordering goes by tip, which is the gas price for legacy txs
+	competitorGasPrice := competitorTx.GasTipCap()
+	if competitorGasPrice.Cmp(a.gasPrice) < 0 {
+		// We are already ahead
+		p.mu.Unlock()
+		return
+	}
+
+	bid := nextBid(a, competitorGasPrice)
+
+	if bid.Cmp(a.maxGasPrice) > 0 {
+		bid = new(big.Int).Set(a.maxGasPrice)
+	}
+
+	// Replacements must beat our own previous bid, otherwise the node refuses them
+	minReplacement := new(big.Int).Mul(a.gasPrice, big.NewInt(int64(PERCENTAGE_GAS_INCREASE*100)))
+	minReplacement.Div(minReplacement, big.NewInt(100))
+	if bid.Cmp(minReplacement) < 0 {
+		p.state.logger.Info("Hit max bid, leaving auction", zap.Uint64("nonce", a.nonce), zap.String("maxGasPrice", util.ToDecimal(a.maxGasPrice, 9).String()))
+		delete(p.auctions, a.key())
+		p.mu.Unlock()
+		return
+	}
+
+	replacementAuth := a.auth
+	replacementAuth.Nonce = new(big.Int).SetUint64(a.nonce)
+	if replacementAuth.GasFeeCap != nil {
+		// Keep the same headroom for the base fee on top of the new tip
+		replacementAuth.GasFeeCap = new(big.Int).Add(bid, new(big.Int).Sub(a.auth.GasFeeCap, a.auth.GasTipCap))
+		replacementAuth.GasTipCap = bid
+	} else {
+		replacementAuth.GasPrice = bid
+	}
+	p.mu.Unlock()
+
+	tx, err := p.arbSender.SignArbs(&replacementAuth, a.arbs, p.state.minProfitWeiFollowUp)
+	if err == nil {
+		err = p.arbSender.Send(context.Background(), tx)
+	}
+	if err != nil {
+		p.state.logger.Error("Error sending rebid", zap.Uint64("nonce", a.nonce), zap.Error(err))
+		p.mu.Lock()
+		delete(p.auctions, a.key())
+		p.mu.Unlock()
+		return
+	}
+
+	p.state.logger.Info("Rebid arb tx",
+		zap.Uint64("nonce", a.nonce),
+		zap.String("competitor", competitorTx.Hash().Hex()),
+		zap.String("competitorGasPrice", util.ToDecimal(competitorGasPrice, 9).String()),
+		zap.String("gasPrice", util.ToDecimal(bid, 9).String()),
+		zap.String("hash", tx.Hash().Hex()),
+	)
+
+	p.mu.Lock()
+	a.gasPrice = bid
+	a.hash = tx.Hash()
+	p.mu.Unlock()
+
+	a.account.nonces.markSent(a.nonce, tx)
+	p.state.journal.recordTx(tx, a.account.address, a.arbs)
+	p.state.tracker.track(tx, replacementAuth.From, a.arbs)
+}
+
+// A pending tx goes for the same trade if it names one of our pools, or the token of one in a router path
+func contests(data []byte, a *auction) bool {
+	for _, pool := range a.pools {
+		if bytes.Contains(data, pool.Bytes()) {
+			return true
+		}
+	}
+
+	for _, token := range a.tokens {
+		if bytes.Contains(data, token.Bytes()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func nextBid(a *auction, competitorGasPrice *big.Int) *big.Int {
+	// Outbid the competitor by a percentage, with a minimum step
+	bid := new(big.Int).Mul(competitorGasPrice, big.NewInt(int64(PERCENTAGE_GAS_INCREASE*100)))
+	bid.Div(bid, big.NewInt(100))
+
+	minStep := new(big.Int).Add(competitorGasPrice, util.ToWei(MIN_GAS_INCREASE_GWEI, 9))
+	if minStep.Cmp(bid) > 0 {
+		bid = minStep
+	}
+
+	// On the first fight jump straight to a meaningful share of our max bid
+	if a.hash == a.firstHash {
+		startingBid := new(big.Int).Div(a.maxGasPrice, big.NewInt(STARTING_PGA_GAS_DIVISOR))
+		if startingBid.Cmp(bid) > 0 {
+			bid = startingBid
+		}
+	}
+
+	return bid
+}
@@ -0,0 +1,167 @@
+package metis_simple_arbitrage
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/cryptotriv/raikiri/lib/models"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+)
+
+// A market we stopped tracking and why
+type excludedMarket struct {
+	address common.Address
+	reason  string
+}
+
+// Fetches reserves in batches, a batch that fails because of its pairs is split until the failing pairs are found
+// Reserves line up with pairs, excluded pairs are left empty
+// Errors that are not down to the pairs, like every endpoint being down, still fail the whole fetch
+func fetchReserves(reserveSource ReserveSource, callOpts *bind.CallOpts, pairs []common.Address) ([][3]*big.Int, []excludedMarket, error) {
+	reserves := make([][3]*big.Int, len(pairs))
+	var excluded []excludedMarket
+
+	for start := 0; start < len(pairs); start += RESERVE_BATCH_SIZE {
+		end := start + RESERVE_BATCH_SIZE
+		if end > len(pairs) {
+			end = len(pairs)
+		}
+
+		batchExcluded, err := fetchReservesBisect(reserveSource, callOpts, pairs[start:end], reserves[start:end])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		excluded = append(excluded, batchExcluded...)
+	}
+
+	return reserves, excluded, nil
+}
+
+func fetchReservesBisect(reserveSource ReserveSource, callOpts *bind.CallOpts, pairs []common.Address, reserves [][3]*big.Int) ([]excludedMarket, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	batch, err := reserveSource.GetReserves(callOpts, pairs)
+	if err == nil {
+		copy(reserves, batch)
+		return nil, nil
+	}
+
+	if !isPairFault(err) {
+		return nil, err
+	}
+
+	if len(pairs) == 1 {
+		return []excludedMarket{{address: pairs[0], reason: err.Error()}}, nil
+	}
+
+	middle := len(pairs) / 2
+
+	excluded, err := fetchReservesBisect(reserveSource, callOpts, pairs[:middle], reserves[:middle])
+	if err != nil {
+		return nil, err
+	}
+
+	excludedRight, err := fetchReservesBisect(reserveSource, callOpts, pairs[middle:], reserves[middle:])
+	if err != nil {
+		return nil, err
+	}
+
+	return append(excluded, excludedRight...), nil
+}
+
+// Reverts and undecodable outputs come from the pairs, any node would give the same answer
+func isPairFault(err error) bool {
+	return isDeterministicReadError(err) || errors.Is(err, errBadPairOutput)
+}
+
+// Drops the markets from everything we track, tokens left with a single market go too
+// allMarketReserves must line up with allMarketAddresses when it is set
+func (s *botState) quarantineMarkets(excluded []excludedMarket) {
+	if len(excluded) == 0 {
+		return
+	}
+
+	removed := make(map[common.Address]bool)
+	for _, market := range excluded {
+		s.quarantinedMarkets[market.address] = market.reason
+		removed[market.address] = true
+
+		s.logger.Warn("Market quarantined", zap.String("marketAddress", market.address.Hex()), zap.String("reason", market.reason))
+	}
+
+	for token, pairs := range s.marketPairsByToken {
+		var kept []models.UniswappyV2Pair
+		for _, pair := range pairs {
+			if !removed[pair.MarketAdress] {
+				kept = append(kept, pair)
+			}
+		}
+
+		if len(kept) == len(pairs) {
+			continue
+		}
+
+		if len(kept) > 1 {
+			s.marketPairsByToken[token] = kept
+			continue
+		}
+
+		// Nothing to arb against
+		for _, pair := range kept {
+			removed[pair.MarketAdress] = true
+		}
+		delete(s.marketPairsByToken, token)
+	}
+
+	var newAllMarketAddresses []common.Address
+	var newAllMarketAddressFactories []common.Address
+	var newAllMarketReserves [][3]*big.Int
+
+	for marketIndex, marketAddress := range s.allMarketAddresses {
+		if removed[marketAddress] {
+			continue
+		}
+
+		newAllMarketAddresses = append(newAllMarketAddresses, marketAddress)
+		// Factories and reserves are filled in later while the markets are set up
+		if marketIndex < len(s.allMarketAddressFactories) {
+			newAllMarketAddressFactories = append(newAllMarketAddressFactories, s.allMarketAddressFactories[marketIndex])
+		}
+		if marketIndex < len(s.allMarketReserves) {
+			newAllMarketReserves = append(newAllMarketReserves, s.allMarketReserves[marketIndex])
+		}
+	}
+
+	s.allMarketAddresses = newAllMarketAddresses
+	s.allMarketAddressFactories = newAllMarketAddressFactories
+	s.allMarketReserves = newAllMarketReserves
+
+	// Indexes moved, point the pairs at their new reserves
+	marketIndexes := make(map[common.Address]int, len(s.allMarketAddresses))
+	for marketIndex, marketAddress := range s.allMarketAddresses {
+		marketIndexes[marketAddress] = marketIndex
+	}
+
+	for token, pairs := range s.marketPairsByToken {
+		for pairCount, pair := range pairs {
+			s.marketPairsByToken[token][pairCount].TokenReserveIndex = marketIndexes[pair.MarketAdress]
+		}
+	}
+
+	// The mapping only exists once the markets are set up, before that it is built from scratch
+	if len(s.marketMapping) > 0 {
+		s.marketMapping = make(map[common.Address]models.MarketMapping)
+		s.mapMarketAddresses()
+	}
+
+	s.logger.Info("Markets quarantined",
+		zap.Int("quarantined", len(excluded)),
+		zap.Int("totalQuarantined", len(s.quarantinedMarkets)),
+		zap.Int("remainingMarkets", len(s.allMarketAddresses)),
+	)
+}
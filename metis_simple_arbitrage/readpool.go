@@ -0,0 +1,430 @@
+package metis_simple_arbitrage
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/zap"
+)
+
+// One RPC node we read chain state from
+type readEndpoint struct {
+	name      string
+	client    *ethclient.Client
+	head      uint64
+	latency   time.Duration
+	errorRate float64
+	lagging   bool
+}
+
+// Lower is better, lagging and failing nodes sort last
+func (e *readEndpoint) score() float64 {
+	score := float64(e.latency) * (1 + e.errorRate*10)
+	if e.lagging || e.errorRate > READ_POOL_MAX_ERROR_RATE {
+		score += float64(time.Hour)
+	}
+	return score
+}
+
+// Sends reads to the healthiest endpoint and fails over to the next one on errors
+// Implements bind.ContractBackend so our bindings get the failover too
+type readPool struct {
+	mu        sync.Mutex
+	endpoints []*readEndpoint
+	best      *readEndpoint
+	logger    *zap.Logger
+	broadcast *broadcaster // Set once the bot has one, txs signed through the pool go out through it
+}
+
+// The first network is the primary one, it is used until health checks say otherwise
+func newReadPool(networkNames []string, logger *zap.Logger) (*readPool, error) {
+	var clients []*ethclient.Client
+
+	for _, networkName := range networkNames {
+		client, err := ethclient.Dial(os.Getenv(networkName))
+		if err != nil {
+			return nil, err
+		}
+
+		clients = append(clients, client)
+	}
+
+	return newReadPoolFromClients(networkNames, clients, logger)
+}
+
+// For clients that are already connected, names are only used in logs
+func newReadPoolFromClients(names []string, clients []*ethclient.Client, logger *zap.Logger) (*readPool, error) {
+	p := &readPool{logger: logger}
+
+	for i, client := range clients {
+		p.endpoints = append(p.endpoints, &readEndpoint{name: names[i], client: client})
+	}
+
+	if len(p.endpoints) == 0 {
+		return nil, errors.New("no read endpoints configured")
+	}
+
+	p.best = p.endpoints[0]
+	p.checkHealth()
+
+	return p, nil
+}
+
+func (p *readPool) Close() {
+	for _, endpoint := range p.endpoints {
+		endpoint.client.Close()
+	}
+}
+
+// The client we would use right now, for code that needs a raw client
+func (p *readPool) current() *ethclient.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.best.client
+}
+
+// The primary client, regardless of health
+func (p *readPool) primary() *ethclient.Client {
+	return p.endpoints[0].client
+}
+
+// The head block of the endpoint we would use right now, as of the last health check
+func (p *readPool) head() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.best.head
+}
+
+func (p *readPool) Client() *rpc.Client {
+	return p.current().Client()
+}
+
+func (p *readPool) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Millisecond * READ_POOL_HEALTH_CHECK_MS)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkHealth()
+		}
+	}
+}
+
+// Polls every endpoint's head block, marks the ones falling behind and picks the best
+func (p *readPool) checkHealth() {
+	var wg sync.WaitGroup
+
+	for _, endpoint := range p.endpoints {
+		wg.Add(1)
+		go func(endpoint *readEndpoint) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*READ_POOL_TIMEOUT_MS)
+			defer cancel()
+
+			start := time.Now()
+			head, err := endpoint.client.BlockNumber(ctx)
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+
+			p.record(endpoint, time.Since(start), err)
+			if err == nil {
+				endpoint.head = head
+			}
+		}(endpoint)
+	}
+
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var highestHead uint64
+	for _, endpoint := range p.endpoints {
+		if endpoint.head > highestHead {
+			highestHead = endpoint.head
+		}
+	}
+
+	for _, endpoint := range p.endpoints {
+		endpoint.lagging = endpoint.head+READ_POOL_MAX_BLOCK_LAG < highestHead
+	}
+
+	best := p.ranked()[0]
+	if best != p.best {
+		p.logger.Info("Switching read endpoint",
+			zap.String("from", p.best.name),
+			zap.String("to", best.name),
+			zap.Uint64("head", best.head),
+			zap.String("latency", best.latency.String()),
+			zap.Float64("errorRate", best.errorRate),
+		)
+		p.best = best
+	}
+}
+
+// Must be called with the lock held
+func (p *readPool) ranked() []*readEndpoint {
+	endpoints := make([]*readEndpoint, len(p.endpoints))
+	copy(endpoints, p.endpoints)
+
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return endpoints[i].score() < endpoints[j].score()
+	})
+
+	return endpoints
+}
+
+// Must be called with the lock held
+func (p *readPool) record(endpoint *readEndpoint, latency time.Duration, err error) {
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	}
+
+	endpoint.errorRate = endpoint.errorRate*(1-READ_POOL_EWMA_WEIGHT) + failed*READ_POOL_EWMA_WEIGHT
+
+	if err == nil {
+		if endpoint.latency == 0 {
+			endpoint.latency = latency
+		} else {
+			endpoint.latency = time.Duration(float64(endpoint.latency)*(1-READ_POOL_EWMA_WEIGHT) + float64(latency)*READ_POOL_EWMA_WEIGHT)
+		}
+	}
+}
+
+// Errors that any node would return for this request, so trying another one won't help
+func isDeterministicReadError(err error) bool {
+	if errors.Is(err, ethereum.NotFound) {
+		return true
+	}
+
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "revert")
+}
+
+// Runs a read on the best endpoint, and on the next ones while it keeps failing
+func (p *readPool) do(ctx context.Context, read func(client *ethclient.Client) error) error {
+	p.mu.Lock()
+	endpoints := p.ranked()
+	p.mu.Unlock()
+
+	var err error
+	for _, endpoint := range endpoints {
+		start := time.Now()
+		err = read(endpoint.client)
+
+		if err != nil && (ctx.Err() != nil || isDeterministicReadError(err)) {
+			// Not the endpoint's fault
+			return err
+		}
+
+		p.mu.Lock()
+		p.record(endpoint, time.Since(start), err)
+		p.mu.Unlock()
+
+		if err == nil {
+			return nil
+		}
+
+		p.logger.Debug("Read failed, trying next endpoint", zap.String("endpoint", endpoint.name), zap.Error(err))
+	}
+
+	return err
+}
+
+func (p *readPool) ChainID(ctx context.Context) (*big.Int, error) {
+	var result *big.Int
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.ChainID(ctx)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) BlockNumber(ctx context.Context) (uint64, error) {
+	var result uint64
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.BlockNumber(ctx)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var result *types.Header
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.HeaderByNumber(ctx, number)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	var result *types.Receipt
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.TransactionReceipt(ctx, txHash)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	var result *big.Int
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.BalanceAt(ctx, account, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	var result []byte
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.CodeAt(ctx, account, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	var result []byte
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.PendingCodeAt(ctx, account)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	var result uint64
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.NonceAt(ctx, account, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	var result uint64
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.PendingNonceAt(ctx, account)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var result []byte
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.CallContract(ctx, msg, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) PendingCallContract(ctx context.Context, msg ethereum.CallMsg) ([]byte, error) {
+	var result []byte
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.PendingCallContract(ctx, msg)
+		return err
+	})
+	return result, err
+}
+
+// Per-call errors stay on the elems, only a failed request moves on to the next endpoint
+func (p *readPool) BatchCallContext(ctx context.Context, batch []rpc.BatchElem) error {
+	return p.do(ctx, func(client *ethclient.Client) error {
+		return client.Client().BatchCallContext(ctx, batch)
+	})
+}
+
+func (p *readPool) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	var result *big.Int
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.SuggestGasPrice(ctx)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	var result *big.Int
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.SuggestGasTipCap(ctx)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	var result *ethereum.FeeHistory
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	var result uint64
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.EstimateGas(ctx, msg)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	var result []types.Log
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.FilterLogs(ctx, query)
+		return err
+	})
+	return result, err
+}
+
+// Txs never go through the read pool, they are signed only and sent by the broadcaster
+func (p *readPool) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return p.broadcast.send(ctx, tx)
+}
+
+// Subscriptions stay on the endpoint they were made on, failover only happens when subscribing
+func (p *readPool) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	var result ethereum.Subscription
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.SubscribeFilterLogs(ctx, query, ch)
+		return err
+	})
+	return result, err
+}
+
+func (p *readPool) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	var result ethereum.Subscription
+	err := p.do(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.SubscribeNewHead(ctx, ch)
+		return err
+	})
+	return result, err
+}
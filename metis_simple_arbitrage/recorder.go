@@ -0,0 +1,381 @@
+package metis_simple_arbitrage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+const (
+	journalKindLog      = "log"
+	journalKindReserves = "reserves"
+	journalKindArbs     = "arbs"
+	journalKindTx       = "tx"
+)
+
+// One line of the journal, only the fields of its kind are set
+type journalEntry struct {
+	Kind     string                    `json:"k"`
+	Block    uint64                    `json:"b"`
+	Time     int64                     `json:"t"`
+	Log      *types.Log                `json:"log,omitempty"`
+	Reserves [][3]*big.Int             `json:"reserves,omitempty"`
+	Token    *common.Address           `json:"token,omitempty"`
+	Arbs     []FlashSwapExecutorV1.Arb `json:"arbs,omitempty"`
+	TxHash   *common.Hash              `json:"txHash,omitempty"`
+	From     *common.Address           `json:"from,omitempty"`
+	Nonce    uint64                    `json:"nonce,omitempty"`
+}
+
+// Appends what the bot sees and decides to rotating jsonl files, so production issues can be replayed
+// A nil recorder records nothing, so callers don't need to check if it is enabled
+type recorder struct {
+	dir       string
+	entries   chan journalEntry
+	done      chan struct{}
+	mu        sync.Mutex
+	lastBlock uint64
+	dropped   int
+	closed    bool
+	logger    *zap.Logger
+}
+
+func newRecorder(dir string, logger *zap.Logger) (*recorder, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &recorder{
+		dir:     dir,
+		entries: make(chan journalEntry, RECORDER_BUFFER),
+		done:    make(chan struct{}),
+		logger:  logger,
+	}
+
+	go r.write()
+
+	return r, nil
+}
+
+// Flushes what is buffered and closes the current file
+func (r *recorder) close() {
+	if r == nil {
+		return
+	}
+
+	// Workers like the PGA and the tracker may still record after shutdown, they are dropped from here on
+	r.mu.Lock()
+	r.closed = true
+	close(r.entries)
+	r.mu.Unlock()
+
+	<-r.done
+}
+
+func (r *recorder) recordLog(vLog types.Log) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	if vLog.BlockNumber > r.lastBlock {
+		r.lastBlock = vLog.BlockNumber
+	}
+	r.mu.Unlock()
+
+	r.record(journalEntry{Kind: journalKindLog, Block: vLog.BlockNumber, Log: &vLog})
+}
+
+// Reserve refreshes carry no block, we take the newest head we know of
+func (r *recorder) recordReserves(blockNumber uint64, reserves [][3]*big.Int) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	if blockNumber > r.lastBlock {
+		r.lastBlock = blockNumber
+	}
+	blockNumber = r.lastBlock
+	r.mu.Unlock()
+
+	// Copy, the bot keeps updating the reserves in place
+	snapshot := make([][3]*big.Int, len(reserves))
+	for i, reserve := range reserves {
+		for j := range reserve {
+			if reserve[j] != nil {
+				snapshot[i][j] = new(big.Int).Set(reserve[j])
+			}
+		}
+	}
+
+	r.record(journalEntry{Kind: journalKindReserves, Block: blockNumber, Reserves: snapshot})
+}
+
+func (r *recorder) recordArbs(blockNumber uint64, tokenAddress *common.Address, arbs []FlashSwapExecutorV1.Arb) {
+	if r == nil {
+		return
+	}
+
+	r.record(journalEntry{Kind: journalKindArbs, Block: blockNumber, Token: tokenAddress, Arbs: arbs})
+}
+
+func (r *recorder) recordTx(tx *types.Transaction, from common.Address, arbs []FlashSwapExecutorV1.Arb) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	blockNumber := r.lastBlock
+	r.mu.Unlock()
+
+	hash := tx.Hash()
+	r.record(journalEntry{Kind: journalKindTx, Block: blockNumber, TxHash: &hash, From: &from, Nonce: tx.Nonce(), Arbs: arbs})
+}
+
+// Never blocks the hot path, entries are dropped when the writer can't keep up
+func (r *recorder) record(entry journalEntry) {
+	entry.Time = time.Now().UnixNano()
+
+	// The send never blocks, so holding the lock keeps it from racing close
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+
+	select {
+	case r.entries <- entry:
+		r.mu.Unlock()
+	default:
+		r.dropped++
+		dropped := r.dropped
+		r.mu.Unlock()
+
+		if dropped%RECORDER_BUFFER == 1 {
+			r.logger.Error("Recorder buffer full, dropping entries", zap.Int("dropped", dropped))
+		}
+	}
+}
+
+func (r *recorder) write() {
+	defer close(r.done)
+
+	var file *os.File
+	var writer *bufio.Writer
+	var written int
+
+	closeFile := func() {
+		if file == nil {
+			return
+		}
+		writer.Flush()
+		file.Close()
+		file = nil
+	}
+	defer closeFile()
+
+	flushTicker := time.NewTicker(time.Second)
+	defer flushTicker.Stop()
+
+	for {
+		select {
+		case <-flushTicker.C:
+			if writer != nil {
+				writer.Flush()
+			}
+		case entry, ok := <-r.entries:
+			if !ok {
+				return
+			}
+
+			if file == nil || written >= RECORDER_MAX_FILE_BYTES {
+				closeFile()
+
+				var err error
+				file, err = os.Create(filepath.Join(r.dir, fmt.Sprintf("journal-%d.jsonl", time.Now().UnixNano())))
+				if err != nil {
+					r.logger.Error("Error creating journal file", zap.Error(err))
+					continue
+				}
+				writer = bufio.NewWriter(file)
+				written = 0
+
+				r.rotate()
+			}
+
+			line, err := json.Marshal(entry)
+			if err != nil {
+				r.logger.Error("Error marshalling journal entry", zap.Error(err))
+				continue
+			}
+
+			n, _ := writer.Write(append(line, '\n'))
+			written += n
+		}
+	}
+}
+
+// Deletes the oldest journal files past our limit
+func (r *recorder) rotate() {
+	files, err := journalFiles(r.dir)
+	if err != nil {
+		r.logger.Error("Error listing journal files", zap.Error(err))
+		return
+	}
+
+	for len(files) > RECORDER_MAX_FILES {
+		err := os.Remove(files[0])
+		if err != nil {
+			r.logger.Error("Error removing journal file", zap.Error(err))
+		}
+		files = files[1:]
+	}
+}
+
+// Journal files oldest first
+func journalFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), "journal-") && strings.HasSuffix(entry.Name(), ".jsonl") {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// The recorded Sync logs after a block, in the format the backtester replays
+func (s *botState) journalLogsAfter(journalDir string, blockNumber uint64) ([]types.Log, error) {
+	entries, err := s.loadJournal(journalDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []types.Log
+	for _, entry := range entries {
+		if entry.Kind == journalKindLog && entry.Log != nil && entry.Block > blockNumber {
+			logs = append(logs, *entry.Log)
+		}
+	}
+
+	return logs, nil
+}
+
+// Reads every entry of the journal in the order it was written
+func (s *botState) loadJournal(dir string) ([]journalEntry, error) {
+	files, err := journalFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []journalEntry
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 1024*1024), RECORDER_MAX_LINE_BYTES)
+
+		for scanner.Scan() {
+			var entry journalEntry
+			err := json.Unmarshal(scanner.Bytes(), &entry)
+			if err != nil {
+				// The last line of a file can be cut off if the bot died mid write
+				s.logger.Info("Skipping unreadable journal line", zap.String("file", path), zap.Error(err))
+				continue
+			}
+			entries = append(entries, entry)
+		}
+
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// Puts the market state back to how it was at the end of a recorded block
+// The pairs come from the snapshot, the reserves from the last refresh before the block plus the logs after it
+// Pricing uses the settings the bot sets up from its config, so they must be set before
+func (s *botState) restoreMarketStateAt(snapshotPath string, journalDir string, blockNumber uint64) error {
+	if s.baseWei == nil {
+		return errors.New("pricing settings are not set up")
+	}
+
+	err := initContractABIs()
+	if err != nil {
+		return err
+	}
+
+	err = s.loadMarketSnapshot(snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	entries, err := s.loadJournal(journalDir)
+	if err != nil {
+		return err
+	}
+
+	// Start from the latest full refresh at or before the block
+	start := -1
+	for i, entry := range entries {
+		if entry.Kind == journalKindReserves && entry.Block <= blockNumber {
+			start = i
+		}
+	}
+
+	if start == -1 {
+		return fmt.Errorf("no reserves recorded at or before block %d", blockNumber)
+	}
+
+	if len(entries[start].Reserves) != len(s.allMarketAddresses) {
+		return fmt.Errorf("recorded reserves cover %d markets, snapshot has %d", len(entries[start].Reserves), len(s.allMarketAddresses))
+	}
+
+	s.allMarketReserves = entries[start].Reserves
+
+	for _, entry := range entries[start+1:] {
+		if entry.Kind != journalKindLog || entry.Log == nil || entry.Block > blockNumber {
+			continue
+		}
+		if _, ok := s.marketMapping[entry.Log.Address]; !ok {
+			continue
+		}
+		s.updateReservesByEvent(*entry.Log)
+	}
+
+	s.priceMarkets()
+	s.markReservesAsStale()
+
+	s.logger.Info("Restored market state", zap.Uint64("blockNumber", blockNumber), zap.Uint64("fromReservesAt", entries[start].Block))
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package metis_simple_arbitrage
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+// Workers still recording while the bot shuts down must not panic on the closed journal
+func TestRecorderRecordAfterClose(t *testing.T) {
+	r, err := newRecorder(t.TempDir(), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(block uint64) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				r.recordLog(types.Log{BlockNumber: block})
+			}
+		}(uint64(i))
+	}
+
+	r.close()
+	wg.Wait()
+
+	r.recordLog(types.Log{BlockNumber: 1})
+}
@@ -0,0 +1,318 @@
+package metis_simple_arbitrage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/cryptotriv/raikiri/lib/botconfig"
+	"github.com/cryptotriv/raikiri/lib/deployments"
+	"github.com/cryptotriv/raikiri/lib/ethmarket"
+	"github.com/cryptotriv/raikiri/lib/models"
+	"github.com/cryptotriv/raikiri/lib/util"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+// A crossed market the evaluator found while rebuilding a historical block
+type researchOpportunity struct {
+	BlockNumber    uint64         `json:"blockNumber"`
+	LogIndex       uint           `json:"logIndex"`
+	TxHash         common.Hash    `json:"txHash"`
+	Token          common.Address `json:"token"`
+	BuyFromPair    common.Address `json:"buyFromPair"`
+	BuyFromFactory common.Address `json:"buyFromFactory"`
+	SellToPair     common.Address `json:"sellToPair"`
+	SellToFactory  common.Address `json:"sellToFactory"`
+	Size           string         `json:"size"`
+	Profit         string         `json:"profit"`
+	ClosedInBlock  bool           `json:"closedInBlock"`
+
+	profit *big.Int
+}
+
+// Totals per buy and sell DEX
+type researchDexPair struct {
+	buyFromFactory common.Address
+	sellToFactory  common.Address
+	count          int
+	closedInBlock  int
+	profit         *big.Int
+}
+
+// Read-only: backfills Sync logs of our known markets over a block range and writes every opportunity the evaluator finds
+// Markets come from the snapshot the bot writes on startup
+func RunMetisSimpleArbitrageResearch(_logger *zap.Logger, fromBlock uint64, toBlock uint64, outputPath string) error {
+	if fromBlock == 0 || toBlock < fromBlock {
+		return errors.New("invalid block range")
+	}
+
+	s := newBotState(_logger)
+
+	s.allConfig, _, _ = botconfig.Get()
+	s.config = s.allConfig.MetisSimpleArbitrageBot
+
+	s.baseWei = util.ToWei(s.config.BaseNativePricingAmount, 18)
+	s.minProfitWei = util.ToWei(s.config.MinimumProfit, 18)
+	s.minProfitWeiFollowUp = util.ToWei(s.config.MinimumProfit/MIN_PROFIT_FOLLOWUP_DIVISOR, 18)
+
+	var err error
+	s.readClient, err = newReadPool([]string{s.config.AvailableNetworks[s.config.ReadAndWriteNetworkIndex]}, s.logger)
+	if err != nil {
+		return err
+	}
+	defer s.readClient.Close()
+
+	err = initContractABIs()
+	if err != nil {
+		return err
+	}
+
+	err = s.loadMarketSnapshot(DATA_BASEPATH)
+	if err != nil {
+		return err
+	}
+
+	reserveSource, err := newChainSource(s.config.ReserveSource, s.readClient, func(name string) (common.Address, error) {
+		return deployments.GetDeployedContract(s.readClient.current(), name)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Start from the reserves right before the range
+	err = s.loadReservesAt(reserveSource, new(big.Int).SetUint64(fromBlock-1))
+	if err != nil {
+		return err
+	}
+
+	s.priceMarkets()
+	s.markReservesAsStale()
+
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	writer := bufio.NewWriter(output)
+	defer writer.Flush()
+
+	dexPairs := make(map[[2]common.Address]*researchDexPair)
+	totalOpportunities := 0
+
+	for chunkStart := fromBlock; chunkStart <= toBlock; chunkStart += RESEARCH_LOG_CHUNK_BLOCKS {
+		chunkEnd := chunkStart + RESEARCH_LOG_CHUNK_BLOCKS - 1
+		if chunkEnd > toBlock {
+			chunkEnd = toBlock
+		}
+
+		logs, err := s.fetchSyncLogs(chunkStart, chunkEnd)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < len(logs); {
+			end := i
+			for end < len(logs) && logs[end].BlockNumber == logs[i].BlockNumber {
+				end++
+			}
+
+			opportunities := s.researchBlock(logs[i:end])
+			i = end
+
+			for _, opportunity := range opportunities {
+				line, err := json.Marshal(opportunity)
+				if err != nil {
+					return err
+				}
+
+				_, err = writer.Write(append(line, '\n'))
+				if err != nil {
+					return err
+				}
+
+				key := [2]common.Address{opportunity.BuyFromFactory, opportunity.SellToFactory}
+				if _, ok := dexPairs[key]; !ok {
+					dexPairs[key] = &researchDexPair{buyFromFactory: key[0], sellToFactory: key[1], profit: big.NewInt(0)}
+				}
+				dexPairs[key].count++
+				dexPairs[key].profit.Add(dexPairs[key].profit, opportunity.profit)
+				if opportunity.ClosedInBlock {
+					dexPairs[key].closedInBlock++
+				}
+			}
+
+			totalOpportunities += len(opportunities)
+		}
+
+		s.logger.Info("Research progress", zap.Uint64("toBlock", chunkEnd), zap.Int("logs", len(logs)), zap.Int("opportunities", totalOpportunities))
+	}
+
+	s.logResearchSummary(dexPairs, fromBlock, toBlock, totalOpportunities)
+
+	return nil
+}
+
+// Same batching as updateReservesBatched, but at a past block
+func (s *botState) loadReservesAt(reserveSource ReserveSource, blockNumber *big.Int) error {
+	var reserves [][3]*big.Int
+
+	for start := 0; start < len(s.allMarketAddresses); start += UNISWAP_BATCH_SIZE {
+		end := start + UNISWAP_BATCH_SIZE
+		if end > len(s.allMarketAddresses) {
+			end = len(s.allMarketAddresses)
+		}
+
+		batch, err := reserveSource.GetReserves(&bind.CallOpts{BlockNumber: blockNumber}, s.allMarketAddresses[start:end])
+		if err != nil {
+			return err
+		}
+
+		reserves = append(reserves, batch...)
+	}
+
+	s.allMarketReserves = reserves
+
+	return nil
+}
+
+// Sync logs of our markets in a block range, ordered the way they happened
+func (s *botState) fetchSyncLogs(fromBlock uint64, toBlock uint64) ([]types.Log, error) {
+	var logs []types.Log
+
+	// Nodes limit how many addresses one filter can have
+	for start := 0; start < len(s.allMarketAddresses); start += RESEARCH_LOG_ADDRESS_CHUNK {
+		end := start + RESEARCH_LOG_ADDRESS_CHUNK
+		if end > len(s.allMarketAddresses) {
+			end = len(s.allMarketAddresses)
+		}
+
+		query := ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(fromBlock),
+			ToBlock:   new(big.Int).SetUint64(toBlock),
+			Addresses: s.allMarketAddresses[start:end],
+			Topics:    [][]common.Hash{{uniV2EventHash, hermesEventHash}},
+		}
+
+		chunkLogs, err := s.readClient.FilterLogs(context.Background(), query)
+		if err != nil {
+			return nil, err
+		}
+
+		logs = append(logs, chunkLogs...)
+	}
+
+	return s.filterBacktestLogs(logs), nil
+}
+
+// Replays one block event by event, then checks which spreads were still open once the whole block was in
+func (s *botState) researchBlock(blockLogs []types.Log) []*researchOpportunity {
+	var opportunities []*researchOpportunity
+	seen := make(map[[2]common.Address]*researchOpportunity)
+
+	for _, vLog := range blockLogs {
+		tokenAddr := s.updateReservesByEvent(vLog)
+		arbs := s.evaluateMarketsRecursive(false, tokenAddr, 0)
+		s.markReservesAsStale()
+
+		for _, arb := range arbs {
+			key := [2]common.Address{arb.BuyFromPair, arb.SellToPair}
+
+			// Keep the first time we saw it in this block, with the best profit it reached
+			if opportunity, ok := seen[key]; ok {
+				if arb.Profit.Cmp(opportunity.profit) > 0 {
+					opportunity.profit = arb.Profit
+					opportunity.Size = util.ToDecimal(arb.NativeInAmount, 18).String()
+					opportunity.Profit = util.ToDecimal(arb.Profit, 18).String()
+				}
+				continue
+			}
+
+			buyPair := s.pairByMarketAddress(arb.BuyFromPair)
+			sellPair := s.pairByMarketAddress(arb.SellToPair)
+
+			opportunity := &researchOpportunity{
+				BlockNumber:    vLog.BlockNumber,
+				LogIndex:       vLog.Index,
+				TxHash:         vLog.TxHash,
+				Token:          tokenAddr,
+				BuyFromPair:    arb.BuyFromPair,
+				BuyFromFactory: buyPair.Factory,
+				SellToPair:     arb.SellToPair,
+				SellToFactory:  sellPair.Factory,
+				Size:           util.ToDecimal(arb.NativeInAmount, 18).String(),
+				Profit:         util.ToDecimal(arb.Profit, 18).String(),
+				profit:         arb.Profit,
+			}
+
+			seen[key] = opportunity
+			opportunities = append(opportunities, opportunity)
+		}
+	}
+
+	// Someone else closed it within the block if it no longer pays at the end of it
+	for _, opportunity := range opportunities {
+		_, profit := s.crossedMarketProfit(s.pairByMarketAddress(opportunity.BuyFromPair), s.pairByMarketAddress(opportunity.SellToPair))
+		opportunity.ClosedInBlock = profit.Cmp(s.minProfitWei) <= 0
+	}
+
+	return opportunities
+}
+
+// Optimal size and profit for buying from one pair and selling to the other, at the current reserves
+func (s *botState) crossedMarketProfit(buyFromPair models.UniswappyV2Pair, sellToPair models.UniswappyV2Pair) (*big.Int, *big.Int) {
+	buyReserves := s.allMarketReserves[buyFromPair.TokenReserveIndex]
+	sellReserves := s.allMarketReserves[sellToPair.TokenReserveIndex]
+
+	optimalSize := ethmarket.CalculateOptimalTokenInTwoFees(
+		buyReserves[buyFromPair.NativeIndex],
+		buyReserves[buyFromPair.TokenIndex],
+		sellReserves[sellToPair.TokenIndex],
+		sellReserves[sellToPair.NativeIndex],
+		buyFromPair.FeePerTenThousands,
+		sellToPair.FeePerTenThousands).BigInt()
+
+	if optimalSize.Sign() <= 0 {
+		return big.NewInt(0), big.NewInt(0)
+	}
+
+	tokensOut := ethmarket.GetAmountOut(buyReserves[buyFromPair.NativeIndex], buyReserves[buyFromPair.TokenIndex], optimalSize, buyFromPair.FeePerTenThousands)
+	nativeOut := ethmarket.GetAmountOut(sellReserves[sellToPair.TokenIndex], sellReserves[sellToPair.NativeIndex], tokensOut, sellToPair.FeePerTenThousands)
+
+	return optimalSize, new(big.Int).Sub(nativeOut, optimalSize)
+}
+
+func (s *botState) logResearchSummary(dexPairs map[[2]common.Address]*researchDexPair, fromBlock uint64, toBlock uint64, totalOpportunities int) {
+	var sorted []*researchDexPair
+	for _, dexPair := range dexPairs {
+		sorted = append(sorted, dexPair)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].profit.Cmp(sorted[j].profit) > 0
+	})
+
+	s.logger.Info("Research done",
+		zap.Uint64("fromBlock", fromBlock),
+		zap.Uint64("toBlock", toBlock),
+		zap.Int("opportunities", totalOpportunities),
+	)
+
+	for _, dexPair := range sorted {
+		s.logger.Info("Opportunities by DEX pair",
+			zap.String("buyFromFactory", dexPair.buyFromFactory.Hex()),
+			zap.String("sellToFactory", dexPair.sellToFactory.Hex()),
+			zap.Int("count", dexPair.count),
+			zap.Int("closedInBlock", dexPair.closedInBlock),
+			zap.String("profit", util.ToDecimal(dexPair.profit, 18).String()),
+		)
+	}
+}
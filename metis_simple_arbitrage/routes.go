@@ -0,0 +1,222 @@
+package metis_simple_arbitrage
+
+import (
+	"math/big"
+
+	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
+	"github.com/cryptotriv/raikiri/lib/ethmarket"
+	"github.com/cryptotriv/raikiri/lib/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type routeLeg struct {
+	buyFrom  int
+	sellTo   int
+	nativeIn *big.Int
+}
+
+// Finds a split of the trade across several buy and sell pools of the same token
+// Returns the route as a sequence of legs that the executor runs one after another, together with their crossed markets
+// Every leg after the first continues the route, so the executor runs them at these sizes or not at all
+// minProfit is what the evaluator asks of an arb, the route keeps growing while the best pairwise arb left still clears it
+func (s *botState) findSplitRoute(pairs []models.UniswappyV2Pair, minProfit *big.Int) ([]FlashSwapExecutorV1.Arb, [][2]models.UniswappyV2Pair, *big.Int) {
+	totalProfit := big.NewInt(0)
+
+	if len(pairs) < SPLIT_ROUTE_MIN_PAIRS {
+		return nil, nil, totalProfit
+	}
+
+	// Work on a copy of the reserves so we never touch allMarketReserves
+	nativeReserves, tokenReserves := s.copyRouteReserves(pairs)
+
+	var legs []routeLeg
+
+	// Water-fill: repeatedly trade a fraction of the best pairwise optimum until the marginal prices even out
+	for iteration := 0; iteration < SPLIT_ROUTE_MAX_ITERATIONS; iteration++ {
+		bestBuy, bestSell := -1, -1
+		var bestSize, bestProfit *big.Int
+
+		for buy := range pairs {
+			for sell := range pairs {
+				if buy == sell {
+					continue
+				}
+
+				// Split routes are only worth it on markets we trust, capping isn't tried here
+				if s.twap.manipulated(pairs[buy], pairs[sell]) {
+					continue
+				}
+
+				size := ethmarket.CalculateOptimalTokenInTwoFees(
+					nativeReserves[buy],
+					tokenReserves[buy],
+					tokenReserves[sell],
+					nativeReserves[sell],
+					pairs[buy].FeePerTenThousands,
+					pairs[sell].FeePerTenThousands).BigInt()
+
+				if size.Sign() <= 0 {
+					continue
+				}
+
+				tokensOut := ethmarket.GetAmountOut(nativeReserves[buy], tokenReserves[buy], size, pairs[buy].FeePerTenThousands)
+				nativeOut := ethmarket.GetAmountOut(tokenReserves[sell], nativeReserves[sell], tokensOut, pairs[sell].FeePerTenThousands)
+				profit := new(big.Int).Sub(nativeOut, size)
+
+				if profit.Sign() > 0 && (bestProfit == nil || profit.Cmp(bestProfit) > 0) {
+					bestBuy, bestSell = buy, sell
+					bestSize, bestProfit = size, profit
+				}
+			}
+		}
+
+		if bestBuy == -1 || bestProfit.Cmp(minProfit) <= 0 {
+			break
+		}
+
+		// Only take a step of the optimum so that other pools can become competitive
+		step := new(big.Int).Div(bestSize, big.NewInt(SPLIT_ROUTE_STEP_DIVISOR))
+		if step.Sign() == 0 {
+			break
+		}
+
+		applyRouteLeg(pairs, nativeReserves, tokenReserves, bestBuy, bestSell, step)
+		legs = appendRouteLeg(legs, bestBuy, bestSell, step)
+	}
+
+	if len(legs) < 2 {
+		// A single leg is the plain pairwise arb, which the evaluator already found
+		return nil, nil, totalProfit
+	}
+
+	// Re-run the merged legs in execution order with exact reserve math
+	// This is what the executor sees, since every leg trades against the reserves left by the previous one
+	nativeReserves, tokenReserves = s.copyRouteReserves(pairs)
+
+	var arbs []FlashSwapExecutorV1.Arb
+	var arbsCrossedMarkets [][2]models.UniswappyV2Pair
+
+	for _, leg := range legs {
+		if len(arbs) >= MAX_ARB_PER_TX {
+			break
+		}
+
+		buyPair := pairs[leg.buyFrom]
+		sellPair := pairs[leg.sellTo]
+
+		tokensOut := ethmarket.GetAmountOut(nativeReserves[leg.buyFrom], tokenReserves[leg.buyFrom], leg.nativeIn, buyPair.FeePerTenThousands)
+		nativeOut := ethmarket.GetAmountOut(tokenReserves[leg.sellTo], nativeReserves[leg.sellTo], tokensOut, sellPair.FeePerTenThousands)
+		profit := new(big.Int).Sub(nativeOut, leg.nativeIn)
+
+		// A losing leg only eats into what the others make
+		if profit.Sign() <= 0 {
+			continue
+		}
+
+		applyRouteLeg(pairs, nativeReserves, tokenReserves, leg.buyFrom, leg.sellTo, leg.nativeIn)
+
+		arbs = append(arbs, FlashSwapExecutorV1.Arb{
+			BuyFromPair:     buyPair.MarketAdress,
+			NativeInAmount:  new(big.Int).Set(leg.nativeIn),
+			TokenAmount:     tokensOut,
+			NativeOutAmount: nativeOut,
+			SellToPair:      sellPair.MarketAdress,
+			Profit:          profit,
+			BuyFromFee:      uint8(buyPair.FeePerTenThousands),
+			SellToFee:       uint8(sellPair.FeePerTenThousands),
+			BuyFromIsWMetis: buyPair.WethAddress == common.HexToAddress(WMETIS_TOKEN_ADDRESS),
+			SellToIsWMetis:  sellPair.WethAddress == common.HexToAddress(WMETIS_TOKEN_ADDRESS),
+			ContinuesRoute:  len(arbs) > 0,
+		})
+		arbsCrossedMarkets = append(arbsCrossedMarkets, [2]models.UniswappyV2Pair{sellPair, buyPair})
+
+		totalProfit.Add(totalProfit, profit)
+	}
+
+	// The executor takes the route as a whole, so it has to pay as a whole
+	if len(arbs) < 2 || totalProfit.Cmp(minProfit) <= 0 {
+		return nil, nil, big.NewInt(0)
+	}
+
+	return arbs, arbsCrossedMarkets, totalProfit
+}
+
+func (s *botState) copyRouteReserves(pairs []models.UniswappyV2Pair) ([]*big.Int, []*big.Int) {
+	nativeReserves := make([]*big.Int, len(pairs))
+	tokenReserves := make([]*big.Int, len(pairs))
+
+	for i, pair := range pairs {
+		nativeReserves[i] = new(big.Int).Set(s.allMarketReserves[pair.TokenReserveIndex][pair.NativeIndex])
+		tokenReserves[i] = new(big.Int).Set(s.allMarketReserves[pair.TokenReserveIndex][pair.TokenIndex])
+	}
+
+	return nativeReserves, tokenReserves
+}
+
+func applyRouteLeg(pairs []models.UniswappyV2Pair, nativeReserves []*big.Int, tokenReserves []*big.Int, buy int, sell int, nativeIn *big.Int) {
+	// Native goes into the buy pool and tokens come out, which then go into the sell pool for native
+	tokensOut := ethmarket.GetAmountOut(nativeReserves[buy], tokenReserves[buy], nativeIn, pairs[buy].FeePerTenThousands)
+	nativeOut := ethmarket.GetAmountOut(tokenReserves[sell], nativeReserves[sell], tokensOut, pairs[sell].FeePerTenThousands)
+
+	nativeReserves[buy].Add(nativeReserves[buy], reserveAmountIn(pairs[buy], nativeIn))
+	tokenReserves[buy].Sub(tokenReserves[buy], tokensOut)
+	tokenReserves[sell].Add(tokenReserves[sell], reserveAmountIn(pairs[sell], tokensOut))
+	nativeReserves[sell].Sub(nativeReserves[sell], nativeOut)
+}
+
+// What a pool keeps of an amount swapped in, Hermes pools send their fee out like updateReserveByArb accounts for
+func reserveAmountIn(pair models.UniswappyV2Pair, amountIn *big.Int) *big.Int {
+	if pair.Factory.Hex() != HERMES_FACTORY_ADDRESS {
+		return amountIn
+	}
+
+	fee := new(big.Int).Div(new(big.Int).Mul(amountIn, big.NewInt(pair.FeePerTenThousands)), big.NewInt(10000))
+	return new(big.Int).Sub(amountIn, fee)
+}
+
+func appendRouteLeg(legs []routeLeg, buy int, sell int, nativeIn *big.Int) []routeLeg {
+	// Merge steps on the same pools into one leg, keeping the order they were first found in
+	for i := range legs {
+		if legs[i].buyFrom == buy && legs[i].sellTo == sell {
+			legs[i].nativeIn.Add(legs[i].nativeIn, nativeIn)
+			return legs
+		}
+	}
+
+	return append(legs, routeLeg{buyFrom: buy, sellTo: sell, nativeIn: new(big.Int).Set(nativeIn)})
+}
+
+func (s *botState) isBetterRoute(routeProfit *big.Int, bestArb FlashSwapExecutorV1.Arb, profitOpportunityFound bool, isFollowUp bool) bool {
+	if profitOpportunityFound {
+		return routeProfit.Cmp(bestArb.Profit) > 0
+	}
+
+	// Without a pairwise arb, the route alone has to clear the minimum profit
+	return routeProfit.Cmp(s.evaluationMinProfit(isFollowUp)) > 0
+}
+
+// The profit an arb needs for the evaluator to take it
+func (s *botState) evaluationMinProfit(isFollowUp bool) *big.Int {
+	if isFollowUp {
+		return s.minProfitWeiFollowUp
+	}
+
+	return s.minProfitWei
+}
+
+// Splits arbs into what the executor runs as one unit, a plain arb or all the legs of a route
+func arbGroups(arbs []FlashSwapExecutorV1.Arb) [][]FlashSwapExecutorV1.Arb {
+	var groups [][]FlashSwapExecutorV1.Arb
+
+	for start := 0; start < len(arbs); {
+		end := start + 1
+		for end < len(arbs) && arbs[end].ContinuesRoute {
+			end++
+		}
+
+		groups = append(groups, arbs[start:end])
+		start = end
+	}
+
+	return groups
+}
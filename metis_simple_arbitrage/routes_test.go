@@ -0,0 +1,190 @@
+package metis_simple_arbitrage
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/cryptotriv/raikiri/lib/models"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+)
+
+// A pool as [native, token] reserves in whole tokens
+type routeTestPool struct {
+	native int64
+	token  int64
+	hermes bool
+}
+
+func TestFindSplitRoute(t *testing.T) {
+	tests := []struct {
+		name      string
+		pools     []routeTestPool
+		wantRoute bool
+	}{
+		{
+			name:      "two cheap pools into one dear pool",
+			pools:     []routeTestPool{{1000, 1000, false}, {1000, 1000, false}, {1000, 800, false}},
+			wantRoute: true,
+		},
+		{
+			name:      "one cheap pool into two dear pools",
+			pools:     []routeTestPool{{1000, 1000, false}, {1000, 800, false}, {1000, 800, false}},
+			wantRoute: true,
+		},
+		{
+			name:      "hermes pools on both sides",
+			pools:     []routeTestPool{{1000, 1000, true}, {1000, 1000, false}, {1000, 800, true}},
+			wantRoute: true,
+		},
+		{
+			name:      "a small cheap pool still adds to the route",
+			pools:     []routeTestPool{{1000, 1000, false}, {1000, 800, false}, {10, 10, false}},
+			wantRoute: true,
+		},
+		{
+			name:      "two pools are a plain arb",
+			pools:     []routeTestPool{{1000, 1000, false}, {1000, 800, false}},
+			wantRoute: false,
+		},
+		{
+			name:      "no spread",
+			pools:     []routeTestPool{{1000, 1000, false}, {1000, 1000, false}, {1000, 1000, false}},
+			wantRoute: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, pairs := newRouteTestState(test.pools)
+
+			arbs, crossedMarkets, routeProfit := s.findSplitRoute(pairs, s.minProfitWei)
+
+			// The best single pairwise arb the evaluator would have taken instead
+			bestSingleProfit := big.NewInt(0)
+			for _, buyFromPair := range pairs {
+				for _, sellToPair := range pairs {
+					if buyFromPair.MarketAdress == sellToPair.MarketAdress {
+						continue
+					}
+
+					_, profit := s.crossedMarketProfit(buyFromPair, sellToPair)
+					if profit.Cmp(bestSingleProfit) > 0 {
+						bestSingleProfit = profit
+					}
+				}
+			}
+
+			if !test.wantRoute {
+				if len(arbs) > 1 && routeProfit.Cmp(bestSingleProfit) > 0 {
+					t.Fatalf("expected no better route, got %d legs for %s against %s single", len(arbs), routeProfit, bestSingleProfit)
+				}
+				return
+			}
+
+			if len(arbs) < 2 {
+				t.Fatalf("expected a route, got %d legs", len(arbs))
+			}
+
+			if routeProfit.Cmp(bestSingleProfit) <= 0 {
+				t.Fatalf("route profit %s does not beat the best single arb %s", routeProfit, bestSingleProfit)
+			}
+
+			if len(crossedMarkets) != len(arbs) {
+				t.Fatalf("expected crossed markets for each of the %d legs, got %d", len(arbs), len(crossedMarkets))
+			}
+
+			// The executor runs the legs as one unit
+			legProfit := big.NewInt(0)
+			for i, arb := range arbs {
+				if arb.ContinuesRoute != (i > 0) {
+					t.Fatalf("leg %d: continuesRoute is %v", i, arb.ContinuesRoute)
+				}
+				legProfit.Add(legProfit, arb.Profit)
+			}
+
+			if legProfit.Cmp(routeProfit) != 0 {
+				t.Fatalf("legs add up to %s, route profit is %s", legProfit, routeProfit)
+			}
+
+			if groups := arbGroups(arbs); len(groups) != 1 {
+				t.Fatalf("expected the legs to form one group, got %d", len(groups))
+			}
+		})
+	}
+}
+
+// Hermes pools don't keep their fee, so the legs after the first see less liquidity than a plain pool would leave
+func TestApplyRouteLegHermesFee(t *testing.T) {
+	for _, hermes := range []bool{false, true} {
+		s, pairs := newRouteTestState([]routeTestPool{{1000, 1000, hermes}, {1000, 800, hermes}})
+		nativeReserves, tokenReserves := s.copyRouteReserves(pairs)
+
+		nativeIn := routeTestWei(10)
+		applyRouteLeg(pairs, nativeReserves, tokenReserves, 0, 1, nativeIn)
+
+		wantKept := new(big.Int).Set(nativeIn)
+		if hermes {
+			wantKept.Sub(wantKept, new(big.Int).Div(new(big.Int).Mul(nativeIn, big.NewInt(pairs[0].FeePerTenThousands)), big.NewInt(10000)))
+		}
+
+		kept := new(big.Int).Sub(nativeReserves[0], routeTestWei(1000))
+		if kept.Cmp(wantKept) != 0 {
+			t.Fatalf("hermes %v: pool kept %s of %s, expected %s", hermes, kept, nativeIn, wantKept)
+		}
+	}
+}
+
+// Each bot prices from its own markets, setting up another one leaves them alone
+func TestBotStatesAreIndependent(t *testing.T) {
+	s, pairs := newRouteTestState([]routeTestPool{{1000, 1000, false}, {1000, 1000, false}, {1000, 800, false}})
+
+	other, _ := newRouteTestState([]routeTestPool{{1000, 1000, false}, {1000, 1000, false}, {1000, 1000, false}})
+	other.feePerTenThousands[NETSWAP_FACTORY_ADDRESS] = 0
+
+	if arbs, _, _ := s.findSplitRoute(pairs, s.minProfitWei); len(arbs) < 2 {
+		t.Fatalf("expected a route from the first bot's pools, got %d legs", len(arbs))
+	}
+
+	if s.feePerTenThousands[NETSWAP_FACTORY_ADDRESS] != uniswapV2FactoryAddressFeePerTenThousands[NETSWAP_FACTORY_ADDRESS] {
+		t.Fatal("the other bot's fee leaked into the first one")
+	}
+}
+
+// Puts the pools in allMarketReserves for one token, the way initAllMarketData indexes them
+func newRouteTestState(pools []routeTestPool) (*botState, []models.UniswappyV2Pair) {
+	s := newBotState(zap.NewNop())
+	s.minProfitWei = new(big.Int).Div(routeTestWei(1), big.NewInt(100))
+	s.minProfitWeiFollowUp = new(big.Int).Div(s.minProfitWei, big.NewInt(MIN_PROFIT_FOLLOWUP_DIVISOR))
+
+	token := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+	var pairs []models.UniswappyV2Pair
+	for i, pool := range pools {
+		factory := common.HexToAddress(NETSWAP_FACTORY_ADDRESS)
+		fee := int64(30)
+		if pool.hermes {
+			factory = common.HexToAddress(HERMES_FACTORY_ADDRESS)
+			fee = 1
+		}
+
+		s.allMarketReserves = append(s.allMarketReserves, [3]*big.Int{routeTestWei(pool.native), routeTestWei(pool.token), UPDATED_RESERVE})
+
+		pairs = append(pairs, models.UniswappyV2Pair{
+			MarketAdress:       common.BigToAddress(big.NewInt(int64(i + 1))),
+			Factory:            factory,
+			FeePerTenThousands: fee,
+			TokenAddresses:     [2]common.Address{common.HexToAddress(METIS_TOKEN_ADDRESS), token},
+			WethAddress:        common.HexToAddress(METIS_TOKEN_ADDRESS),
+			NativeIndex:        0,
+			TokenIndex:         1,
+			TokenReserveIndex:  i,
+		})
+	}
+
+	return s, pairs
+}
+
+func routeTestWei(amount int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(amount), big.NewInt(1e18))
+}
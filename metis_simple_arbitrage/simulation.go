@@ -0,0 +1,371 @@
+package metis_simple_arbitrage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
+	"github.com/cryptotriv/raikiri/lib/ethmarket"
+	"github.com/cryptotriv/raikiri/lib/util"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/loov/hrtime"
+	"go.uber.org/zap"
+)
+
+// Runs ExecuteNativeArb as an eth_call at the pending block before we broadcast it
+// Returns the arbs that are still worth sending
+func (s *botState) simulateArbs(
+	executorContractAddress common.Address,
+	fromAddress common.Address,
+	readClient *readPool,
+	arbs []FlashSwapExecutorV1.Arb) []FlashSwapExecutorV1.Arb {
+
+	start := hrtime.Now()
+	settings := s.currentSimulationSettings()
+
+	// Simulate in-process if every pool is in our local state
+	if s.localEVM != nil && s.localEVM.canSimulate(arbs) {
+		simulatedArbs := s.simulateArbsLocally(executorContractAddress, fromAddress, arbs)
+
+		s.logger.Debug("Local simulate arb done: ", zap.String("duration", hrtime.Since(start).String()))
+
+		return simulatedArbs
+	}
+
+	simulatedProfit, err := s.callExecuteNativeArb(executorContractAddress, fromAddress, readClient, settings.timeout, arbs)
+	if errors.Is(err, context.DeadlineExceeded) {
+		s.logger.Info("Simulation timed out", zap.Bool("sendAnyway", settings.sendOnTimeout))
+		if settings.sendOnTimeout {
+			return arbs
+		}
+		return nil
+	}
+
+	passedArbs := arbs
+
+	if err != nil {
+		s.logger.Info("Simulation reverted for arb tx", zap.String("reason", decodeRevert(err)))
+
+		// Find out which arbs are reverting by simulating each one on its own, a route with all its legs
+		// Each gets its own timeout, so one slow call doesn't decide for the others
+		groups := arbGroups(arbs)
+		passed := make([]bool, len(groups))
+
+		var wg sync.WaitGroup
+		for i := range groups {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := s.callExecuteNativeArb(executorContractAddress, fromAddress, readClient, settings.timeout, groups[i])
+				if errors.Is(err, context.DeadlineExceeded) {
+					s.logger.Debug("Simulation timed out for arb", zap.String("buyFromMarket", groups[i][0].BuyFromPair.Hex()), zap.Bool("sendAnyway", settings.sendOnTimeout))
+					passed[i] = settings.sendOnTimeout
+					return
+				} else if err != nil {
+					s.logger.Debug("Dropping reverting arb",
+						zap.String("buyFromMarket", groups[i][0].BuyFromPair.Hex()),
+						zap.String("sellToMarket", groups[i][0].SellToPair.Hex()),
+						zap.Int("legs", len(groups[i])),
+						zap.String("reason", decodeRevert(err)),
+					)
+					return
+				}
+				passed[i] = true
+			}(i)
+		}
+		wg.Wait()
+
+		passedArbs = nil
+		for i := range groups {
+			if passed[i] {
+				passedArbs = append(passedArbs, groups[i]...)
+			}
+		}
+
+		if len(passedArbs) == 0 {
+			return nil
+		}
+
+		// What the arbs left make together
+		simulatedProfit, err = s.callExecuteNativeArb(executorContractAddress, fromAddress, readClient, settings.timeout, passedArbs)
+		if errors.Is(err, context.DeadlineExceeded) {
+			s.logger.Info("Simulation timed out for remaining arbs", zap.Bool("sendAnyway", settings.sendOnTimeout))
+			if settings.sendOnTimeout {
+				return passedArbs
+			}
+			return nil
+		} else if err != nil {
+			s.logger.Info("Simulation reverted for remaining arbs", zap.String("reason", decodeRevert(err)))
+			return nil
+		}
+	}
+
+	predictedProfit := big.NewInt(0)
+	for _, arb := range passedArbs {
+		predictedProfit.Add(predictedProfit, arb.Profit)
+	}
+
+	s.logSimulationDivergence(predictedProfit, simulatedProfit, len(arbs), len(passedArbs))
+
+	s.logger.Debug("Simulate arb done: ", zap.String("duration", hrtime.Since(start).String()))
+
+	return s.keepProfitableArbs(passedArbs, simulatedProfit)
+}
+
+func (s *botState) simulateArbsLocally(
+	executorContractAddress common.Address,
+	fromAddress common.Address,
+	arbs []FlashSwapExecutorV1.Arb) []FlashSwapExecutorV1.Arb {
+
+	predictedProfit := big.NewInt(0)
+	for _, arb := range arbs {
+		predictedProfit.Add(predictedProfit, arb.Profit)
+	}
+
+	simulatedProfit, _, err := s.localEVM.executeNativeArb(fromAddress, executorContractAddress, arbs, s.minProfitWeiFollowUp)
+	if err == nil {
+		s.logSimulationDivergence(predictedProfit, simulatedProfit, len(arbs), len(arbs))
+		return s.keepProfitableArbs(arbs, simulatedProfit)
+	}
+
+	s.logger.Info("Local simulation reverted for arb tx", zap.String("reason", decodeRevert(err)))
+
+	// Find out which arbs are reverting by simulating each one on its own, a route with all its legs
+	var passedArbs []FlashSwapExecutorV1.Arb
+	for _, group := range arbGroups(arbs) {
+		_, _, err := s.localEVM.executeNativeArb(fromAddress, executorContractAddress, group, s.minProfitWeiFollowUp)
+		if err != nil {
+			s.logger.Debug("Dropping reverting arb",
+				zap.String("buyFromMarket", group[0].BuyFromPair.Hex()),
+				zap.String("sellToMarket", group[0].SellToPair.Hex()),
+				zap.Int("legs", len(group)),
+				zap.String("reason", decodeRevert(err)),
+			)
+			continue
+		}
+		passedArbs = append(passedArbs, group...)
+	}
+
+	if len(passedArbs) == 0 {
+		return nil
+	}
+
+	predictedProfit = big.NewInt(0)
+	for _, arb := range passedArbs {
+		predictedProfit.Add(predictedProfit, arb.Profit)
+	}
+
+	simulatedProfit, _, err = s.localEVM.executeNativeArb(fromAddress, executorContractAddress, passedArbs, s.minProfitWeiFollowUp)
+	if err != nil {
+		s.logger.Info("Local simulation reverted for remaining arbs", zap.String("reason", decodeRevert(err)))
+		return nil
+	}
+
+	s.logSimulationDivergence(predictedProfit, simulatedProfit, len(arbs), len(passedArbs))
+
+	return s.keepProfitableArbs(passedArbs, simulatedProfit)
+}
+
+// The executor would skip every arb when they make nothing together, so don't pay gas for them
+func (s *botState) keepProfitableArbs(arbs []FlashSwapExecutorV1.Arb, simulatedProfit *big.Int) []FlashSwapExecutorV1.Arb {
+	if simulatedProfit.Cmp(s.minProfitWeiFollowUp) <= 0 {
+		s.logger.Info("Simulated arb tx makes no profit, skipping", zap.String("simulatedProfit", util.ToDecimal(simulatedProfit, 18).String()))
+		return nil
+	}
+
+	return arbs
+}
+
+// Runs ExecuteNativeArb as an eth_call at the pending block, under its own timeout
+// Returns the profit the executor reports, which is what it would send us
+func (s *botState) callExecuteNativeArb(
+	executorContractAddress common.Address,
+	fromAddress common.Address,
+	readClient *readPool,
+	timeout time.Duration,
+	arbs []FlashSwapExecutorV1.Arb) (*big.Int, error) {
+
+	data, err := executorABI.Pack("executeNativeArb", arbs, s.minProfitWeiFollowUp)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := ethereum.CallMsg{
+		From: fromAddress,
+		To:   &executorContractAddress,
+		Gas:  GAS_LIMIT_DEFAULT,
+		Data: data,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output, err := readClient.PendingCallContract(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return unpackExecutorProfit(output)
+}
+
+func unpackExecutorProfit(output []byte) (*big.Int, error) {
+	values, err := executorABI.Unpack("executeNativeArb", output)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 1 {
+		return nil, fmt.Errorf("executeNativeArb returned %d values", len(values))
+	}
+
+	profit, ok := values[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("executeNativeArb returned a %T", values[0])
+	}
+
+	return profit, nil
+}
+
+// Runs arbs one after the other against [native, token] reserves keyed by pair, updating them as it goes
+// Returns the arbs the executor would actually take, with the predicted and simulated profits
+func (s *botState) priceArbsAgainstReserves(reserves map[common.Address][2]*big.Int, arbs []FlashSwapExecutorV1.Arb) ([]FlashSwapExecutorV1.Arb, *big.Int, *big.Int) {
+	predictedProfit := big.NewInt(0)
+	simulatedProfit := big.NewInt(0)
+
+	var simulatedArbs []FlashSwapExecutorV1.Arb
+
+	for _, group := range arbGroups(arbs) {
+		for _, arb := range group {
+			predictedProfit.Add(predictedProfit, arb.Profit)
+		}
+
+		// A route is priced on a copy, the executor only keeps its trades if all the legs together pay
+		groupReserves := reserves
+		if len(group) > 1 {
+			groupReserves = make(map[common.Address][2]*big.Int)
+			for _, arb := range group {
+				for _, pairAddress := range []common.Address{arb.BuyFromPair, arb.SellToPair} {
+					groupReserves[pairAddress] = [2]*big.Int{new(big.Int).Set(reserves[pairAddress][0]), new(big.Int).Set(reserves[pairAddress][1])}
+				}
+			}
+		}
+
+		groupProfit := big.NewInt(0)
+		for _, arb := range group {
+			profit, taken := s.priceArb(groupReserves, arb, len(group) > 1)
+			if taken {
+				groupProfit.Add(groupProfit, profit)
+			}
+		}
+
+		// The executor would skip it, so don't pay gas for it
+		if groupProfit.Cmp(s.minProfitWeiFollowUp) <= 0 {
+			continue
+		}
+
+		if len(group) > 1 {
+			for pairAddress, pairReserves := range groupReserves {
+				reserves[pairAddress][0].Set(pairReserves[0])
+				reserves[pairAddress][1].Set(pairReserves[1])
+			}
+		}
+
+		simulatedProfit.Add(simulatedProfit, groupProfit)
+		simulatedArbs = append(simulatedArbs, group...)
+	}
+
+	return simulatedArbs, predictedProfit, simulatedProfit
+}
+
+// Same steps as the executor: buy token with native, sell token for native
+// A plain arb is only traded if it clears the minimum on its own, route legs are always traded
+func (s *botState) priceArb(reserves map[common.Address][2]*big.Int, arb FlashSwapExecutorV1.Arb, isRouteLeg bool) (*big.Int, bool) {
+	buyPair := s.pairByMarketAddress(arb.BuyFromPair)
+	sellPair := s.pairByMarketAddress(arb.SellToPair)
+
+	buyReserves := reserves[arb.BuyFromPair]
+	sellReserves := reserves[arb.SellToPair]
+
+	tokensOut := ethmarket.GetAmountOut(buyReserves[0], buyReserves[1], arb.NativeInAmount, buyPair.FeePerTenThousands)
+	nativeOut := ethmarket.GetAmountOut(sellReserves[1], sellReserves[0], tokensOut, sellPair.FeePerTenThousands)
+	profit := new(big.Int).Sub(nativeOut, arb.NativeInAmount)
+
+	if !isRouteLeg && profit.Cmp(s.minProfitWeiFollowUp) <= 0 {
+		return profit, false
+	}
+
+	buyReserves[0].Add(buyReserves[0], reserveAmountIn(buyPair, arb.NativeInAmount))
+	buyReserves[1].Sub(buyReserves[1], tokensOut)
+	sellReserves[1].Add(sellReserves[1], reserveAmountIn(sellPair, tokensOut))
+	sellReserves[0].Sub(sellReserves[0], nativeOut)
+
+	return profit, true
+}
+
+// How long a simulation may take and what to do with the arbs when it runs out
+// Zero in the config means the default
+type simulationSettings struct {
+	timeout       time.Duration
+	sendOnTimeout bool
+}
+
+func (s *botState) currentSimulationSettings() simulationSettings {
+	settings := simulationSettings{
+		timeout:       time.Duration(s.config.SimulationTimeoutMs) * time.Millisecond,
+		sendOnTimeout: !s.config.SimulationDropOnTimeout,
+	}
+
+	if settings.timeout <= 0 {
+		settings.timeout = SIMULATION_TIMEOUT_MS * time.Millisecond
+	}
+
+	return settings
+}
+
+func (s *botState) logSimulationDivergence(predictedProfit *big.Int, simulatedProfit *big.Int, arbCount int, passedCount int) {
+	// Divergence in basis points of the predicted profit
+	divergenceBps := int64(0)
+	if predictedProfit.Sign() > 0 {
+		diff := new(big.Int).Sub(simulatedProfit, predictedProfit)
+		divergenceBps = diff.Mul(diff, big.NewInt(10000)).Div(diff, predictedProfit).Int64()
+	}
+
+	s.logger.Info("Simulation divergence",
+		zap.String("predictedProfit", util.ToDecimal(predictedProfit, 18).String()),
+		zap.String("simulatedProfit", util.ToDecimal(simulatedProfit, 18).String()),
+		zap.Int64("divergenceBps", divergenceBps),
+		zap.Int("arbs", arbCount),
+		zap.Int("passedArbs", passedCount),
+	)
+}
+
+func decodeRevert(err error) string {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return err.Error()
+	}
+
+	hexData, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return err.Error()
+	}
+
+	data, decodeErr := hexutil.Decode(hexData)
+	if decodeErr != nil {
+		return err.Error()
+	}
+
+	reason, unpackErr := abi.UnpackRevert(data)
+	if unpackErr != nil {
+		return err.Error()
+	}
+
+	return reason
+}
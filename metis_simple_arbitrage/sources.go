@@ -0,0 +1,194 @@
+package metis_simple_arbitrage
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"strings"
+
+	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
+	"github.com/cryptotriv/raikiri/gen/FlashUniswapQueryV1"
+	"github.com/cryptotriv/raikiri/gen/TokenProvidenceV1"
+	"github.com/cryptotriv/raikiri/lib/models"
+	"github.com/cryptotriv/raikiri/lib/util"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Where pair reserves come from, callOpts picks the block like it does for contract calls
+// Each entry is reserve0, reserve1 and the last update timestamp, in the order of pairs
+type ReserveSource interface {
+	GetReserves(callOpts *bind.CallOpts, pairs []common.Address) ([][3]*big.Int, error)
+}
+
+// Lists the pairs of a factory, each one as token0, token1 and the pair address
+type PairLister interface {
+	// allPairsLength of the factory
+	PairCount(callOpts *bind.CallOpts, factory common.Address) (*big.Int, error)
+	ListPairs(callOpts *bind.CallOpts, factory common.Address, start *big.Int, end *big.Int) ([][3]common.Address, error)
+	// For each Hermes pair, whether it is a stable one
+	StableHermesPairs(callOpts *bind.CallOpts, pairs []common.Address) ([]bool, error)
+}
+
+// Decides whether a token trades without surprises, a nil error means it does
+type HealthChecker interface {
+	CheckToken(token common.Address, pair models.UniswappyV2Pair) error
+}
+
+// Turns arbs into a signed tx and gets it to the network
+// Signing and sending are apart so paper trading can sign without sending
+type ArbSender interface {
+	SignArbs(auth *bind.TransactOpts, arbs []FlashSwapExecutorV1.Arb, minProfit *big.Int) (*types.Transaction, error)
+	Send(ctx context.Context, tx *types.Transaction) error
+	// The contract the arb txs call, for simulating them
+	Address() common.Address
+}
+
+// Reserves and pairs from our FlashUniswapQueryV1 deployment
+type flashQuerySource struct {
+	instance *FlashUniswapQueryV1.FlashUniswapQueryV1
+	backend  bind.ContractBackend
+}
+
+func newFlashQuerySource(address common.Address, backend bind.ContractBackend) (*flashQuerySource, error) {
+	instance, err := FlashUniswapQueryV1.NewFlashUniswapQueryV1(address, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	return &flashQuerySource{instance: instance, backend: backend}, nil
+}
+
+func (s *flashQuerySource) GetReserves(callOpts *bind.CallOpts, pairs []common.Address) ([][3]*big.Int, error) {
+	return s.instance.GetReservesByPairs(callOpts, pairs)
+}
+
+// Our query contract only pages through pairs, the count comes from the factory itself
+func (s *flashQuerySource) PairCount(callOpts *bind.CallOpts, factory common.Address) (*big.Int, error) {
+	factoryABI, err := abi.JSON(strings.NewReader(viewFactoryABI))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []interface{}
+	err = bind.NewBoundContract(factory, factoryABI, s.backend, s.backend, s.backend).Call(callOpts, &out, "allPairsLength")
+	if err != nil {
+		return nil, err
+	}
+
+	return out[0].(*big.Int), nil
+}
+
+func (s *flashQuerySource) ListPairs(callOpts *bind.CallOpts, factory common.Address, start *big.Int, end *big.Int) ([][3]common.Address, error) {
+	return s.instance.GetPairsByIndexRange(callOpts, factory, start, end)
+}
+
+func (s *flashQuerySource) StableHermesPairs(callOpts *bind.CallOpts, pairs []common.Address) ([]bool, error) {
+	return s.instance.FilterVolatileHermesPairs(callOpts, pairs)
+}
+
+// Simulates a buy and sell through our TokenProvidenceV1 deployment, tokens with transfer taxes or blocked sells revert
+type tokenProvidenceChecker struct {
+	contract    *TokenProvidenceV1.TokenProvidenceV1
+	address     common.Address
+	privateKey  *ecdsa.PrivateKey
+	chainId     *big.Int
+	nonce       uint64
+	fromAddress common.Address
+	readClient  *readPool
+	gasPricing  gasStrategy
+}
+
+func newTokenProvidenceChecker(
+	address common.Address,
+	privateKey *ecdsa.PrivateKey,
+	chainId *big.Int,
+	nonce uint64,
+	fromAddress common.Address,
+	readClient *readPool,
+	gasPricing gasStrategy) (*tokenProvidenceChecker, error) {
+
+	contract, err := TokenProvidenceV1.NewTokenProvidenceV1(address, readClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenProvidenceChecker{
+		contract:    contract,
+		address:     address,
+		privateKey:  privateKey,
+		chainId:     chainId,
+		nonce:       nonce,
+		fromAddress: fromAddress,
+		readClient:  readClient,
+		gasPricing:  gasPricing,
+	}, nil
+}
+
+func (c *tokenProvidenceChecker) CheckToken(token common.Address, pair models.UniswappyV2Pair) error {
+	// Setup transaction
+	auth, err := bind.NewKeyedTransactorWithChainID(c.privateKey, c.chainId)
+	if err != nil {
+		return err
+	}
+
+	auth.Nonce = big.NewInt(int64(c.nonce))
+	auth.Value = util.ToWei(HEALTH_CHECK_AMOUNT, 18) // in wei
+	auth.GasLimit = uint64(3000000)                  // in units
+	setGasPrices(auth, c.gasPricing.prices(nil))
+	auth.NoSend = true
+
+	// Build transaction
+	simulateTx, err := c.contract.HealthCheck(
+		auth,
+		pair.MarketAdress,
+		token,
+		big.NewInt(pair.FeePerTenThousands))
+	if err != nil {
+		return err
+	}
+
+	msg := ethereum.CallMsg{
+		From:     c.fromAddress,
+		To:       &c.address,
+		Gas:      simulateTx.Gas(),
+		GasPrice: simulateTx.GasPrice(),
+		Value:    simulateTx.Value(),
+		Data:     simulateTx.Data(),
+	}
+
+	// Simulate transaction
+	_, err = c.readClient.CallContract(context.Background(), msg, nil)
+	return err
+}
+
+// Signs with our FlashSwapExecutorV1 binding and sends through the broadcaster
+type executorArbSender struct {
+	contract  *FlashSwapExecutorV1.FlashSwapExecutorV1
+	address   common.Address
+	broadcast *broadcaster
+}
+
+func newExecutorArbSender(address common.Address, backend bind.ContractBackend, broadcast *broadcaster) (*executorArbSender, error) {
+	contract, err := FlashSwapExecutorV1.NewFlashSwapExecutorV1(address, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	return &executorArbSender{contract: contract, address: address, broadcast: broadcast}, nil
+}
+
+func (s *executorArbSender) SignArbs(auth *bind.TransactOpts, arbs []FlashSwapExecutorV1.Arb, minProfit *big.Int) (*types.Transaction, error) {
+	return s.contract.ExecuteNativeArb(auth, arbs, minProfit)
+}
+
+func (s *executorArbSender) Send(ctx context.Context, tx *types.Transaction) error {
+	return s.broadcast.send(ctx, tx)
+}
+
+func (s *executorArbSender) Address() common.Address {
+	return s.address
+}
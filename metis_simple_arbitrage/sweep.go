@@ -0,0 +1,275 @@
+package metis_simple_arbitrage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"math/rand"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/cryptotriv/raikiri/lib/util"
+	"go.uber.org/zap"
+)
+
+// The values to try for each parameter, an empty list keeps the value from Base
+type SweepParams struct {
+	Base BacktestParams
+
+	EventDelayMs             []int
+	FailureBufferMultiplier  []int64
+	MinProfitFollowUpDivisor []int64
+	BaseNativePricingAmount  []float64
+	MaxFollowUpDepth         []int
+
+	// 0 runs the full grid, otherwise this many random picks from it
+	RandomTrials int
+	Seed         int64
+	// Trials running at once, 0 uses SWEEP_DEFAULT_WORKERS
+	Workers int
+	// Where the ranked table goes as csv, empty only logs it
+	OutputPath string
+}
+
+type SweepResult struct {
+	Params     BacktestParams
+	Report     BacktestReport
+	Txs        int
+	RevertRate float64
+	Err        string
+}
+
+// Each trial runs in its own process
+// The child is this same binary run as SWEEP_TRIAL_SUBCOMMAND, whose main has to hand it to RunMetisSimpleArbitrageSweepTrial
+// It reads the trial params as json from stdin and writes the report as json to stdout
+func RunMetisSimpleArbitrageSweepTrial(stdin io.Reader, stdout io.Writer) error {
+	var params BacktestParams
+	err := json.NewDecoder(stdin).Decode(&params)
+	if err != nil {
+		return err
+	}
+
+	report, err := RunMetisSimpleArbitrageBacktest(zap.NewNop(), params)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(stdout).Encode(report)
+}
+
+// Runs a backtest for every combination, in parallel, and ranks them by net profit
+func RunMetisSimpleArbitrageSweep(_logger *zap.Logger, sweep SweepParams) ([]SweepResult, error) {
+	logger := _logger
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	trials := sweepTrials(sweep)
+	if len(trials) == 0 {
+		return nil, errors.New("no trials to run")
+	}
+
+	workers := sweep.Workers
+	if workers <= 0 {
+		workers = SWEEP_DEFAULT_WORKERS
+	}
+
+	logger.Info("Starting sweep", zap.Int("trials", len(trials)), zap.Int("workers", workers))
+
+	results := make([]SweepResult, len(trials))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = runSweepTrial(executable, trials[i])
+				logger.Info("Sweep trial done", zap.Int("trial", i), zap.String("err", results[i].Err))
+			}
+		}()
+	}
+
+	for i := range trials {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Best net profit first, failed trials last
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].Err == "") != (results[j].Err == "") {
+			return results[i].Err == ""
+		}
+		if results[i].Err != "" {
+			return false
+		}
+		return results[i].Report.RealizedProfit.Cmp(results[j].Report.RealizedProfit) > 0
+	})
+
+	logSweepTable(logger, results)
+
+	if sweep.OutputPath != "" {
+		err = writeSweepTable(sweep.OutputPath, results)
+		if err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+func sweepTrials(sweep SweepParams) []BacktestParams {
+	trials := []BacktestParams{sweep.Base}
+
+	// Grows the grid one parameter at a time
+	expand := func(count int, set func(params *BacktestParams, i int)) {
+		if count == 0 {
+			return
+		}
+
+		var expanded []BacktestParams
+		for _, trial := range trials {
+			for i := 0; i < count; i++ {
+				params := trial
+				set(&params, i)
+				expanded = append(expanded, params)
+			}
+		}
+		trials = expanded
+	}
+
+	expand(len(sweep.EventDelayMs), func(params *BacktestParams, i int) { params.EventDelayMs = sweep.EventDelayMs[i] })
+	expand(len(sweep.FailureBufferMultiplier), func(params *BacktestParams, i int) {
+		params.FailureBufferMultiplier = sweep.FailureBufferMultiplier[i]
+	})
+	expand(len(sweep.MinProfitFollowUpDivisor), func(params *BacktestParams, i int) {
+		params.MinProfitFollowUpDivisor = sweep.MinProfitFollowUpDivisor[i]
+	})
+	expand(len(sweep.BaseNativePricingAmount), func(params *BacktestParams, i int) {
+		params.BaseNativePricingAmount = sweep.BaseNativePricingAmount[i]
+	})
+	expand(len(sweep.MaxFollowUpDepth), func(params *BacktestParams, i int) { params.MaxFollowUpDepth = sweep.MaxFollowUpDepth[i] })
+
+	if sweep.RandomTrials > 0 && sweep.RandomTrials < len(trials) {
+		random := rand.New(rand.NewSource(sweep.Seed))
+		random.Shuffle(len(trials), func(i, j int) {
+			trials[i], trials[j] = trials[j], trials[i]
+		})
+		trials = trials[:sweep.RandomTrials]
+	}
+
+	return trials
+}
+
+func runSweepTrial(executable string, params BacktestParams) SweepResult {
+	result := SweepResult{Params: params}
+
+	trial, err := json.Marshal(params)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(executable, SWEEP_TRIAL_SUBCOMMAND)
+	cmd.Stdin = bytes.NewReader(trial)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		result.Err = err.Error() + ": " + stderr.String()
+		return result
+	}
+
+	err = json.Unmarshal(stdout.Bytes(), &result.Report)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+
+	result.Txs = result.Report.Fills + result.Report.FailedFills
+	if result.Txs > 0 {
+		result.RevertRate = float64(result.Report.FailedFills) / float64(result.Txs)
+	}
+
+	return result
+}
+
+func logSweepTable(logger *zap.Logger, results []SweepResult) {
+	for rank, result := range results {
+		if result.Err != "" {
+			logger.Info("Sweep result", zap.Int("rank", rank+1), zap.String("err", result.Err))
+			continue
+		}
+
+		logger.Info("Sweep result",
+			zap.Int("rank", rank+1),
+			zap.String("netProfit", util.ToDecimal(result.Report.RealizedProfit, 18).String()),
+			zap.Int("txs", result.Txs),
+			zap.Float64("revertRate", result.RevertRate),
+			zap.Int("eventDelayMs", result.Params.EventDelayMs),
+			zap.Int64("failureBufferMultiplier", result.Params.FailureBufferMultiplier),
+			zap.Int64("minProfitFollowUpDivisor", result.Params.MinProfitFollowUpDivisor),
+			zap.Float64("baseNativePricingAmount", result.Params.BaseNativePricingAmount),
+			zap.Int("maxFollowUpDepth", result.Params.MaxFollowUpDepth),
+		)
+	}
+}
+
+func writeSweepTable(path string, results []SweepResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+
+	err = writer.Write([]string{
+		"rank", "netProfit", "txs", "revertRate",
+		"eventDelayMs", "failureBufferMultiplier", "minProfitFollowUpDivisor", "baseNativePricingAmount", "maxFollowUpDepth",
+		"err",
+	})
+	if err != nil {
+		return err
+	}
+
+	for rank, result := range results {
+		netProfit := big.NewInt(0)
+		if result.Report.RealizedProfit != nil {
+			netProfit = result.Report.RealizedProfit
+		}
+
+		err = writer.Write([]string{
+			strconv.Itoa(rank + 1),
+			util.ToDecimal(netProfit, 18).String(),
+			strconv.Itoa(result.Txs),
+			strconv.FormatFloat(result.RevertRate, 'f', 4, 64),
+			strconv.Itoa(result.Params.EventDelayMs),
+			strconv.FormatInt(result.Params.FailureBufferMultiplier, 10),
+			strconv.FormatInt(result.Params.MinProfitFollowUpDivisor, 10),
+			strconv.FormatFloat(result.Params.BaseNativePricingAmount, 'f', -1, 64),
+			strconv.Itoa(result.Params.MaxFollowUpDepth),
+			result.Err,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
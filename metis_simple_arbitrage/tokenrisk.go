@@ -0,0 +1,363 @@
+package metis_simple_arbitrage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sort"
+
+	"github.com/cryptotriv/raikiri/lib/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/zap"
+)
+
+// What the bytecode of a token lets its owner do, the higher the score the less we trust it
+type tokenRisk struct {
+	score int
+	flags []string
+}
+
+// A feature we look for and what it adds to the score
+type tokenRiskFeature struct {
+	flag      string
+	score     int
+	selectors []string
+}
+
+var (
+	// Owner controls that can stop our sells or take a cut of them
+	tokenRiskFeatures = []tokenRiskFeature{
+		{"pausable", TOKEN_RISK_PAUSE_SCORE, []string{"pause()", "unpause()", "setPaused(bool)", "setTradingEnabled(bool)", "enableTrading()"}},
+		{"blacklist", TOKEN_RISK_BLACKLIST_SCORE, []string{"blacklist(address)", "addToBlacklist(address)", "setBlacklist(address,bool)", "blacklistAddress(address,bool)", "setBots(address[])", "addBot(address)"}},
+		{"feeSetter", TOKEN_RISK_FEE_SETTER_SCORE, []string{"setFee(uint256)", "setTaxFee(uint256)", "setBuyFee(uint256)", "setSellFee(uint256)", "setFees(uint256,uint256)", "setMaxTxAmount(uint256)", "excludeFromFee(address)"}},
+		{"mintable", TOKEN_RISK_MINT_SCORE, []string{"mint(address,uint256)", "mint(uint256)"}},
+	}
+
+	// EIP-1967 implementation, beacon and admin slots
+	eip1967ImplementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	eip1967Slots              = []common.Hash{
+		eip1967ImplementationSlot,
+		common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50"),
+		common.HexToHash("0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103"),
+	}
+
+	// EIP-1167 minimal proxies start with this
+	minimalProxyPrefix = common.FromHex("0x363d3d373d3d3d363d73")
+)
+
+const (
+	opStop         = 0x00
+	opJumpDest     = 0x5b
+	opDelegateCall = 0xf4
+	opInvalid      = 0xfe
+	opSelfDestruct = 0xff
+	opPush1        = 0x60
+	opPush4        = 0x63
+	opPush32       = 0x7f
+)
+
+// The selectors and opcodes of some bytecode, push data is skipped so constants don't count as opcodes
+type bytecodeFeatures struct {
+	selectors    map[[4]byte]bool
+	constants    map[common.Hash]bool
+	delegateCall bool
+	selfDestruct bool
+}
+
+// Everything up to the metadata is scanned, decoded from the start the way the EVM finds its JUMPDESTs
+// So every block a jump can reach is covered, an INVALID or a halt doesn't end the code
+// Pre-0.8 solc puts INVALID inline for asserts, and a junk byte after a halt would hide what follows
+func scanBytecode(code []byte) bytecodeFeatures {
+	features := bytecodeFeatures{selectors: make(map[[4]byte]bool), constants: make(map[common.Hash]bool)}
+
+	code = stripMetadata(code)
+
+	for pc := 0; pc < len(code); pc++ {
+		op := code[pc]
+
+		switch {
+		case op >= opPush1 && op <= opPush32:
+			size := int(op-opPush1) + 1
+			end := pc + 1 + size
+			if end > len(code) {
+				end = len(code)
+			}
+
+			// solc pushes a selector with leading zero bytes in fewer bytes
+			if op <= opPush4 {
+				var selector [4]byte
+				copy(selector[4-(end-pc-1):], code[pc+1:end])
+				features.selectors[selector] = true
+			} else if op == opPush32 {
+				features.constants[common.BytesToHash(code[pc+1:end])] = true
+			}
+
+			pc = end - 1
+		case op == opDelegateCall:
+			features.delegateCall = true
+		case op == opSelfDestruct:
+			features.selfDestruct = true
+		}
+	}
+
+	return features
+}
+
+// Solidity appends CBOR metadata to the code, its length is in the last 2 bytes
+func stripMetadata(code []byte) []byte {
+	if len(code) < 2 {
+		return code
+	}
+
+	metadataLength := int(binary.BigEndian.Uint16(code[len(code)-2:]))
+	start := len(code) - 2 - metadataLength
+	if start < 0 || metadataLength == 0 {
+		return code
+	}
+
+	// The metadata is a CBOR map, anything else means the code has none
+	if code[start] < 0xa1 || code[start] > 0xb7 {
+		return code
+	}
+
+	return code[:start]
+}
+
+// Scores tokens by their bytecode, for proxies the implementation is scanned too
+func (s *botState) assessTokenRisks(tokens []common.Address) (map[common.Address]tokenRisk, error) {
+	ctx := context.Background()
+
+	codes, err := fetchCodes(ctx, s.readClient, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	// Where EIP-1967 proxies point to
+	implementationWords := make([]common.Hash, len(tokens))
+	batch := make([]rpc.BatchElem, len(tokens))
+	for i, token := range tokens {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_getStorageAt",
+			Args:   []interface{}{token, eip1967ImplementationSlot, "latest"},
+			Result: &implementationWords[i],
+		}
+	}
+
+	err = s.readClient.BatchCallContext(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	var implementations []common.Address
+	implementationOf := make(map[common.Address]common.Address)
+	for i, token := range tokens {
+		if batch[i].Error != nil || implementationWords[i] == (common.Hash{}) {
+			continue
+		}
+
+		implementation := common.BytesToAddress(implementationWords[i].Bytes())
+		implementationOf[token] = implementation
+		implementations = append(implementations, implementation)
+	}
+
+	implementationCodes, err := fetchCodes(ctx, s.readClient, implementations)
+	if err != nil {
+		return nil, err
+	}
+
+	codeOfImplementation := make(map[common.Address][]byte)
+	for i, implementation := range implementations {
+		codeOfImplementation[implementation] = implementationCodes[i]
+	}
+
+	risks := make(map[common.Address]tokenRisk, len(tokens))
+	for i, token := range tokens {
+		features := scanBytecode(codes[i])
+
+		isProxy := bytes.HasPrefix(codes[i], minimalProxyPrefix)
+		for _, slot := range eip1967Slots {
+			if features.constants[slot] {
+				isProxy = true
+			}
+		}
+
+		if implementation, ok := implementationOf[token]; ok {
+			isProxy = true
+
+			// The owner's functions live in the implementation
+			implementationFeatures := scanBytecode(codeOfImplementation[implementation])
+			for selector := range implementationFeatures.selectors {
+				features.selectors[selector] = true
+			}
+			features.selfDestruct = features.selfDestruct || implementationFeatures.selfDestruct
+		}
+
+		risks[token] = scoreTokenRisk(features, isProxy)
+	}
+
+	return risks, nil
+}
+
+func scoreTokenRisk(features bytecodeFeatures, isProxy bool) tokenRisk {
+	var risk tokenRisk
+
+	add := func(flag string, score int) {
+		risk.flags = append(risk.flags, flag)
+		risk.score += score
+	}
+
+	if isProxy {
+		add("proxy", TOKEN_RISK_PROXY_SCORE)
+	} else if features.delegateCall {
+		// Proxies always delegatecall, only count it on its own
+		add("delegatecall", TOKEN_RISK_DELEGATECALL_SCORE)
+	}
+
+	if features.selfDestruct {
+		add("selfdestruct", TOKEN_RISK_SELFDESTRUCT_SCORE)
+	}
+
+	for _, feature := range tokenRiskFeatures {
+		for _, signature := range feature.selectors {
+			var selector [4]byte
+			copy(selector[:], crypto.Keccak256([]byte(signature))[:4])
+
+			if features.selectors[selector] {
+				add(feature.flag, feature.score)
+				break
+			}
+		}
+	}
+
+	return risk
+}
+
+// Scores the tokens and their pairs and, when the config sets a maximum, drops the ones above it
+// With a maximum set we fail closed, tokens we couldn't score are dropped too
+func (s *botState) excludeRiskyTokens(pairsByToken map[common.Address][]models.UniswappyV2Pair) {
+	tokens := make([]common.Address, 0, len(pairsByToken))
+	for token := range pairsByToken {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return bytes.Compare(tokens[i].Bytes(), tokens[j].Bytes()) < 0
+	})
+
+	risks, err := s.assessTokenRisks(tokens)
+	if err != nil {
+		s.logger.Error("Error assessing token risks", zap.Error(err))
+		s.excludeUnscoredTokens(pairsByToken)
+		return
+	}
+
+	for _, token := range tokens {
+		risk := risks[token]
+		s.tokenRisks[token] = risk
+
+		if risk.score == 0 {
+			continue
+		}
+
+		if s.config.MaxTokenRiskScore > 0 && risk.score > s.config.MaxTokenRiskScore {
+			s.logger.Info("Token is risky - removed from markets", zap.String("tokenAddress", token.Hex()), zap.Int("riskScore", risk.score), zap.Strings("flags", risk.flags))
+			delete(pairsByToken, token)
+			continue
+		}
+
+		s.logger.Debug("Token risk", zap.String("tokenAddress", token.Hex()), zap.Int("riskScore", risk.score), zap.Strings("flags", risk.flags))
+	}
+
+	if s.config.MaxTokenRiskScore <= 0 {
+		return
+	}
+
+	// A pair runs our flash swap callback, so its code gets the same check
+	var pairAddresses []common.Address
+	for _, token := range tokens {
+		for _, pair := range pairsByToken[token] {
+			pairAddresses = append(pairAddresses, pair.MarketAdress)
+		}
+	}
+
+	pairRisks, err := s.assessTokenRisks(pairAddresses)
+	if err != nil {
+		s.logger.Error("Error assessing pair risks", zap.Error(err))
+		s.excludeUnscoredTokens(pairsByToken)
+		return
+	}
+
+	for _, token := range tokens {
+		pairs, ok := pairsByToken[token]
+		if !ok {
+			continue
+		}
+
+		var keptPairs []models.UniswappyV2Pair
+		for _, pair := range pairs {
+			risk := pairRisks[pair.MarketAdress]
+			if risk.score > s.config.MaxTokenRiskScore {
+				s.logger.Info("Pair is risky - removed from markets", zap.String("marketAddress", pair.MarketAdress.Hex()), zap.Int("riskScore", risk.score), zap.Strings("flags", risk.flags))
+				continue
+			}
+			keptPairs = append(keptPairs, pair)
+		}
+
+		// Arbs need two markets for a token
+		if len(keptPairs) > 1 {
+			pairsByToken[token] = keptPairs
+		} else {
+			delete(pairsByToken, token)
+		}
+	}
+}
+
+// Without a maximum the scores are only informative, with one we can't trade what we couldn't score
+func (s *botState) excludeUnscoredTokens(pairsByToken map[common.Address][]models.UniswappyV2Pair) {
+	if s.config.MaxTokenRiskScore <= 0 {
+		return
+	}
+
+	s.logger.Error("Token risk check is on, removing every token until it can be scored", zap.Int("tokens", len(pairsByToken)))
+	for token := range pairsByToken {
+		delete(pairsByToken, token)
+	}
+}
+
+// Bytecode of each address, empty for addresses without code
+func fetchCodes(ctx context.Context, readClient *readPool, addresses []common.Address) ([][]byte, error) {
+	codes := make([][]byte, len(addresses))
+
+	for start := 0; start < len(addresses); start += VIEW_CALL_BATCH_SIZE {
+		end := start + VIEW_CALL_BATCH_SIZE
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+
+		results := make([]hexutil.Bytes, end-start)
+		batch := make([]rpc.BatchElem, end-start)
+		for i, address := range addresses[start:end] {
+			batch[i] = rpc.BatchElem{
+				Method: "eth_getCode",
+				Args:   []interface{}{address, "latest"},
+				Result: &results[i],
+			}
+		}
+
+		err := readClient.BatchCallContext(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, elem := range batch {
+			if elem.Error != nil {
+				return nil, elem.Error
+			}
+			codes[start+i] = results[i]
+		}
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,145 @@
+package metis_simple_arbitrage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func testSelector(signature string) []byte {
+	return crypto.Keccak256([]byte(signature))[:4]
+}
+
+// Runtime code of deployed contracts, taken from go-ethereum's tracer test data
+func readTestBytecode(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return common.FromHex(strings.TrimSpace(string(data)))
+}
+
+// Whatever looks like a selector or SELFDESTRUCT in the metadata doesn't count
+func TestScanBytecodeSkipsMetadata(t *testing.T) {
+	var code []byte
+	code = append(code, opPush4)
+	code = append(code, testSelector("pause()")...)
+	code = append(code, opStop)
+
+	// CBOR metadata, a map of one entry with its length in the last 2 bytes
+	metadata := append([]byte{0xa1, 0x64}, []byte("solc")...)
+	metadata = append(metadata, 0x43, opPush4, opSelfDestruct, opDelegateCall)
+	code = append(code, metadata...)
+	code = append(code, 0, byte(len(metadata)))
+
+	risk := scoreTokenRisk(scanBytecode(code), false)
+	if len(risk.flags) != 1 || risk.flags[0] != "pausable" {
+		t.Fatalf("expected only pausable, got %v", risk.flags)
+	}
+
+	if stripped := stripMetadata(code); !bytes.Equal(stripped, code[:len(code)-len(metadata)-2]) {
+		t.Fatal("metadata not stripped")
+	}
+}
+
+// A halt followed by a junk byte, or an INVALID, used to end the scan and hide the blocks after it
+func TestScanBytecodeJunkByteAfterHalt(t *testing.T) {
+	var code []byte
+	code = append(code, opPush4)
+	code = append(code, testSelector("transfer(address,uint256)")...)
+	code = append(code, opStop, 0x0c, opJumpDest, opPush4)
+	code = append(code, testSelector("blacklist(address)")...)
+	code = append(code, opStop, opInvalid, opJumpDest, opSelfDestruct)
+
+	risk := scoreTokenRisk(scanBytecode(code), false)
+	if len(risk.flags) != 2 || risk.flags[0] != "selfdestruct" || risk.flags[1] != "blacklist" {
+		t.Fatalf("expected selfdestruct and blacklist, got %v", risk.flags)
+	}
+}
+
+// The optimizer drops the leading zero bytes of a selector and pushes it with PUSH1 to PUSH3
+func TestScanBytecodeShortSelectorPush(t *testing.T) {
+	code := []byte{opPush1 + 2, 0xaa, 0xbb, 0xcc, opPush1, 0x01}
+
+	features := scanBytecode(code)
+	if !features.selectors[[4]byte{0, 0xaa, 0xbb, 0xcc}] {
+		t.Fatal("PUSH3 selector not left-padded")
+	}
+	if !features.selectors[[4]byte{0, 0, 0, 0x01}] {
+		t.Fatal("PUSH1 selector not left-padded")
+	}
+}
+
+// Pre-0.8 solc puts INVALID inline for asserts and bounds checks, the code after it still runs
+func TestScanBytecodePastInlineInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		file string
+		// Pushed by a function body after the first inline INVALID
+		constant common.Hash
+	}{
+		{
+			// Solidity docs Ballot, solc 0.6.6, Goerli 0xf58833cf0c791881b494eb79d461e08a1f043f52
+			name:     "solc 0.6.6",
+			file:     "ballot-solc-0.6.6.hex",
+			constant: common.BytesToHash(common.RightPadBytes([]byte("Self-delegation is disallowed."), 32)),
+		},
+		{
+			// ERC20 token, solc 0.4, Ropsten 0x43064693d3d38ad6a7cb579e0d6d9718c8aa6b62
+			name:     "solc 0.4 token",
+			file:     "token-solc-0.4.hex",
+			constant: crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)")),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			code := readTestBytecode(t, test.file)
+
+			if firstInlineInvalid(stripMetadata(code)) < 0 {
+				t.Fatal("fixture has no inline INVALID")
+			}
+
+			if features := scanBytecode(code); !features.constants[test.constant] {
+				t.Fatalf("%s not found past the inline INVALID", test.constant.Hex())
+			}
+		})
+	}
+}
+
+// A plain ERC20 token, solc 0.8.20, mainnet 0xcda6461f1a30c618373f5790a83e1569fb685cba
+func TestScanBytecodePlainToken(t *testing.T) {
+	features := scanBytecode(readTestBytecode(t, "token-solc-0.8.20.hex"))
+
+	for _, signature := range []string{"transfer(address,uint256)", "balanceOf(address)", "approve(address,uint256)"} {
+		var selector [4]byte
+		copy(selector[:], testSelector(signature))
+		if !features.selectors[selector] {
+			t.Fatalf("%s not found", signature)
+		}
+	}
+
+	if risk := scoreTokenRisk(features, false); len(risk.flags) != 0 {
+		t.Fatalf("expected no risk, got %v", risk.flags)
+	}
+}
+
+func firstInlineInvalid(code []byte) int {
+	for pc := 0; pc < len(code); pc++ {
+		op := code[pc]
+		if op == opInvalid {
+			return pc
+		}
+		if op >= opPush1 && op <= opPush32 {
+			pc += int(op-opPush1) + 1
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,326 @@
+package metis_simple_arbitrage
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/cryptotriv/raikiri/gen/FlashSwapExecutorV1"
+	"github.com/cryptotriv/raikiri/lib/influxdb"
+	"github.com/cryptotriv/raikiri/lib/util"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"go.uber.org/zap"
+)
+
+type txOutcome int
+
+const (
+	txOutcomeSuccess txOutcome = iota
+	txOutcomeReverted
+	txOutcomeNoOp
+	txOutcomeTimedOut
+	txOutcomeReplaced
+)
+
+func (o txOutcome) String() string {
+	switch o {
+	case txOutcomeSuccess:
+		return "success"
+	case txOutcomeReverted:
+		return "reverted"
+	case txOutcomeNoOp:
+		return "noOp"
+	case txOutcomeReplaced:
+		return "replaced"
+	default:
+		return "timedOut"
+	}
+}
+
+type txResult struct {
+	Hash            common.Hash
+	Outcome         txOutcome
+	BlockNumber     uint64
+	PredictedProfit *big.Int
+	RealizedProfit  *big.Int
+	GasUsed         uint64
+	GasCost         *big.Int
+	Latency         time.Duration
+	RevertReason    string
+}
+
+// Follows every arb tx we send until it is mined or we give up on it
+type txTracker struct {
+	mu             sync.Mutex
+	outcomes       map[txOutcome]int
+	realizedProfit *big.Int
+	gasCost        *big.Int
+	transferTopic  common.Hash
+	state          *botState
+}
+
+func (s *botState) newTxTracker() *txTracker {
+	return &txTracker{
+		state:          s,
+		outcomes:       make(map[txOutcome]int),
+		realizedProfit: big.NewInt(0),
+		gasCost:        big.NewInt(0),
+		transferTopic:  crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)")),
+	}
+}
+
+func (t *txTracker) track(tx *types.Transaction, fromAddress common.Address, arbs []FlashSwapExecutorV1.Arb) {
+	predictedProfit := big.NewInt(0)
+	for _, arb := range arbs {
+		predictedProfit.Add(predictedProfit, arb.Profit)
+	}
+
+	go func(sentAt time.Time) {
+		result := t.wait(tx, fromAddress, sentAt)
+		result.PredictedProfit = predictedProfit
+
+		t.record(result)
+	}(time.Now())
+}
+
+func (t *txTracker) wait(tx *types.Transaction, fromAddress common.Address, sentAt time.Time) txResult {
+	result := txResult{Hash: tx.Hash(), Outcome: txOutcomeTimedOut, RealizedProfit: big.NewInt(0), GasCost: big.NewInt(0)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*TX_RECEIPT_TIMEOUT_S)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Millisecond * TX_RECEIPT_POLL_MS)
+	defer ticker.Stop()
+
+	var receipt *types.Receipt
+	for receipt == nil {
+		select {
+		case <-ctx.Done():
+			result.Latency = time.Since(sentAt)
+
+			// A replacement at the same nonce got mined instead
+			minedNonce, err := t.state.readClient.NonceAt(context.Background(), fromAddress, nil)
+			if err == nil && minedNonce > tx.Nonce() {
+				result.Outcome = txOutcomeReplaced
+			}
+
+			return result
+		case <-ticker.C:
+			var err error
+			receipt, err = t.state.readClient.TransactionReceipt(ctx, tx.Hash())
+			if err != nil && !errors.Is(err, ethereum.NotFound) {
+				t.state.logger.Debug("Error getting receipt for arb tx", zap.String("hash", tx.Hash().Hex()), zap.Error(err))
+			}
+		}
+	}
+
+	result.Latency = time.Since(sentAt)
+	result.BlockNumber = receipt.BlockNumber.Uint64()
+	result.GasUsed = receipt.GasUsed
+	result.GasCost = new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), effectiveGasPrice(receipt, tx))
+
+	if receipt.Status == types.ReceiptStatusFailed {
+		result.Outcome = txOutcomeReverted
+		result.RevertReason = t.replay(tx, fromAddress, receipt.BlockNumber)
+		result.RealizedProfit.Neg(result.GasCost)
+		return result
+	}
+
+	// The executor sends all its native balance to us at the end, if any arb went through
+	received := big.NewInt(0)
+	for _, log := range receipt.Logs {
+		if log.Address != common.HexToAddress(METIS_TOKEN_ADDRESS) || len(log.Topics) < 3 || log.Topics[0] != t.transferTopic {
+			continue
+		}
+		if common.BytesToAddress(log.Topics[2].Bytes()) == fromAddress {
+			received.Add(received, new(big.Int).SetBytes(log.Data))
+		}
+	}
+
+	if received.Sign() == 0 {
+		result.Outcome = txOutcomeNoOp
+	} else {
+		result.Outcome = txOutcomeSuccess
+	}
+
+	result.RealizedProfit.Sub(received, result.GasCost)
+
+	return result
+}
+
+// Paper trades are never broadcast, so we simulate them at the end of the next block instead
+func (t *txTracker) trackPaper(tx *types.Transaction, fromAddress common.Address, arbs []FlashSwapExecutorV1.Arb) {
+	predictedProfit := big.NewInt(0)
+	for _, arb := range arbs {
+		predictedProfit.Add(predictedProfit, arb.Profit)
+	}
+
+	go func(sentAt time.Time) {
+		result := t.simulatePaper(tx, fromAddress, arbs, sentAt)
+		result.PredictedProfit = predictedProfit
+
+		t.record(result)
+	}(time.Now())
+}
+
+func (t *txTracker) simulatePaper(tx *types.Transaction, fromAddress common.Address, arbs []FlashSwapExecutorV1.Arb, sentAt time.Time) txResult {
+	result := txResult{Hash: tx.Hash(), Outcome: txOutcomeTimedOut, RealizedProfit: big.NewInt(0), GasCost: big.NewInt(0)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*TX_RECEIPT_TIMEOUT_S)
+	defer cancel()
+
+	signedAt, err := t.state.readClient.BlockNumber(ctx)
+	if err != nil {
+		t.state.logger.Error("Error getting block number for paper tx", zap.String("hash", tx.Hash().Hex()), zap.Error(err))
+		return result
+	}
+
+	ticker := time.NewTicker(time.Millisecond * TX_RECEIPT_POLL_MS)
+	defer ticker.Stop()
+
+	// Wait for the block our tx would have gone into
+	var header *types.Header
+	for header == nil {
+		select {
+		case <-ctx.Done():
+			result.Latency = time.Since(sentAt)
+			return result
+		case <-ticker.C:
+			latest, err := t.state.readClient.HeaderByNumber(ctx, nil)
+			if err != nil {
+				t.state.logger.Debug("Error getting header for paper tx", zap.String("hash", tx.Hash().Hex()), zap.Error(err))
+				continue
+			}
+			if latest.Number.Uint64() > signedAt {
+				header = latest
+			}
+		}
+	}
+
+	result.Latency = time.Since(sentAt)
+	result.BlockNumber = header.Number.Uint64()
+
+	// Worst case for us: we land after everything else in that block
+	msg := ethereum.CallMsg{
+		From:  fromAddress,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}
+
+	output, err := t.state.readClient.CallContract(ctx, msg, header.Number)
+	if err != nil {
+		result.Outcome = txOutcomeReverted
+		result.RevertReason = decodeRevert(err)
+		result.GasUsed = ARB_FAILURE_GAS_COST
+		result.GasCost = new(big.Int).Mul(big.NewInt(ARB_FAILURE_GAS_COST), paperGasPrice(tx, header))
+		result.RealizedProfit.Neg(result.GasCost)
+		return result
+	}
+
+	result.GasUsed = arbGasEstimate(arbs).Uint64()
+	result.GasCost = new(big.Int).Mul(arbGasEstimate(arbs), paperGasPrice(tx, header))
+
+	// The executor reports what it made, which is what the tx would have paid out
+	simulatedProfit, err := unpackExecutorProfit(output)
+	if err != nil {
+		t.state.logger.Error("Error unpacking paper tx profit", zap.String("hash", tx.Hash().Hex()), zap.Error(err))
+		simulatedProfit = big.NewInt(0)
+	}
+
+	if simulatedProfit.Sign() == 0 {
+		result.Outcome = txOutcomeNoOp
+	} else {
+		result.Outcome = txOutcomeSuccess
+	}
+
+	result.RealizedProfit.Sub(simulatedProfit, result.GasCost)
+
+	return result
+}
+
+// What the tx would have paid per gas in that block
+func paperGasPrice(tx *types.Transaction, header *types.Header) *big.Int {
+	if tx.Type() != types.DynamicFeeTxType || header.BaseFee == nil {
+		return tx.GasPrice()
+	}
+
+	gasPrice := new(big.Int).Add(header.BaseFee, tx.GasTipCap())
+	if gasPrice.Cmp(tx.GasFeeCap()) > 0 {
+		return tx.GasFeeCap()
+	}
+	return gasPrice
+}
+
+// Re-runs a reverted tx as a call on the block before it, to get the revert reason
+func (t *txTracker) replay(tx *types.Transaction, fromAddress common.Address, blockNumber *big.Int) string {
+	msg := ethereum.CallMsg{
+		From:     fromAddress,
+		To:       tx.To(),
+		Gas:      tx.Gas(),
+		GasPrice: tx.GasPrice(),
+		Value:    tx.Value(),
+		Data:     tx.Data(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*TX_RECEIPT_TIMEOUT_S)
+	defer cancel()
+
+	_, err := t.state.readClient.CallContract(ctx, msg, new(big.Int).Sub(blockNumber, big.NewInt(1)))
+	if err == nil {
+		// Only reverted because of its position in the block
+		return "reverted in block, passes on parent state"
+	}
+
+	return decodeRevert(err)
+}
+
+func (t *txTracker) record(result txResult) {
+	t.mu.Lock()
+	t.outcomes[result.Outcome]++
+	t.realizedProfit.Add(t.realizedProfit, result.RealizedProfit)
+	t.gasCost.Add(t.gasCost, result.GasCost)
+	t.mu.Unlock()
+
+	t.state.logger.Info("Arb tx outcome",
+		zap.String("hash", result.Hash.Hex()),
+		zap.String("outcome", result.Outcome.String()),
+		zap.Uint64("blockNumber", result.BlockNumber),
+		zap.String("predictedProfit", util.ToDecimal(result.PredictedProfit, 18).String()),
+		zap.String("realizedProfit", util.ToDecimal(result.RealizedProfit, 18).String()),
+		zap.Uint64("gasUsed", result.GasUsed),
+		zap.String("gasCost", util.ToDecimal(result.GasCost, 18).String()),
+		zap.String("latency", result.Latency.String()),
+		zap.String("revertReason", result.RevertReason),
+	)
+
+	if result.Outcome != txOutcomeTimedOut && result.Outcome != txOutcomeReplaced {
+		influxdb.WriteMEVTxSent(t.state.botContext, result.Hash.Hex(), int(result.BlockNumber), result.Outcome == txOutcomeSuccess, result.Outcome == txOutcomeReverted)
+	}
+}
+
+// Returns the number of txs per outcome and the total realized profit and gas cost
+func (t *txTracker) stats() (map[txOutcome]int, *big.Int, *big.Int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	outcomes := make(map[txOutcome]int, len(t.outcomes))
+	for outcome, count := range t.outcomes {
+		outcomes[outcome] = count
+	}
+
+	return outcomes, new(big.Int).Set(t.realizedProfit), new(big.Int).Set(t.gasCost)
+}
+
+func effectiveGasPrice(receipt *types.Receipt, tx *types.Transaction) *big.Int {
+	if receipt.EffectiveGasPrice != nil {
+		return receipt.EffectiveGasPrice
+	}
+	return tx.GasPrice()
+}
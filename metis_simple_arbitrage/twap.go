@@ -0,0 +1,243 @@
+package metis_simple_arbitrage
+
+import (
+	"context"
+	"math/big"
+	"sync"
+
+	"github.com/cryptotriv/raikiri/lib/models"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+)
+
+// The cumulative price of a pool's token in METIS at some point in time
+// Prices are UQ112x112 like the pair keeps them, so the cumulative is that times seconds
+type twapObservation struct {
+	timestamp  uint64
+	cumulative *big.Int
+}
+
+// Samples the price accumulators of our pools so spot prices can be held against a short TWAP
+// Pools without accumulators, like Hermes ones, never get a TWAP and are never held back by it
+// Sampling runs off the main loop, the observations are only touched under mu
+type twapTracker struct {
+	calls        *viewCallSource
+	mu           sync.Mutex
+	observations map[common.Address][]twapObservation
+	sampling     bool
+	state        *botState
+}
+
+var (
+	uq112         = new(big.Int).Lsh(big.NewInt(1), 112)
+	uint256Modulo = new(big.Int).Lsh(big.NewInt(1), 256)
+	uint32Modulo  = uint64(1) << 32
+)
+
+func (s *botState) newTwapTracker() (*twapTracker, error) {
+	calls, err := newViewCallSource(s.readClient, common.Address{}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &twapTracker{calls: calls, observations: make(map[common.Address][]twapObservation), state: s}, nil
+}
+
+// The markets to sample, read on the main loop since that is where they change
+func (s *botState) twapPairs() []models.UniswappyV2Pair {
+	var pairs []models.UniswappyV2Pair
+	for _, tokenPairs := range s.marketPairsByToken {
+		pairs = append(pairs, tokenPairs...)
+	}
+
+	return pairs
+}
+
+// Samples in a goroutine so the calls never hold up the main loop, skipped while the last one still runs
+func (t *twapTracker) sampleInBackground() {
+	t.mu.Lock()
+	if t.sampling {
+		t.mu.Unlock()
+		t.state.logger.Debug("TWAP sample still running, skipping")
+		return
+	}
+	t.sampling = true
+	t.mu.Unlock()
+
+	pairs := t.state.twapPairs()
+
+	go func() {
+		t.sample(pairs)
+
+		t.mu.Lock()
+		t.sampling = false
+		t.mu.Unlock()
+	}()
+}
+
+// Takes one observation of every market at the latest block
+func (t *twapTracker) sample(pairs []models.UniswappyV2Pair) {
+	ctx := context.Background()
+
+	header, err := t.state.readClient.HeaderByNumber(ctx, nil)
+	if err != nil {
+		t.state.logger.Error("Error getting header for TWAP sample", zap.Error(err))
+		return
+	}
+
+	// Three calls a market: both accumulators and the reserves with their timestamp
+	methods := []string{"price0CumulativeLast", "price1CumulativeLast", "getReserves"}
+	calls := make([]viewCall, 0, len(pairs)*len(methods))
+	for _, method := range methods {
+		data, err := t.calls.pairABI.Pack(method)
+		if err != nil {
+			t.state.logger.Error("Error packing TWAP call", zap.String("method", method), zap.Error(err))
+			return
+		}
+
+		for _, pair := range pairs {
+			calls = append(calls, viewCall{to: pair.MarketAdress, data: data})
+		}
+	}
+
+	outputs, callErrs, err := t.calls.tryCall(&bind.CallOpts{BlockNumber: header.Number, Context: ctx}, calls)
+	if err != nil {
+		t.state.logger.Error("Error sampling TWAP accumulators", zap.Error(err))
+		return
+	}
+
+	sampled := make(map[common.Address]twapObservation)
+	for i, pair := range pairs {
+		cumulativeIndex := i + pair.TokenIndex*len(pairs)
+		reservesIndex := i + 2*len(pairs)
+		if callErrs[cumulativeIndex] != nil || callErrs[reservesIndex] != nil {
+			continue
+		}
+
+		cumulativeValues, err := t.calls.pairABI.Unpack(methods[pair.TokenIndex], outputs[cumulativeIndex])
+		if err != nil {
+			continue
+		}
+
+		reserveValues, err := t.calls.pairABI.Unpack("getReserves", outputs[reservesIndex])
+		if err != nil {
+			continue
+		}
+
+		reserves := [2]*big.Int{reserveValues[0].(*big.Int), reserveValues[1].(*big.Int)}
+		blockTimestampLast := uint64(reserveValues[2].(uint32))
+
+		// The accumulator only moves on the first trade of a block, catch it up to now with the current price
+		cumulative := new(big.Int).Set(cumulativeValues[0].(*big.Int))
+		spot := spotPriceUQ(reserves[pair.NativeIndex], reserves[pair.TokenIndex])
+		if spot != nil {
+			elapsed := (header.Time%uint32Modulo + uint32Modulo - blockTimestampLast) % uint32Modulo
+			cumulative.Add(cumulative, new(big.Int).Mul(spot, new(big.Int).SetUint64(elapsed)))
+		}
+
+		sampled[pair.MarketAdress] = twapObservation{timestamp: header.Time, cumulative: cumulative}
+	}
+
+	t.mu.Lock()
+	for market, observation := range sampled {
+		t.record(market, observation)
+	}
+	t.mu.Unlock()
+
+	t.state.logger.Debug("TWAP sampled", zap.Int("markets", len(pairs)), zap.Int("withAccumulators", len(sampled)))
+}
+
+// Keeps enough history to always have an observation a full window back, mu must be held
+func (t *twapTracker) record(market common.Address, observation twapObservation) {
+	observations := append(t.observations[market], observation)
+
+	keepFrom := 0
+	for i, old := range observations {
+		if observation.timestamp-old.timestamp >= TWAP_WINDOW_S {
+			keepFrom = i
+		}
+	}
+
+	t.observations[market] = observations[keepFrom:]
+}
+
+// The TWAP of the pool's token in METIS over at least the window, nil until we have that much history
+func (t *twapTracker) price(market common.Address) *big.Int {
+	t.mu.Lock()
+	observations := t.observations[market]
+	if len(observations) < 2 {
+		t.mu.Unlock()
+		return nil
+	}
+
+	oldest := observations[0]
+	latest := observations[len(observations)-1]
+	t.mu.Unlock()
+	elapsed := latest.timestamp - oldest.timestamp
+	if elapsed < TWAP_WINDOW_S {
+		return nil
+	}
+
+	// Accumulators are allowed to overflow, the difference is still right modulo 2^256
+	delta := new(big.Int).Sub(latest.cumulative, oldest.cumulative)
+	if delta.Sign() < 0 {
+		delta.Add(delta, uint256Modulo)
+	}
+
+	return delta.Div(delta, new(big.Int).SetUint64(elapsed))
+}
+
+// Whether the spot price of the pool is further from its TWAP than we allow
+func (t *twapTracker) deviates(pair models.UniswappyV2Pair) bool {
+	twapPrice := t.price(pair.MarketAdress)
+	if twapPrice == nil || twapPrice.Sign() == 0 {
+		return false
+	}
+
+	reserves := t.state.allMarketReserves[pair.TokenReserveIndex]
+	spot := spotPriceUQ(reserves[pair.NativeIndex], reserves[pair.TokenIndex])
+	if spot == nil {
+		return false
+	}
+
+	deviation := new(big.Int).Abs(new(big.Int).Sub(spot, twapPrice))
+	return exceedsPercent(deviation, twapPrice, TWAP_MAX_DEVIATION_PERCENT)
+}
+
+// Both legs away from their TWAP is what bait looks like, one leg moving is just the arb
+func (t *twapTracker) manipulated(buyFromPair models.UniswappyV2Pair, sellToPair models.UniswappyV2Pair) bool {
+	if t == nil {
+		return false
+	}
+
+	return t.deviates(buyFromPair) && t.deviates(sellToPair)
+}
+
+// The size to trade the crossed markets at, nil when the guard says to leave them alone
+func (s *botState) twapGuardSize(buyFromPair models.UniswappyV2Pair, sellToPair models.UniswappyV2Pair, size *big.Int) *big.Int {
+	if !s.twap.manipulated(buyFromPair, sellToPair) {
+		return size
+	}
+
+	s.logger.Debug("Arb legs far off their TWAP",
+		zap.String("buyFromPair", buyFromPair.MarketAdress.Hex()),
+		zap.String("sellToPair", sellToPair.MarketAdress.Hex()),
+		zap.String("mode", s.config.TwapGuardMode),
+	)
+
+	if s.config.TwapGuardMode == TWAP_GUARD_CAP {
+		return new(big.Int).Div(new(big.Int).Mul(size, big.NewInt(TWAP_CAP_PERCENT)), big.NewInt(100))
+	}
+
+	return nil
+}
+
+// Price of the token in METIS as UQ112x112, nil for an empty pool
+func spotPriceUQ(nativeReserve *big.Int, tokenReserve *big.Int) *big.Int {
+	if nativeReserve == nil || tokenReserve == nil || tokenReserve.Sign() == 0 {
+		return nil
+	}
+
+	return new(big.Int).Div(new(big.Int).Mul(nativeReserve, uq112), tokenReserve)
+}
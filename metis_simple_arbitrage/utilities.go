@@ -1,6 +1,11 @@
 package metis_simple_arbitrage
 
-import "github.com/ethereum/go-ethereum/common"
+import (
+	"math/big"
+
+	"github.com/cryptotriv/raikiri/lib/models"
+	"github.com/ethereum/go-ethereum/common"
+)
 
 func addressInSlice(a common.Address, list []string) bool {
 	for _, b := range list {
@@ -20,3 +25,15 @@ func getTokenIndexesInPair(addr1 common.Address, addr2 common.Address) (metisInd
 		return -1, -1
 	}
 }
+
+func (s *botState) pairByMarketAddress(marketAddress common.Address) models.UniswappyV2Pair {
+	mapping := s.marketMapping[marketAddress]
+	return s.marketPairsByToken[mapping.TokenAddress][mapping.Index]
+}
+
+func maxBig(a *big.Int, b *big.Int) *big.Int {
+	if a.Cmp(b) >= 0 {
+		return a
+	}
+	return b
+}
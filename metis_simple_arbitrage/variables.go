@@ -16,6 +16,7 @@ var (
 	_botColor color.Attribute
 	_log_ch   chan<- models.MessageLog
 
+	// Defaults, each bot copies them and pulls the dynamic ones on startup
 	uniswapV2FactoryAddressFeePerTenThousands = map[string]int64{
 		NETSWAP_FACTORY_ADDRESS:    30,
 		AGORASWAP_FACTORY_ADDRESS:  10,
@@ -37,43 +38,96 @@ var (
 		METIDORIAN_FACTORY_ADDRESS,
 		// MINIME_FACTORY_ADDRESS,
 	}
+
+	// CREATE2 init code hash of each factory's pairs, the factory must report the same one if it reports any
+	// The bot refuses to start while any factory in uniswapV2FactoryAddresses is left empty, see pinnedInitCodeHashes
+	uniswapV2FactoryInitCodeHashes = map[string]string{
+		NETSWAP_FACTORY_ADDRESS:    "",
+		AGORASWAP_FACTORY_ADDRESS:  "",
+		TETHYS_FACTORY_ADDRESS:     "",
+		HERMES_FACTORY_ADDRESS:     "",
+		STANDARD_FACTORY_ADDRESS:   "",
+		UNKNOWN_FACTORY_ADDRESS:    "",
+		METIDORIAN_FACTORY_ADDRESS: "",
+	}
+
+	// Sentinels in the third slot of a market's reserves
+	STALE_RESERVE   = big.NewInt(0)
+	UPDATED_RESERVE = big.NewInt(1)
+
+	// Parsed once by initContractABIs, the same for every bot
+	contractABIsOnce   sync.Once
+	contractABIsErr    error
+	uniswapV2ABI       abi.ABI
+	hermesV1ABI        abi.ABI
+	executorABI        abi.ABI
+	tokenProvidenceABI abi.ABI
+	uniV2EventHash     common.Hash
+	hermesEventHash    common.Hash
+)
+
+// Everything one bot run reads and writes, owned by its Bot, or by a backtest or research run
+type botState struct {
 	bannedTokenAddresses []string
+	feePerTenThousands   map[string]int64 // factory to fee, the dynamic ones pulled on startup
 
 	allMarketAddresses        []common.Address
 	allMarketAddressFactories []common.Address
 	allMarketReserves         [][3]*big.Int
-	marketPairsByToken        map[common.Address][]models.UniswappyV2Pair = make(map[common.Address][]models.UniswappyV2Pair)
-	marketMapping             map[common.Address]models.MarketMapping     = make(map[common.Address]models.MarketMapping)
+	marketPairsByToken        map[common.Address][]models.UniswappyV2Pair
+	marketMapping             map[common.Address]models.MarketMapping
+	quarantinedMarkets        map[common.Address]string // pair to the reason
+	tokenRisks                map[common.Address]tokenRisk
+	quarantinedTokens         map[common.Address]uint64          // token to the block it's back
+	blockStartReserves        map[common.Address]reserveBaseline // market to its reserves before the block's Syncs
+	lastReserveBlock          uint64
+	anomalyAlerts             bool
+	twap                      *twapTracker // nil when the TWAP guard is off
 
-	exit                 = false
-	DEBUG                = false
-	PRIVATE_KEY_EXECUTOR string
+	debug              bool
+	privateKeyExecutor string
 
 	allConfig models.AllBotsConfig
 	config    models.SimpleArbitrageBot
 
 	logger     *zap.Logger
-	mainWg     *sync.WaitGroup
 	botContext models.BotContext
 
-	readClient  *ethclient.Client
+	readClient  *readPool
 	writeClient *ethclient.Client
+	broadcast   *broadcaster
+	localEVM    *forkedState
 
-	BASE_WEI                *big.Int
-	MIN_NATIVE_AMOUNT_WEI   *big.Int
-	MIN_PROFIT_WEI          *big.Int
-	MIN_PROFIT_WEI_FOLLOWUP *big.Int
-	STALE_RESERVE           *big.Int
-	UPDATED_RESERVE         *big.Int
-	MIN_GAS_GWEI            *big.Int
+	baseWei              *big.Int
+	minNativeAmountWei   *big.Int
+	minProfitWei         *big.Int
+	minProfitWeiFollowUp *big.Int
+	minGasGwei           *big.Int
 
-	uniswapV2ABI    abi.ABI
-	hermesV1ABI     abi.ABI
-	uniV2EventHash  common.Hash
-	hermesEventHash common.Hash
-	reservesUpdate  models.ReservesSyncEvent
+	maxFollowUpDepth int
 
 	mu             sync.Mutex
-	arbTxSentCount = 0
-	nonce          uint64
-)
+	arbTxSentCount int
+	executors      *accountPool
+	tracker        *txTracker
+	pga            *pgaEngine
+	gasPricing     gasStrategy
+	journal        *recorder
+}
+
+// Empty market state with the default fees, logging to the logger
+func newBotState(logger *zap.Logger) *botState {
+	s := &botState{
+		feePerTenThousands: make(map[string]int64, len(uniswapV2FactoryAddressFeePerTenThousands)),
+		logger:             logger,
+		maxFollowUpDepth:   MAX_FOLLOW_UP_DEPTH,
+	}
+
+	for factoryAddress, fee := range uniswapV2FactoryAddressFeePerTenThousands {
+		s.feePerTenThousands[factoryAddress] = fee
+	}
+
+	s.resetMarketState()
+
+	return s
+}